@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/config"
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/internal/repository"
+	"github.com/Kosench/ecommerce-lab/internal/service"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const apiKeyUsage = `usage: app apikey <command>
+
+commands:
+  create -name NAME -scopes SCOPE[,SCOPE...] [-ttl DURATION]
+            mint a key; it is printed once and never stored in plaintext
+  revoke ID revoke a key
+  list      list keys`
+
+// runAPIKey implements the "apikey" subcommand.
+func runAPIKey(cfg *config.Config, logr logger.Logger, args []string) error {
+	if len(args) == 0 {
+		return errors.New(apiKeyUsage)
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, cfg.Database.URL)
+	if err != nil {
+		return fmt.Errorf("connect to db: %w", err)
+	}
+	defer pool.Close()
+
+	keys := service.NewAPIKeyService(repository.NewAPIKeyRepository(pool, logr), logr)
+
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("apikey create", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		name := fs.String("name", "", "")
+		scopes := fs.String("scopes", "", "")
+		ttl := fs.Duration("ttl", 0, "")
+		if err := fs.Parse(args[1:]); err != nil {
+			return fmt.Errorf("create: %w\n\n%s", err, apiKeyUsage)
+		}
+
+		var scopeList []string
+		if *scopes != "" {
+			scopeList = strings.Split(*scopes, ",")
+		}
+		key, plain, err := keys.CreateKey(ctx, *name, scopeList, *ttl)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("id:     %s\nscopes: %s\nkey:    %s\n", key.ID, strings.Join(key.Scopes, ","), plain)
+		fmt.Println("store the key now; it cannot be shown again")
+	case "revoke":
+		if len(args) != 2 {
+			return fmt.Errorf("revoke: exactly one key ID is required\n\n%s", apiKeyUsage)
+		}
+		key, err := keys.RevokeKey(ctx, args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("revoked %s (%s) at %s\n", key.ID, key.Name, key.RevokedAt.Format(time.RFC3339))
+	case "list":
+		list, err := keys.ListKeys(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tPREFIX\tNAME\tSCOPES\tEXPIRES AT\tLAST USED AT\tSTATUS")
+		now := time.Now()
+		for _, k := range list {
+			status := "active"
+			switch err := k.Usable(now); {
+			case errors.Is(err, model.ErrAPIKeyRevoked):
+				status = "revoked"
+			case errors.Is(err, model.ErrAPIKeyExpired):
+				status = "expired"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				k.ID, k.Prefix, k.Name, strings.Join(k.Scopes, ","), formatTime(k.ExpiresAt, "never"), formatTime(k.LastUsedAt, "never"), status)
+		}
+		tw.Flush()
+	default:
+		return fmt.Errorf("unknown apikey command %q\n\n%s", args[0], apiKeyUsage)
+	}
+	return nil
+}
+
+func formatTime(t *time.Time, none string) string {
+	if t == nil {
+		return none
+	}
+	return t.Format(time.RFC3339)
+}
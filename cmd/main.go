@@ -2,20 +2,33 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
+	"github.com/Kosench/ecommerce-lab/internal/auth"
 	"github.com/Kosench/ecommerce-lab/internal/config"
 	"github.com/Kosench/ecommerce-lab/internal/handler"
+	"github.com/Kosench/ecommerce-lab/internal/metrics"
 	"github.com/Kosench/ecommerce-lab/internal/middleware/httpmw"
+	"github.com/Kosench/ecommerce-lab/internal/outbox"
+	"github.com/Kosench/ecommerce-lab/internal/payments"
+	"github.com/Kosench/ecommerce-lab/internal/policy"
 	"github.com/Kosench/ecommerce-lab/internal/repository"
 	"github.com/Kosench/ecommerce-lab/internal/service"
+	"github.com/Kosench/ecommerce-lab/internal/tax"
+	"github.com/Kosench/ecommerce-lab/internal/webhook"
+	"github.com/Kosench/ecommerce-lab/migrations"
 	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"github.com/Kosench/ecommerce-lab/platform/migrate"
+	"github.com/Kosench/ecommerce-lab/platform/tracing"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 )
 
@@ -28,6 +41,53 @@ func main() {
 	}
 	defer logr.(*logger.ZapLogger).Sync()
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			if err := runMigrate(cfg, logr, os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		case "apikey":
+			if err := runAPIKey(cfg, logr, os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		case "payment-event":
+			if err := runPaymentEvent(cfg, os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		default:
+			fmt.Fprintf(os.Stderr, "unknown command %q\n", os.Args[1])
+			os.Exit(2)
+		}
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.OTLPEndpoint,
+		ServiceName: cfg.Tracing.ServiceName,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		logr.Fatal("failed to set up tracing",
+			zap.Error(err),
+		)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logr.Error("failed to flush traces",
+				zap.Error(err),
+			)
+		}
+	}()
+
 	poolConfig, err := pgxpool.ParseConfig(cfg.Database.URL)
 	if err != nil {
 		logr.Fatal("failed to parse database url",
@@ -38,6 +98,7 @@ func main() {
 	poolConfig.MaxConns = int32(cfg.Database.MaxOpenConns)
 	poolConfig.MinConns = int32(cfg.Database.MaxIdleConns)
 	poolConfig.MaxConnLifetime = cfg.Database.ConnMaxLifetime
+	poolConfig.ConnConfig.Tracer = tracing.NewQueryTracer()
 
 	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
@@ -53,7 +114,16 @@ func main() {
 		zap.Int("max_idle_conns", cfg.Database.MaxIdleConns),
 	)
 
-	healthHandler := handler.NewHealthHandler(pool, logr)
+	prometheus.MustRegister(metrics.NewPoolCollector(pool))
+
+	migrator, err := migrate.New(pool, migrations.FS, logr)
+	if err != nil {
+		logr.Fatal("failed to load migrations",
+			zap.Error(err),
+		)
+	}
+
+	healthHandler := handler.NewHealthHandler(pool, migrator, logr)
 
 	readyCtx, readyCancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer readyCancel()
@@ -66,21 +136,181 @@ func main() {
 
 	logr.Info("database is ready")
 
+	if cfg.Database.MigrateOnStart {
+		n, err := migrator.Up(context.Background())
+		if err != nil {
+			logr.Fatal("failed to apply migrations",
+				zap.Error(err),
+			)
+		}
+		logr.Info("migrations applied",
+			zap.Int("count", n),
+			zap.Int64("version", migrator.Latest()),
+		)
+	}
+
+	verifier, err := auth.NewVerifier(auth.JWTConfig{
+		HMACSecret:    cfg.Auth.JWTSecret,
+		PublicKeyFile: cfg.Auth.JWTPublicKeyFile,
+		JWKSFile:      cfg.Auth.JWKSFile,
+		Issuer:        cfg.Auth.JWTIssuer,
+		Audience:      cfg.Auth.JWTAudience,
+	})
+	if err != nil {
+		logr.Fatal("failed to set up JWT verification",
+			zap.Error(err),
+		)
+	}
+
+	accessPolicy := policy.Default()
+	if cfg.Auth.PolicyFile != "" {
+		accessPolicy, err = policy.Load(cfg.Auth.PolicyFile)
+		if err != nil {
+			logr.Fatal("failed to load access policy",
+				zap.Error(err),
+			)
+		}
+	}
+	authz := policy.NewAuthorizer(accessPolicy, logr)
+
+	apiKeyService := service.NewAPIKeyService(repository.NewAPIKeyRepository(pool, logr), logr)
+
+	productRepo := repository.NewProductRepository(pool, logr)
+	productService := service.NewProductService(productRepo, logr)
+	productHandler := handler.NewProductHandler(productService, logr)
+
+	stockRepo := repository.NewStockRepository(pool, logr)
+	inventoryService := service.NewInventoryService(stockRepo, logr)
+	inventoryHandler := handler.NewInventoryHandler(inventoryService, logr)
+
+	couponRepo := repository.NewCouponRepository(pool, logr)
+	couponService := service.NewCouponService(couponRepo, logr)
+	couponHandler := handler.NewCouponHandler(couponService, logr)
+
+	var taxes tax.Calculator = tax.None{}
+	if cfg.Tax.RatesFile != "" {
+		taxes, err = tax.Load(cfg.Tax.RatesFile)
+		if err != nil {
+			logr.Fatal("failed to load tax rates",
+				zap.Error(err),
+			)
+		}
+	} else {
+		logr.Warn("orders are not taxed, TAX_RATES_FILE is not set")
+	}
+
 	orderRepo := repository.NewOrderRepository(pool, logr)
-	orderService := service.NewOrderService(orderRepo, logr)
+	orderService := service.NewOrderService(orderRepo, productRepo, couponRepo, taxes, authz, logr)
 	orderHandler := handler.NewOrderHandler(orderService, logr)
+	idempotencyRepo := repository.NewIdempotencyRepository(pool, logr)
+
+	paymentProvider, paymentWebhooks, err := newPaymentProvider(cfg.Payments)
+	if err != nil {
+		logr.Fatal("failed to create payment provider",
+			zap.Error(err),
+		)
+	}
+	webhookVerifiers := make(map[string]payments.WebhookVerifier)
+	if paymentWebhooks != nil {
+		webhookVerifiers[paymentProvider.Name()] = paymentWebhooks
+	} else {
+		logr.Warn("payment webhooks disabled, PAYMENT_WEBHOOK_SECRET is not set",
+			zap.String("provider", paymentProvider.Name()),
+		)
+	}
+	paymentService := service.NewPaymentService(orderRepo, repository.NewPaymentRepository(pool, logr), repository.NewPaymentEventRepository(pool, logr), paymentProvider, authz, logr)
+	paymentHandler := handler.NewPaymentHandler(paymentService, webhookVerifiers, logr)
+
+	cartRepo := repository.NewCartRepository(pool, logr)
+	cartService := service.NewCartService(cartRepo, productRepo, orderService, logr)
+	cartHandler := handler.NewCartHandler(cartService, logr)
+
+	webhookRepo := repository.NewWebhookRepository(pool, logr)
+	webhookService := service.NewWebhookService(webhookRepo, logr)
+	webhookHandler := handler.NewWebhookHandler(webhookService, logr)
 
 	mux := http.NewServeMux()
 
 	// Health endpoints
 	mux.HandleFunc("GET /health", healthHandler.Liveness)
 	mux.HandleFunc("GET /ready", healthHandler.Readiness)
+	mux.Handle("GET /metrics", metrics.Handler())
+
+	// Business endpoints. The catalog is public to read; changing it, coupons
+	// and webhook subscriptions are admin-only.
+	admin := func(h http.HandlerFunc) http.Handler {
+		return httpmw.RequireScope(auth.ScopeAdmin, h)
+	}
+
+	mux.Handle("POST /products", admin(productHandler.CreateProduct))
+	mux.HandleFunc("GET /products", productHandler.ListProducts)
+	mux.HandleFunc("GET /products/{id}", productHandler.GetProduct)
+	mux.Handle("PATCH /products/{id}", admin(productHandler.UpdateProduct))
+	mux.Handle("DELETE /products/{id}", admin(productHandler.DeleteProduct))
+	mux.HandleFunc("GET /products/{id}/stock", inventoryHandler.GetStock)
+	mux.Handle("PUT /products/{id}/stock", admin(inventoryHandler.SetStock))
+
+	mux.Handle("POST /coupons", admin(couponHandler.CreateCoupon))
+	mux.Handle("GET /coupons", admin(couponHandler.ListCoupons))
+	mux.HandleFunc("GET /coupons/{code}", couponHandler.GetCoupon)
+	mux.Handle("PATCH /coupons/{code}", admin(couponHandler.UpdateCoupon))
 
-	// Business endpoints
-	mux.HandleFunc("POST /orders", orderHandler.CreateOrder)
+	mux.Handle("POST /webhooks/subscriptions", admin(webhookHandler.CreateSubscription))
+	mux.Handle("GET /webhooks/subscriptions", admin(webhookHandler.ListSubscriptions))
+	mux.Handle("GET /webhooks/subscriptions/{id}", admin(webhookHandler.GetSubscription))
+	mux.Handle("DELETE /webhooks/subscriptions/{id}", admin(webhookHandler.DeleteSubscription))
+	mux.Handle("POST /webhooks/subscriptions/{id}/rotate-secret", admin(webhookHandler.RotateSecret))
+	mux.Handle("GET /webhooks/subscriptions/{id}/deliveries", admin(webhookHandler.ListDeliveries))
 
-	handlerWithMiddleware := httpmw.Recovery(
-		httpmw.Logging(mux, logr),
+	// Providers authenticate by signing the request, not with our credentials.
+	mux.HandleFunc("POST /webhooks/payments/{provider}", paymentHandler.HandleWebhook)
+
+	// Order endpoints need a caller with the right scope. Users get the
+	// order scopes with their token; API keys only those they were minted with.
+	mux.Handle("POST /orders", httpmw.RequireScope(auth.ScopeOrdersWrite, httpmw.Idempotency(
+		http.HandlerFunc(orderHandler.CreateOrder),
+		idempotencyRepo,
+		cfg.Idempotency.TTL,
+		cfg.Idempotency.Lease,
+		logr,
+	)))
+	mux.Handle("GET /orders", httpmw.RequireScope(auth.ScopeOrdersRead, http.HandlerFunc(orderHandler.ListOrders)))
+	mux.Handle("GET /orders/{id}", httpmw.RequireScope(auth.ScopeOrdersRead, http.HandlerFunc(orderHandler.GetOrder)))
+	mux.Handle("POST /orders/{id}/pay", httpmw.RequireScope(auth.ScopeOrdersWrite, http.HandlerFunc(paymentHandler.PayOrder)))
+	mux.Handle("POST /orders/{id}/refunds", httpmw.RequireScope(auth.ScopeOrdersWrite, httpmw.Idempotency(
+		http.HandlerFunc(paymentHandler.RefundOrder),
+		idempotencyRepo,
+		cfg.Idempotency.TTL,
+		cfg.Idempotency.Lease,
+		logr,
+	)))
+	mux.Handle("POST /orders/{id}/cancel", httpmw.RequireScope(auth.ScopeOrdersWrite, http.HandlerFunc(orderHandler.CancelOrder)))
+	mux.Handle("GET /users/{id}/orders", httpmw.RequireScope(auth.ScopeOrdersRead, http.HandlerFunc(orderHandler.ListUserOrders)))
+
+	mux.HandleFunc("POST /carts", cartHandler.CreateCart)
+	mux.HandleFunc("GET /carts/{id}", cartHandler.GetCart)
+	mux.HandleFunc("POST /carts/{id}/items", cartHandler.AddItem)
+	mux.HandleFunc("PUT /carts/{id}/items/{product_id}", cartHandler.SetItemQuantity)
+	mux.HandleFunc("DELETE /carts/{id}/items/{product_id}", cartHandler.RemoveItem)
+	mux.Handle("POST /carts/{id}/merge", httpmw.RequireAuth(http.HandlerFunc(cartHandler.MergeCarts)))
+	mux.Handle("POST /carts/{id}/checkout", httpmw.RequireScope(auth.ScopeOrdersWrite, httpmw.Idempotency(
+		http.HandlerFunc(cartHandler.Checkout),
+		idempotencyRepo,
+		cfg.Idempotency.TTL,
+		cfg.Idempotency.Lease,
+		logr,
+	)))
+
+	handlerWithMiddleware := httpmw.RequestID(
+		httpmw.Tracing(
+			httpmw.Recovery(
+				httpmw.Logging(httpmw.Metrics(httpmw.Authenticate(mux, verifier, apiKeyService, logr), mux), logr),
+				logr,
+			),
+			mux,
+			logr,
+		),
+		mux,
 		logr,
 	)
 
@@ -91,6 +321,45 @@ func main() {
 		WriteTimeout: cfg.Server.WriteTimeout,
 	}
 
+	outboxPublisher, closePublisher, err := newOutboxPublisher(cfg.Outbox)
+	if err != nil {
+		logr.Fatal("failed to create outbox publisher",
+			zap.Error(err),
+		)
+	}
+	defer closePublisher()
+
+	relay := outbox.NewRelay(
+		repository.NewOutboxRepository(pool, logr),
+		outbox.FanOut(outboxPublisher, webhook.NewPublisher(webhookRepo)),
+		outbox.RelayConfig{
+			PollInterval: cfg.Outbox.PollInterval,
+			BatchSize:    cfg.Outbox.BatchSize,
+		},
+		logr,
+	)
+
+	dispatcher := webhook.NewDispatcher(
+		webhookRepo,
+		&http.Client{},
+		webhook.DispatcherConfig{
+			PollInterval: cfg.Webhook.PollInterval,
+			Timeout:      cfg.Webhook.Timeout,
+			Cutoff:       cfg.Webhook.RetryCutoff,
+		},
+		logr,
+	)
+
+	bgCtx, bgCancel := context.WithCancel(context.Background())
+	var bg sync.WaitGroup
+	bg.Go(func() { relay.Run(bgCtx) })
+	bg.Go(func() { dispatcher.Run(bgCtx) })
+	bg.Go(func() { purgeExpiredIdempotencyKeys(bgCtx, idempotencyRepo, cfg.Idempotency.TTL, logr) })
+	defer func() {
+		bgCancel()
+		bg.Wait()
+	}()
+
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
@@ -120,3 +389,59 @@ func main() {
 
 	logr.Info("server stopped")
 }
+
+func newOutboxPublisher(cfg config.OutboxConfig) (outbox.Publisher, func() error, error) {
+	noClose := func() error { return nil }
+
+	switch cfg.Publisher {
+	case "stdout":
+		return outbox.NewStdoutPublisher(), noClose, nil
+	case "file":
+		p, closer, err := outbox.NewFilePublisher(cfg.FilePath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return p, closer.Close, nil
+	case "none":
+		return outbox.NopPublisher{}, noClose, nil
+	}
+	return nil, nil, fmt.Errorf("unknown outbox publisher %q", cfg.Publisher)
+}
+
+// newPaymentProvider returns the configured provider and the verifier for its
+// webhooks, which is nil if no webhook secret is set.
+func newPaymentProvider(cfg config.PaymentsConfig) (payments.PaymentProvider, payments.WebhookVerifier, error) {
+	switch cfg.Provider {
+	case "fake":
+		if cfg.WebhookSecret == "" {
+			return payments.NewFake(), nil, nil
+		}
+		return payments.NewFake(), payments.NewFakeWebhooks(cfg.WebhookSecret), nil
+	}
+	return nil, nil, fmt.Errorf("unknown payment provider %q", cfg.Provider)
+}
+
+func purgeExpiredIdempotencyKeys(ctx context.Context, repo repository.IdempotencyRepository, ttl time.Duration, logr logger.Logger) {
+	ticker := time.NewTicker(min(ttl, time.Hour))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := repo.DeleteExpired(ctx)
+			if err != nil {
+				logr.Error("failed to purge expired idempotency keys",
+					zap.Error(err),
+				)
+				continue
+			}
+			if n > 0 {
+				logr.Info("expired idempotency keys purged",
+					zap.Int64("count", n),
+				)
+			}
+		}
+	}
+}
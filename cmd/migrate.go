@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/config"
+	"github.com/Kosench/ecommerce-lab/migrations"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"github.com/Kosench/ecommerce-lab/platform/migrate"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const migrateUsage = `usage: app migrate <command>
+
+commands:
+  up                  apply all pending migrations
+  down [N]            roll back the last N migrations (default 1)
+  status              list migrations and when they were applied
+  baseline <version>  mark migrations up to version as applied without
+                      running them, for a database created before
+                      versioned migrations`
+
+// runMigrate implements the "migrate" subcommand.
+func runMigrate(cfg *config.Config, logr logger.Logger, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, cfg.Database.URL)
+	if err != nil {
+		return fmt.Errorf("connect to db: %w", err)
+	}
+	defer pool.Close()
+
+	migrator, err := migrate.New(pool, migrations.FS, logr)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		n, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("applied %d migration(s), schema at version %d\n", n, migrator.Latest())
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				return fmt.Errorf("down: N must be a positive integer, got %q", args[1])
+			}
+		}
+		n, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("rolled back %d migration(s)\n", n)
+	case "baseline":
+		if len(args) < 2 {
+			return fmt.Errorf("baseline: version is required\n\n%s", migrateUsage)
+		}
+		version, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil || version <= 0 {
+			return fmt.Errorf("baseline: version must be a positive integer, got %q", args[1])
+		}
+		n, err := migrator.Baseline(ctx, version)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("recorded %d migration(s) as applied, schema at version %d\n", n, version)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(tw, "%03d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		tw.Flush()
+	default:
+		return fmt.Errorf("unknown migrate command %q\n\n%s", args[0], migrateUsage)
+	}
+	return nil
+}
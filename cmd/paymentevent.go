@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/config"
+	"github.com/Kosench/ecommerce-lab/internal/payments"
+	"github.com/google/uuid"
+)
+
+const paymentEventUsage = `usage: app payment-event -type TYPE -order ID [flags]
+
+sends a webhook signed with PAYMENT_WEBHOOK_SECRET, as the fake payment
+provider would
+
+flags:
+  -type TYPE           payment.captured, payment.failed or payment.refunded
+  -order ID            order the event is about
+  -authorization ID    provider authorization ID of the payment
+  -capture ID          provider capture ID, for payment.captured
+  -amount N            amount in minor units
+  -code CODE           failure code, for payment.failed
+  -id ID               event ID; repeat one to test deduplication
+  -url URL             endpoint (default http://localhost<SERVER_ADDR>/webhooks/payments/fake)`
+
+// runPaymentEvent implements the "payment-event" subcommand.
+func runPaymentEvent(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("payment-event", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	eventType := fs.String("type", "", "")
+	orderID := fs.String("order", "", "")
+	authorizationID := fs.String("authorization", "", "")
+	captureID := fs.String("capture", "", "")
+	amount := fs.Int64("amount", 0, "")
+	code := fs.String("code", "", "")
+	id := fs.String("id", "", "")
+	url := fs.String("url", "http://localhost"+cfg.Server.Addr+"/webhooks/payments/fake", "")
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w\n\n%s", err, paymentEventUsage)
+	}
+	if cfg.Payments.WebhookSecret == "" {
+		return errors.New("PAYMENT_WEBHOOK_SECRET is not set")
+	}
+	if *id == "" {
+		*id = "evt_" + uuid.NewString()
+	}
+
+	event := payments.Event{
+		ID:              *id,
+		Type:            payments.EventType(*eventType),
+		OrderID:         *orderID,
+		AuthorizationID: *authorizationID,
+		CaptureID:       *captureID,
+		Amount:          *amount,
+		FailureCode:     *code,
+		CreatedAt:       time.Now().UTC(),
+	}
+	if err := event.Validate(); err != nil {
+		return fmt.Errorf("%w\n\n%s", err, paymentEventUsage)
+	}
+
+	body, header, err := payments.NewFakeWebhooks(cfg.Payments.WebhookSecret).Sign(event, time.Now())
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, *url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	req.Header = header
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("send event: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+
+	fmt.Printf("event %s: %s\n", event.ID, resp.Status)
+	if len(respBody) > 0 {
+		fmt.Println(string(respBody))
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package apierror
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Kosench/ecommerce-lab/internal/auth"
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/internal/payments"
+	"github.com/Kosench/ecommerce-lab/internal/policy"
+	"github.com/Kosench/ecommerce-lab/internal/repository"
+	"github.com/Kosench/ecommerce-lab/internal/service"
+	"github.com/Kosench/ecommerce-lab/internal/tax"
+	"github.com/Kosench/ecommerce-lab/internal/validate"
+)
+
+// Stable problem codes. Clients depend on these; never rename one.
+const (
+	CodeInternal          = "internal_error"
+	CodeValidationFailed  = "validation_failed"
+	CodeInvalidBody       = "invalid_body"
+	CodeInvalidID         = "invalid_id"
+	CodeInvalidRequest    = "invalid_request"
+	CodeInvalidCursor     = "invalid_cursor"
+	CodeInsufficientStock = "insufficient_stock"
+	CodeUnauthenticated   = "unauthenticated"
+	CodeForbidden         = "forbidden"
+)
+
+type mapping struct {
+	err    error
+	status int
+	code   string
+}
+
+// mappings is checked in order with errors.Is; the first match wins.
+var mappings = []mapping{
+	{auth.ErrUnauthenticated, http.StatusUnauthorized, CodeUnauthenticated},
+	{auth.ErrForbidden, http.StatusForbidden, CodeForbidden},
+
+	{service.ErrInvalidRequest, http.StatusBadRequest, CodeInvalidRequest},
+	{service.ErrInvalidCursor, http.StatusBadRequest, CodeInvalidCursor},
+
+	{model.ErrEmptyUserID, http.StatusBadRequest, "missing_user_id"},
+	{model.ErrInvalidUserID, http.StatusBadRequest, "invalid_user_id"},
+	{model.ErrEmptyItems, http.StatusBadRequest, "empty_items"},
+	{model.ErrInvalidProduct, http.StatusBadRequest, "invalid_product_id"},
+	{model.ErrInvalidQuantity, http.StatusBadRequest, "invalid_quantity"},
+	{model.ErrInvalidPrice, http.StatusBadRequest, "invalid_price"},
+	{model.ErrInvalidCurrency, http.StatusBadRequest, "invalid_currency"},
+	{model.ErrMixedCurrencies, http.StatusBadRequest, "mixed_currencies"},
+	{model.ErrTotalTooLarge, http.StatusBadRequest, "total_too_large"},
+	{model.ErrInvalidCouponCode, http.StatusBadRequest, "invalid_coupon_code"},
+	{model.ErrUnknownCouponType, http.StatusBadRequest, "unknown_coupon_type"},
+	{model.ErrInvalidPercentOff, http.StatusBadRequest, "invalid_percent_off"},
+	{model.ErrInvalidAmountOff, http.StatusBadRequest, "invalid_amount_off"},
+	{model.ErrInvalidBuyGet, http.StatusBadRequest, "invalid_buy_get_quantity"},
+	{model.ErrInvalidMinSubtotal, http.StatusBadRequest, "invalid_min_subtotal"},
+	{model.ErrInvalidLimit, http.StatusBadRequest, "invalid_redemption_limit"},
+	{model.ErrInvalidValidity, http.StatusBadRequest, "invalid_validity_window"},
+	{model.ErrDuplicateCoupon, http.StatusBadRequest, "duplicate_coupon"},
+	{model.ErrCouponInactive, http.StatusBadRequest, "coupon_inactive"},
+	{model.ErrCouponNotStarted, http.StatusBadRequest, "coupon_not_started"},
+	{model.ErrCouponExpired, http.StatusBadRequest, "coupon_expired"},
+	{model.ErrCouponCurrency, http.StatusBadRequest, "coupon_currency_mismatch"},
+	{model.ErrCouponMinSubtotal, http.StatusBadRequest, "coupon_min_subtotal_not_met"},
+	{model.ErrCouponNotApplicable, http.StatusBadRequest, "coupon_not_applicable"},
+	{model.ErrNothingToPay, http.StatusBadRequest, "nothing_to_pay"},
+	{tax.ErrJurisdictionRequired, http.StatusBadRequest, "missing_tax_jurisdiction"},
+	{tax.ErrUnknownJurisdiction, http.StatusBadRequest, "unknown_tax_jurisdiction"},
+	{model.ErrEmptyProductName, http.StatusBadRequest, "missing_product_name"},
+	{model.ErrInvalidTaxCategory, http.StatusBadRequest, "invalid_tax_category"},
+	{model.ErrProductInactive, http.StatusBadRequest, "inactive_product"},
+	{model.ErrInvalidStock, http.StatusBadRequest, "invalid_stock"},
+	{model.ErrUnknownStatus, http.StatusBadRequest, "unknown_status"},
+	{service.ErrInvalidTimeRange, http.StatusBadRequest, "invalid_time_range"},
+	{model.ErrInvalidWebhookURL, http.StatusBadRequest, "invalid_webhook_url"},
+	{model.ErrEmptyEventTypes, http.StatusBadRequest, "empty_event_types"},
+	{model.ErrUnknownEventType, http.StatusBadRequest, "unknown_event_type"},
+	{model.ErrMergeSameCart, http.StatusBadRequest, "merge_same_cart"},
+	{model.ErrEmptyPaymentMethod, http.StatusBadRequest, "missing_payment_method"},
+	{model.ErrEmptyAPIKeyName, http.StatusBadRequest, "missing_api_key_name"},
+	{model.ErrEmptyScopes, http.StatusBadRequest, "empty_scopes"},
+	{model.ErrUnknownScope, http.StatusBadRequest, "unknown_scope"},
+	{model.ErrInvalidTTL, http.StatusBadRequest, "invalid_ttl"},
+	{model.ErrRefundItemNotInOrder, http.StatusBadRequest, "refund_item_not_in_order"},
+	{model.ErrRefundQuantityExceeded, http.StatusBadRequest, "refund_quantity_exceeded"},
+	{payments.ErrInvalidSignature, http.StatusBadRequest, "invalid_signature"},
+	{payments.ErrInvalidEvent, http.StatusBadRequest, "invalid_payment_event"},
+
+	{model.ErrInvalidTransition, http.StatusConflict, "invalid_transition"},
+	{model.ErrStockBelowReserve, http.StatusConflict, "stock_below_reserved"},
+	{model.ErrInsufficientStock, http.StatusConflict, CodeInsufficientStock},
+	{model.ErrCartNotOpen, http.StatusConflict, "cart_not_open"},
+	{model.ErrCartChanged, http.StatusConflict, "cart_changed"},
+	{model.ErrEmptyCart, http.StatusConflict, "cart_empty"},
+	{model.ErrCartAnonymous, http.StatusConflict, "cart_anonymous"},
+	{model.ErrCartNotAnonymous, http.StatusConflict, "cart_not_anonymous"},
+	{model.ErrOrderNotRefundable, http.StatusConflict, "order_not_refundable"},
+	{model.ErrRefundExceedsTotal, http.StatusConflict, "refund_exceeds_total"},
+	{model.ErrNothingToRefund, http.StatusConflict, "nothing_to_refund"},
+	{model.ErrNoCapturedPayment, http.StatusConflict, "no_captured_payment"},
+	{model.ErrCouponLimitReached, http.StatusConflict, "coupon_limit_reached"},
+	{model.ErrCouponUserLimitReached, http.StatusConflict, "coupon_user_limit_reached"},
+	{repository.ErrCouponCodeTaken, http.StatusConflict, "coupon_code_taken"},
+
+	{payments.ErrPaymentDeclined, http.StatusPaymentRequired, "payment_declined"},
+	{payments.ErrProviderFailed, http.StatusBadGateway, "payment_provider_error"},
+
+	{repository.ErrOrderNotFound, http.StatusNotFound, "order_not_found"},
+	{repository.ErrProductNotFound, http.StatusNotFound, "product_not_found"},
+	{repository.ErrWebhookSubscriptionNotFound, http.StatusNotFound, "webhook_subscription_not_found"},
+	{repository.ErrCartNotFound, http.StatusNotFound, "cart_not_found"},
+	{repository.ErrCartItemNotFound, http.StatusNotFound, "cart_item_not_found"},
+	{repository.ErrCouponNotFound, http.StatusNotFound, "coupon_not_found"},
+}
+
+// FromError maps a domain error to a problem. Validation errors become a 400
+// listing every invalid field; unknown errors become a 500 that does not leak
+// the error text.
+func FromError(err error) *Problem {
+	var fieldErrs validate.Errors
+	if errors.As(err, &fieldErrs) {
+		return Invalid(invalidParams(fieldErrs)...)
+	}
+	var fieldErr *validate.FieldError
+	if errors.As(err, &fieldErr) {
+		return Invalid(invalidParams(validate.Errors{fieldErr})...)
+	}
+
+	m, ok := lookup(err)
+	if !ok {
+		return Internal()
+	}
+	p := New(m.status, m.code, err.Error())
+
+	var denied *policy.DeniedError
+	if errors.As(err, &denied) {
+		p.With("rule", denied.Rule)
+	}
+
+	var decline *payments.DeclineError
+	if errors.As(err, &decline) {
+		p.With("provider_code", decline.Code)
+	}
+
+	var stockErr *model.InsufficientStockError
+	if errors.As(err, &stockErr) {
+		p.With("items", shortages(stockErr))
+	}
+	return p
+}
+
+func invalidParams(errs validate.Errors) []InvalidParam {
+	params := make([]InvalidParam, len(errs))
+	for i, fe := range errs {
+		params[i] = InvalidParam{Name: fe.Field, Reason: fe.Err.Error()}
+		if m, ok := lookup(fe.Err); ok {
+			params[i].Code = m.code
+		}
+	}
+	return params
+}
+
+func lookup(err error) (mapping, bool) {
+	for _, m := range mappings {
+		if errors.Is(err, m.err) {
+			return m, true
+		}
+	}
+	return mapping{}, false
+}
+
+type shortage struct {
+	ProductID string `json:"product_id"`
+	Requested int    `json:"requested"`
+	Available int    `json:"available"`
+}
+
+func shortages(err *model.InsufficientStockError) []shortage {
+	items := make([]shortage, len(err.Shortages))
+	for i, s := range err.Shortages {
+		items[i] = shortage{
+			ProductID: s.ProductID,
+			Requested: s.Requested,
+			Available: s.Available,
+		}
+	}
+	return items
+}
@@ -0,0 +1,112 @@
+// Package apierror renders errors as RFC 7807 problem details.
+package apierror
+
+import (
+	"encoding/json"
+	"maps"
+	"net/http"
+
+	"github.com/Kosench/ecommerce-lab/platform/requestid"
+)
+
+const ContentType = "application/problem+json"
+
+// Problem is an RFC 7807 problem detail. Code is a stable, machine-readable
+// identifier clients can switch on; Title and Detail are for humans and may
+// change.
+type Problem struct {
+	Type          string
+	Title         string
+	Status        int
+	Detail        string
+	Instance      string
+	Code          string
+	RequestID     string
+	InvalidParams []InvalidParam
+
+	// Extensions are extra members specific to a problem, rendered at the
+	// top level next to the standard ones.
+	Extensions map[string]any
+}
+
+// InvalidParam names a request field that failed validation and why. Code
+// is set when the failure maps to a stable problem code.
+type InvalidParam struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+	Code   string `json:"code,omitempty"`
+}
+
+func New(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}
+}
+
+// Invalid is a 400 problem listing every field that failed validation.
+func Invalid(params ...InvalidParam) *Problem {
+	p := New(http.StatusBadRequest, CodeValidationFailed, "request validation failed")
+	p.InvalidParams = params
+	return p
+}
+
+// Internal is the problem for errors that are not the client's fault. It
+// never carries the underlying error text.
+func Internal() *Problem {
+	return New(http.StatusInternalServerError, CodeInternal, "internal server error")
+}
+
+// With sets an extension member.
+func (p *Problem) With(key string, value any) *Problem {
+	if p.Extensions == nil {
+		p.Extensions = make(map[string]any)
+	}
+	p.Extensions[key] = value
+	return p
+}
+
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	m := make(map[string]any, len(p.Extensions)+8)
+	maps.Copy(m, p.Extensions)
+
+	m["type"] = p.Type
+	m["title"] = p.Title
+	m["status"] = p.Status
+	m["code"] = p.Code
+	if p.Detail != "" {
+		m["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		m["instance"] = p.Instance
+	}
+	if p.RequestID != "" {
+		m["request_id"] = p.RequestID
+	}
+	if len(p.InvalidParams) > 0 {
+		m["invalid_params"] = p.InvalidParams
+	}
+	return json.Marshal(m)
+}
+
+// Write sends p, filling in the request path and request ID.
+func Write(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Instance == "" {
+		p.Instance = r.URL.Path
+	}
+	if p.RequestID == "" {
+		p.RequestID = requestid.FromContext(r.Context())
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
+
+// WriteError sends the problem err maps to.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	Write(w, r, FromError(err))
+}
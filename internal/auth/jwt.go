@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+var ErrInvalidToken = errors.New("invalid token")
+
+// JWTConfig says where verification keys come from. Any combination of
+// sources may be set; at least one is required.
+type JWTConfig struct {
+	// HMACSecret verifies HS256 tokens.
+	HMACSecret string
+	// PublicKeyFile is a PEM-encoded RSA public key verifying RS256 tokens.
+	PublicKeyFile string
+	// JWKSFile is a local JSON Web Key Set with RSA and/or oct keys,
+	// selected by the token's kid header.
+	JWKSFile string
+	// Issuer and Audience, if set, must match the iss and aud claims.
+	Issuer   string
+	Audience string
+}
+
+// Verifier checks bearer tokens and turns them into principals.
+type Verifier struct {
+	hmacKeys map[string][]byte
+	rsaKeys  map[string]*rsa.PublicKey
+	parser   *jwt.Parser
+}
+
+type claims struct {
+	Roles []string `json:"roles"`
+	jwt.RegisteredClaims
+}
+
+func NewVerifier(cfg JWTConfig) (*Verifier, error) {
+	v := &Verifier{
+		hmacKeys: make(map[string][]byte),
+		rsaKeys:  make(map[string]*rsa.PublicKey),
+	}
+
+	// Keys from config have no kid; they are stored under "" and used when
+	// a token's kid matches nothing in the key set.
+	if cfg.HMACSecret != "" {
+		v.hmacKeys[""] = []byte(cfg.HMACSecret)
+	}
+	if cfg.PublicKeyFile != "" {
+		pem, err := os.ReadFile(cfg.PublicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read public key: %w", err)
+		}
+		key, err := jwt.ParseRSAPublicKeyFromPEM(pem)
+		if err != nil {
+			return nil, fmt.Errorf("parse public key: %w", err)
+		}
+		v.rsaKeys[""] = key
+	}
+	if cfg.JWKSFile != "" {
+		if err := v.loadJWKS(cfg.JWKSFile); err != nil {
+			return nil, err
+		}
+	}
+	if len(v.hmacKeys) == 0 && len(v.rsaKeys) == 0 {
+		return nil, errors.New("no JWT verification keys configured")
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"HS256", "RS256"}),
+		jwt.WithExpirationRequired(),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	v.parser = jwt.NewParser(opts...)
+
+	return v, nil
+}
+
+// Verify checks the signature and registered claims of a token. The subject
+// must be a user ID; the roles claim is optional.
+func (v *Verifier) Verify(token string) (*Principal, error) {
+	var c claims
+	if _, err := v.parser.ParseWithClaims(token, &c, v.key); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if _, err := uuid.Parse(c.Subject); err != nil {
+		return nil, fmt.Errorf("%w: subject is not a user id", ErrInvalidToken)
+	}
+
+	return &Principal{UserID: c.Subject, Roles: c.Roles, Scopes: userScopes(c.Roles)}, nil
+}
+
+// key picks the verification key for a token. The key type follows the
+// algorithm, so an RSA public key can never be used as an HMAC secret.
+func (v *Verifier) key(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+
+	switch t.Method.Alg() {
+	case "HS256":
+		if key, ok := lookupKey(v.hmacKeys, kid); ok {
+			return key, nil
+		}
+	case "RS256":
+		if key, ok := lookupKey(v.rsaKeys, kid); ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("no %s key for kid %q", t.Method.Alg(), kid)
+}
+
+func lookupKey[K any](keys map[string]K, kid string) (K, bool) {
+	if key, ok := keys[kid]; ok {
+		return key, true
+	}
+	key, ok := keys[""]
+	return key, ok
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	K   string `json:"k"`
+}
+
+func (v *Verifier) loadJWKS(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read jwks: %w", err)
+	}
+	var set jwks
+	if err := json.Unmarshal(b, &set); err != nil {
+		return fmt.Errorf("parse jwks: %w", err)
+	}
+
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			if k.Alg != "" && k.Alg != "RS256" {
+				continue
+			}
+			key, err := rsaKey(k)
+			if err != nil {
+				return fmt.Errorf("jwks key %q: %w", k.Kid, err)
+			}
+			v.rsaKeys[k.Kid] = key
+		case "oct":
+			if k.Alg != "" && k.Alg != "HS256" {
+				continue
+			}
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil || len(secret) == 0 {
+				return fmt.Errorf("jwks key %q: invalid k", k.Kid)
+			}
+			v.hmacKeys[k.Kid] = secret
+		}
+	}
+	return nil
+}
+
+func rsaKey(k jwk) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil || len(n) == 0 {
+		return nil, errors.New("invalid modulus")
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil || len(e) == 0 || len(e) > 4 {
+		return nil, errors.New("invalid exponent")
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}, nil
+}
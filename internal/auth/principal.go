@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"slices"
+)
+
+const RoleAdmin = "admin"
+
+// Scopes limit what a caller may do. Admin implies every other scope.
+const (
+	ScopeOrdersRead  = "orders:read"
+	ScopeOrdersWrite = "orders:write"
+	ScopeAdmin       = "admin"
+)
+
+var Scopes = []string{ScopeOrdersRead, ScopeOrdersWrite, ScopeAdmin}
+
+var (
+	ErrUnauthenticated = errors.New("authentication required")
+	ErrForbidden       = errors.New("not allowed to access this resource")
+)
+
+// Principal is the authenticated caller of a request: either a user holding
+// a JWT or a service client holding an API key.
+type Principal struct {
+	UserID string
+	Roles  []string
+	// APIKeyID is set for service clients. They act for no particular user
+	// and are limited by their scopes only.
+	APIKeyID string
+	Scopes   []string
+}
+
+func (p *Principal) HasRole(role string) bool {
+	return slices.Contains(p.Roles, role)
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	return slices.Contains(p.Scopes, scope) || slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+func (p *Principal) IsAdmin() bool {
+	return p.HasRole(RoleAdmin) || slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+func (p *Principal) IsService() bool {
+	return p.APIKeyID != ""
+}
+
+// CanActFor reports whether p may use scope on data owned by userID. API
+// keys act for any user, but only within the scopes they were minted with.
+func (p *Principal) CanActFor(userID, scope string) bool {
+	if !p.HasScope(scope) {
+		return false
+	}
+	return p.IsAdmin() || p.IsService() || p.UserID == userID
+}
+
+// userScopes are the scopes of a user authenticated by JWT.
+func userScopes(roles []string) []string {
+	scopes := []string{ScopeOrdersRead, ScopeOrdersWrite}
+	if slices.Contains(roles, RoleAdmin) {
+		scopes = append(scopes, ScopeAdmin)
+	}
+	return scopes
+}
+
+type ctxKey struct{}
+
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, ctxKey{}, p)
+}
+
+// FromContext returns the principal stored in ctx, or false if the request
+// is anonymous.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(ctxKey{}).(*Principal)
+	return p, ok && p != nil
+}
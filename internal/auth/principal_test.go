@@ -0,0 +1,37 @@
+package auth_test
+
+import (
+	"testing"
+
+	"github.com/Kosench/ecommerce-lab/internal/auth"
+)
+
+func TestCanActFor(t *testing.T) {
+	const (
+		owner = "11111111-1111-1111-1111-111111111111"
+		other = "22222222-2222-2222-2222-222222222222"
+	)
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		userID    string
+		scope     string
+		want      bool
+	}{
+		{"user for themselves", &auth.Principal{UserID: owner, Scopes: []string{auth.ScopeOrdersRead, auth.ScopeOrdersWrite}}, owner, auth.ScopeOrdersWrite, true},
+		{"user for another user", &auth.Principal{UserID: owner, Scopes: []string{auth.ScopeOrdersRead, auth.ScopeOrdersWrite}}, other, auth.ScopeOrdersRead, false},
+		{"admin for another user", &auth.Principal{UserID: owner, Roles: []string{auth.RoleAdmin}, Scopes: []string{auth.ScopeAdmin}}, other, auth.ScopeOrdersWrite, true},
+		{"key within its scope", &auth.Principal{APIKeyID: "k1", Scopes: []string{auth.ScopeOrdersWrite}}, other, auth.ScopeOrdersWrite, true},
+		{"read-only key reads", &auth.Principal{APIKeyID: "k1", Scopes: []string{auth.ScopeOrdersRead}}, other, auth.ScopeOrdersRead, true},
+		{"read-only key writes", &auth.Principal{APIKeyID: "k1", Scopes: []string{auth.ScopeOrdersRead}}, other, auth.ScopeOrdersWrite, false},
+		{"admin key", &auth.Principal{APIKeyID: "k1", Scopes: []string{auth.ScopeAdmin}}, other, auth.ScopeOrdersWrite, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.principal.CanActFor(tt.userID, tt.scope); got != tt.want {
+				t.Errorf("CanActFor(%s, %s) = %t, want %t", tt.userID, tt.scope, got, tt.want)
+			}
+		})
+	}
+}
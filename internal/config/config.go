@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strconv"
 	"time"
 )
 
@@ -11,6 +12,13 @@ type Config struct {
 	Environment string
 	Server      ServerConfig
 	Database    DatabaseConfig
+	Idempotency IdempotencyConfig
+	Outbox      OutboxConfig
+	Webhook     WebhookConfig
+	Tracing     TracingConfig
+	Auth        AuthConfig
+	Payments    PaymentsConfig
+	Tax         TaxConfig
 }
 
 type ServerConfig struct {
@@ -25,6 +33,64 @@ type DatabaseConfig struct {
 	MaxOpenConns    int
 	MaxIdleConns    int
 	ConnMaxLifetime time.Duration
+	// MigrateOnStart applies pending schema migrations before serving.
+	MigrateOnStart bool
+}
+
+type IdempotencyConfig struct {
+	TTL time.Duration
+	// Lease is how long a key stays in progress before a retry may take it
+	// over. It must outlast the slowest request.
+	Lease time.Duration
+}
+
+type OutboxConfig struct {
+	// Publisher is one of "stdout", "file" or "none".
+	Publisher    string
+	FilePath     string
+	PollInterval time.Duration
+	BatchSize    int
+}
+
+type WebhookConfig struct {
+	Timeout      time.Duration
+	RetryCutoff  time.Duration
+	PollInterval time.Duration
+}
+
+type TracingConfig struct {
+	// Exporter is one of "otlp", "stdout" or "none".
+	Exporter     string
+	OTLPEndpoint string
+	ServiceName  string
+	SampleRatio  float64
+}
+
+// AuthConfig holds the JWT verification keys. At least one of JWTSecret,
+// JWTPublicKeyFile and JWKSFile must be set to serve requests.
+type AuthConfig struct {
+	JWTSecret        string
+	JWTPublicKeyFile string
+	JWKSFile         string
+	JWTIssuer        string
+	JWTAudience      string
+	// PolicyFile is a YAML or JSON access policy; the built-in policy is
+	// used if it is empty.
+	PolicyFile string
+}
+
+type PaymentsConfig struct {
+	// Provider is the payment provider to charge; only "fake" exists yet.
+	Provider string
+	// WebhookSecret signs the provider's webhooks. Without it, webhooks from
+	// the provider are not accepted.
+	WebhookSecret string
+}
+
+type TaxConfig struct {
+	// RatesFile is a YAML or JSON tax rate table; orders are not taxed if
+	// it is empty.
+	RatesFile string
 }
 
 func Load() (*Config, error) {
@@ -43,6 +109,64 @@ func Load() (*Config, error) {
 		return nil, errors.New("DATABASE_URL is required")
 	}
 
+	migrateOnStart, err := getBool("MIGRATE_ON_START", false)
+	if err != nil {
+		return nil, err
+	}
+
+	idempotencyTTL, err := getDuration("IDEMPOTENCY_TTL", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	idempotencyLease, err := getDuration("IDEMPOTENCY_LEASE", time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	outboxPublisher := os.Getenv("OUTBOX_PUBLISHER")
+	if outboxPublisher == "" {
+		outboxPublisher = "stdout"
+	}
+	outboxFile := os.Getenv("OUTBOX_FILE")
+	if outboxPublisher == "file" && outboxFile == "" {
+		return nil, errors.New("OUTBOX_FILE is required when OUTBOX_PUBLISHER=file")
+	}
+
+	outboxPollInterval, err := getDuration("OUTBOX_POLL_INTERVAL", time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	webhookTimeout, err := getDuration("WEBHOOK_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	webhookCutoff, err := getDuration("WEBHOOK_RETRY_CUTOFF", 24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	traceExporter := os.Getenv("TRACING_EXPORTER")
+	if traceExporter == "" {
+		traceExporter = "none"
+	}
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "ecommerce-lab"
+	}
+	sampleRatio := 1.0
+	if v := os.Getenv("TRACING_SAMPLE_RATIO"); v != "" {
+		sampleRatio, err = strconv.ParseFloat(v, 64)
+		if err != nil || sampleRatio < 0 || sampleRatio > 1 {
+			return nil, errors.New("TRACING_SAMPLE_RATIO must be a number between 0 and 1")
+		}
+	}
+
+	paymentProvider := os.Getenv("PAYMENT_PROVIDER")
+	if paymentProvider == "" {
+		paymentProvider = "fake"
+	}
+
 	return &Config{
 		Environment: env,
 		Server: ServerConfig{
@@ -56,10 +180,76 @@ func Load() (*Config, error) {
 			MaxOpenConns:    25,
 			MaxIdleConns:    5,
 			ConnMaxLifetime: 30 * time.Minute,
+			MigrateOnStart:  migrateOnStart,
+		},
+		Idempotency: IdempotencyConfig{
+			TTL:   idempotencyTTL,
+			Lease: idempotencyLease,
+		},
+		Outbox: OutboxConfig{
+			Publisher:    outboxPublisher,
+			FilePath:     outboxFile,
+			PollInterval: outboxPollInterval,
+			BatchSize:    100,
+		},
+		Webhook: WebhookConfig{
+			Timeout:      webhookTimeout,
+			RetryCutoff:  webhookCutoff,
+			PollInterval: time.Second,
+		},
+		Tracing: TracingConfig{
+			Exporter:     traceExporter,
+			OTLPEndpoint: os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"),
+			ServiceName:  serviceName,
+			SampleRatio:  sampleRatio,
+		},
+		Auth: AuthConfig{
+			JWTSecret:        os.Getenv("JWT_HS256_SECRET"),
+			JWTPublicKeyFile: os.Getenv("JWT_RS256_PUBLIC_KEY_FILE"),
+			JWKSFile:         os.Getenv("JWT_JWKS_FILE"),
+			JWTIssuer:        os.Getenv("JWT_ISSUER"),
+			JWTAudience:      os.Getenv("JWT_AUDIENCE"),
+			PolicyFile:       os.Getenv("POLICY_FILE"),
+		},
+		Payments: PaymentsConfig{
+			Provider:      paymentProvider,
+			WebhookSecret: os.Getenv("PAYMENT_WEBHOOK_SECRET"),
+		},
+		Tax: TaxConfig{
+			RatesFile: os.Getenv("TAX_RATES_FILE"),
 		},
 	}, nil
 }
 
+func getDuration(key string, def time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", key, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("%s must be positive", key)
+	}
+	return d, nil
+}
+
+func getBool(key string, def bool) (bool, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return def, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", key, err)
+	}
+	return b, nil
+}
+
 func MustLoad() *Config {
 	cfg, err := Load()
 	if err != nil {
@@ -0,0 +1,294 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/apierror"
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/internal/service"
+	"github.com/Kosench/ecommerce-lab/internal/validate"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"go.uber.org/zap"
+)
+
+type CartHandler struct {
+	cartService service.CartService
+	logger      logger.Logger
+}
+
+func NewCartHandler(cartService service.CartService, logger logger.Logger) *CartHandler {
+	return &CartHandler{
+		cartService: cartService,
+		logger:      logger.With(zap.String("component", "handler"))}
+}
+
+type addCartItemRequest struct {
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+}
+
+type setCartItemRequest struct {
+	Quantity int `json:"quantity"`
+}
+
+type mergeCartRequest struct {
+	SourceCartID string `json:"source_cart_id"`
+}
+
+type checkoutRequest struct {
+	CouponCodes     []string `json:"coupon_codes"`
+	TaxJurisdiction string   `json:"tax_jurisdiction"`
+}
+
+// cartResponse.Total and line totals are omitted if they cannot be
+// computed, such as when a product was repriced in another currency.
+type cartResponse struct {
+	ID        string             `json:"id"`
+	UserID    string             `json:"user_id,omitempty"`
+	Status    string             `json:"status"`
+	Items     []cartItemResponse `json:"items"`
+	Currency  string             `json:"currency,omitempty"`
+	Total     *int64             `json:"total,omitempty"`
+	OrderID   string             `json:"order_id,omitempty"`
+	CreatedAt time.Time          `json:"created_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+type cartItemResponse struct {
+	ProductID   string `json:"product_id"`
+	ProductName string `json:"product_name"`
+	Quantity    int    `json:"quantity"`
+	Price       int64  `json:"price"`
+	Currency    string `json:"currency"`
+	LineTotal   *int64 `json:"line_total,omitempty"`
+	Available   bool   `json:"available"`
+}
+
+func newCartResponse(cart *model.Cart) cartResponse {
+	items := make([]cartItemResponse, len(cart.Items))
+	for i, item := range cart.Items {
+		items[i] = cartItemResponse{
+			ProductID:   item.ProductID,
+			ProductName: item.ProductName,
+			Quantity:    item.Quantity,
+			Price:       item.Price.Amount(),
+			Currency:    string(item.Price.Currency()),
+			Available:   item.Available,
+		}
+		if lineTotal, err := item.LineTotal(); err == nil {
+			amount := lineTotal.Amount()
+			items[i].LineTotal = &amount
+		}
+	}
+
+	resp := cartResponse{
+		ID:        cart.ID,
+		UserID:    cart.UserID,
+		Status:    string(cart.Status),
+		Items:     items,
+		Currency:  string(cart.Currency()),
+		OrderID:   cart.OrderID,
+		CreatedAt: cart.CreatedAt,
+		UpdatedAt: cart.UpdatedAt,
+	}
+	if total, err := cart.Total(); err == nil {
+		amount := total.Amount()
+		resp.Total = &amount
+	}
+	return resp
+}
+
+// CreateCart creates a cart for the authenticated caller, or an anonymous
+// cart if the request has no bearer token.
+func (h *CartHandler) CreateCart(w http.ResponseWriter, r *http.Request) {
+	cart, err := h.cartService.CreateCart(r.Context(), callerID(r.Context()))
+	if err != nil {
+		writeProblem(w, r, h.logger, "cart request failed", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newCartResponse(cart))
+}
+
+func (h *CartHandler) GetCart(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.cartID(w, r)
+	if !ok {
+		return
+	}
+
+	cart, err := h.cartService.GetCart(r.Context(), id)
+	if err != nil {
+		writeProblem(w, r, h.logger, "cart request failed", err, zap.String("cart_id", id))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newCartResponse(cart))
+}
+
+func (h *CartHandler) AddItem(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.cartID(w, r)
+	if !ok {
+		return
+	}
+
+	var req addCartItemRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+
+	cart, err := h.cartService.AddItem(r.Context(), id, req.ProductID, req.Quantity)
+	if err != nil {
+		writeProblem(w, r, h.logger, "cart request failed", err, zap.String("cart_id", id))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newCartResponse(cart))
+}
+
+func (h *CartHandler) SetItemQuantity(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.cartID(w, r)
+	if !ok {
+		return
+	}
+	productID, ok := h.productID(w, r)
+	if !ok {
+		return
+	}
+
+	var req setCartItemRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+
+	cart, err := h.cartService.SetItemQuantity(r.Context(), id, productID, req.Quantity)
+	if err != nil {
+		writeProblem(w, r, h.logger, "cart request failed", err, zap.String("cart_id", id))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newCartResponse(cart))
+}
+
+func (h *CartHandler) RemoveItem(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.cartID(w, r)
+	if !ok {
+		return
+	}
+	productID, ok := h.productID(w, r)
+	if !ok {
+		return
+	}
+
+	cart, err := h.cartService.RemoveItem(r.Context(), id, productID)
+	if err != nil {
+		writeProblem(w, r, h.logger, "cart request failed", err, zap.String("cart_id", id))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newCartResponse(cart))
+}
+
+func (h *CartHandler) MergeCarts(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.cartID(w, r)
+	if !ok {
+		return
+	}
+
+	var req mergeCartRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+	if !isValidUUID(req.SourceCartID) {
+		apierror.WriteError(w, r, &validate.FieldError{Field: "source_cart_id", Err: errNotUUID})
+		return
+	}
+
+	cart, err := h.cartService.MergeCarts(r.Context(), id, req.SourceCartID)
+	if err != nil {
+		writeProblem(w, r, h.logger, "cart request failed", err, zap.String("cart_id", id))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newCartResponse(cart))
+}
+
+func (h *CartHandler) Checkout(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context(), h.logger)
+
+	id, ok := h.cartID(w, r)
+	if !ok {
+		return
+	}
+
+	// The body is optional: without one the order has no coupons and is
+	// taxed in the default jurisdiction.
+	var req checkoutRequest
+	if !h.decodeOptional(w, r, &req) {
+		return
+	}
+
+	order, err := h.cartService.Checkout(r.Context(), id, service.CheckoutParams{
+		CouponCodes:     req.CouponCodes,
+		TaxJurisdiction: req.TaxJurisdiction,
+	})
+	if err != nil {
+		recordValidationFailures(err)
+		writeProblem(w, r, h.logger, "cart request failed", err, zap.String("cart_id", id))
+		return
+	}
+
+	log.Info("cart checked out successfully",
+		zap.String("cart_id", id),
+		zap.String("order_id", order.ID),
+		zap.Stringer("total", order.Total),
+	)
+
+	writeJSON(w, http.StatusCreated, newOrderResponse(order))
+}
+
+func (h *CartHandler) cartID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := r.PathValue("id")
+	if !isValidUUID(id) {
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidID, "cart id must be a valid UUID"))
+		return "", false
+	}
+	return id, true
+}
+
+func (h *CartHandler) productID(w http.ResponseWriter, r *http.Request) (string, bool) {
+	id := r.PathValue("product_id")
+	if !isValidUUID(id) {
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidID, "product id must be a valid UUID"))
+		return "", false
+	}
+	return id, true
+}
+
+func (h *CartHandler) decode(w http.ResponseWriter, r *http.Request, dst any) bool {
+	return h.decoded(w, r, json.NewDecoder(r.Body).Decode(dst))
+}
+
+// decodeOptional is decode for a body that may be left out.
+func (h *CartHandler) decodeOptional(w http.ResponseWriter, r *http.Request, dst any) bool {
+	err := json.NewDecoder(r.Body).Decode(dst)
+	if errors.Is(err, io.EOF) {
+		return true
+	}
+	return h.decoded(w, r, err)
+}
+
+func (h *CartHandler) decoded(w http.ResponseWriter, r *http.Request, err error) bool {
+	if err != nil {
+		logger.WithContext(r.Context(), h.logger).Warn("invalid request body",
+			zap.Error(err),
+			zap.String("remote_addr", r.RemoteAddr),
+		)
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidBody, "invalid request body"))
+		return false
+	}
+	return true
+}
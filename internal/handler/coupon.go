@@ -0,0 +1,215 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/apierror"
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/internal/money"
+	"github.com/Kosench/ecommerce-lab/internal/service"
+	"github.com/Kosench/ecommerce-lab/internal/validate"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"go.uber.org/zap"
+)
+
+type CouponHandler struct {
+	couponService service.CouponService
+	logger        logger.Logger
+}
+
+func NewCouponHandler(couponService service.CouponService, logger logger.Logger) *CouponHandler {
+	return &CouponHandler{
+		couponService: couponService,
+		logger:        logger.With(zap.String("component", "handler"))}
+}
+
+// createCouponRequest.Currency applies to AmountOff and MinSubtotal.
+type createCouponRequest struct {
+	Code                  string     `json:"code"`
+	Type                  string     `json:"type"`
+	PercentOff            int        `json:"percent_off"`
+	AmountOff             int64      `json:"amount_off"`
+	BuyQuantity           int        `json:"buy_quantity"`
+	GetQuantity           int        `json:"get_quantity"`
+	Currency              string     `json:"currency"`
+	MinSubtotal           int64      `json:"min_subtotal"`
+	ProductIDs            []string   `json:"product_ids"`
+	MaxRedemptions        int        `json:"max_redemptions"`
+	MaxRedemptionsPerUser int        `json:"max_redemptions_per_user"`
+	StartsAt              *time.Time `json:"starts_at"`
+	EndsAt                *time.Time `json:"ends_at"`
+}
+
+type updateCouponRequest struct {
+	Active *bool      `json:"active"`
+	EndsAt *time.Time `json:"ends_at"`
+}
+
+type couponResponse struct {
+	ID                    string     `json:"id"`
+	Code                  string     `json:"code"`
+	Type                  string     `json:"type"`
+	PercentOff            int        `json:"percent_off,omitempty"`
+	AmountOff             int64      `json:"amount_off,omitempty"`
+	BuyQuantity           int        `json:"buy_quantity,omitempty"`
+	GetQuantity           int        `json:"get_quantity,omitempty"`
+	Currency              string     `json:"currency,omitempty"`
+	MinSubtotal           int64      `json:"min_subtotal,omitempty"`
+	ProductIDs            []string   `json:"product_ids,omitempty"`
+	MaxRedemptions        int        `json:"max_redemptions,omitempty"`
+	MaxRedemptionsPerUser int        `json:"max_redemptions_per_user,omitempty"`
+	StartsAt              *time.Time `json:"starts_at,omitempty"`
+	EndsAt                *time.Time `json:"ends_at,omitempty"`
+	Active                bool       `json:"active"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+}
+
+type listCouponsResponse struct {
+	Coupons []couponResponse `json:"coupons"`
+}
+
+func newCouponResponse(c *model.Coupon) couponResponse {
+	return couponResponse{
+		ID:                    c.ID,
+		Code:                  c.Code,
+		Type:                  string(c.Type),
+		PercentOff:            c.PercentOff,
+		AmountOff:             c.AmountOff.Amount(),
+		BuyQuantity:           c.BuyQuantity,
+		GetQuantity:           c.GetQuantity,
+		Currency:              string(c.Currency()),
+		MinSubtotal:           c.MinSubtotal.Amount(),
+		ProductIDs:            c.ProductIDs,
+		MaxRedemptions:        c.MaxRedemptions,
+		MaxRedemptionsPerUser: c.MaxRedemptionsPerUser,
+		StartsAt:              c.StartsAt,
+		EndsAt:                c.EndsAt,
+		Active:                c.Active,
+		CreatedAt:             c.CreatedAt,
+		UpdatedAt:             c.UpdatedAt,
+	}
+}
+
+func (h *CouponHandler) CreateCoupon(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context(), h.logger)
+
+	var req createCouponRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Warn("invalid request body",
+			zap.Error(err),
+			zap.String("remote_addr", r.RemoteAddr),
+		)
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidBody, "invalid request body"))
+		return
+	}
+
+	currency := model.DefaultCurrency
+	if req.Currency != "" {
+		currency = money.Currency(req.Currency)
+	}
+
+	coupon, err := h.couponService.CreateCoupon(r.Context(), model.Coupon{
+		Code:                  req.Code,
+		Type:                  model.CouponType(req.Type),
+		PercentOff:            req.PercentOff,
+		AmountOff:             money.New(req.AmountOff, currency),
+		BuyQuantity:           req.BuyQuantity,
+		GetQuantity:           req.GetQuantity,
+		MinSubtotal:           money.New(req.MinSubtotal, currency),
+		ProductIDs:            req.ProductIDs,
+		MaxRedemptions:        req.MaxRedemptions,
+		MaxRedemptionsPerUser: req.MaxRedemptionsPerUser,
+		StartsAt:              req.StartsAt,
+		EndsAt:                req.EndsAt,
+	})
+	if err != nil {
+		writeProblem(w, r, h.logger, "coupon request failed", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newCouponResponse(coupon))
+}
+
+func (h *CouponHandler) GetCoupon(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("code")
+
+	coupon, err := h.couponService.GetCoupon(r.Context(), code)
+	if err != nil {
+		writeProblem(w, r, h.logger, "coupon request failed", err, zap.String("code", code))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newCouponResponse(coupon))
+}
+
+func (h *CouponHandler) ListCoupons(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	params := service.ListCouponsParams{
+		ActiveOnly: query.Get("active") == "true",
+	}
+
+	var v validate.Validator
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{
+		{"limit", &params.Limit},
+		{"offset", &params.Offset},
+	} {
+		raw := query.Get(p.name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		v.Check(err == nil && n >= 0, p.name, errNegative)
+		*p.dst = n
+	}
+	if err := v.Err(); err != nil {
+		apierror.WriteError(w, r, err)
+		return
+	}
+
+	coupons, err := h.couponService.ListCoupons(r.Context(), params)
+	if err != nil {
+		writeProblem(w, r, h.logger, "coupon request failed", err)
+		return
+	}
+
+	resp := listCouponsResponse{Coupons: make([]couponResponse, len(coupons))}
+	for i, c := range coupons {
+		resp.Coupons[i] = newCouponResponse(c)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *CouponHandler) UpdateCoupon(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context(), h.logger)
+
+	code := r.PathValue("code")
+
+	var req updateCouponRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Warn("invalid request body",
+			zap.Error(err),
+			zap.String("remote_addr", r.RemoteAddr),
+		)
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidBody, "invalid request body"))
+		return
+	}
+
+	coupon, err := h.couponService.UpdateCoupon(r.Context(), code, service.CouponUpdate{
+		Active: req.Active,
+		EndsAt: req.EndsAt,
+	})
+	if err != nil {
+		writeProblem(w, r, h.logger, "coupon request failed", err, zap.String("code", code))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newCouponResponse(coupon))
+}
@@ -2,24 +2,27 @@ package handler
 
 import (
 	"context"
-	"encoding/json"
+	"fmt"
 	"net/http"
 	"time"
 
 	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"github.com/Kosench/ecommerce-lab/platform/migrate"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
 )
 
 type HealthHandler struct {
-	db     *pgxpool.Pool
-	logger logger.Logger
+	db       *pgxpool.Pool
+	migrator *migrate.Migrator
+	logger   logger.Logger
 }
 
-func NewHealthHandler(db *pgxpool.Pool, log logger.Logger) *HealthHandler {
+func NewHealthHandler(db *pgxpool.Pool, migrator *migrate.Migrator, log logger.Logger) *HealthHandler {
 	return &HealthHandler{
-		db:     db,
-		logger: log.With(zap.String("component", "health")),
+		db:       db,
+		migrator: migrator,
+		logger:   log.With(zap.String("component", "health")),
 	}
 }
 
@@ -37,17 +40,17 @@ func (h *HealthHandler) Liveness(w http.ResponseWriter, r *http.Request) {
 		Time:    time.Now().Format(time.RFC3339),
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(resp)
+	writeJSON(w, http.StatusOK, resp)
 }
 
 func (h *HealthHandler) Readiness(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context(), h.logger)
+
 	ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
 	defer cancel()
 
 	if err := h.db.Ping(ctx); err != nil {
-		h.logger.Error("database not ready",
+		log.Error("database not ready",
 			zap.Error(err),
 		)
 
@@ -57,9 +60,30 @@ func (h *HealthHandler) Readiness(w http.ResponseWriter, r *http.Request) {
 			Checks: map[string]string{"database": "failed"},
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusServiceUnavailable)
-		json.NewEncoder(w).Encode(resp)
+		writeJSON(w, http.StatusServiceUnavailable, resp)
+		return
+	}
+
+	// A lagging schema means this build would hit missing tables or columns.
+	version, err := h.migrator.Current(ctx)
+	if err != nil || version < h.migrator.Latest() {
+		check := fmt.Sprintf("version %d, want %d", version, h.migrator.Latest())
+		if err != nil {
+			check = "failed"
+		}
+		log.Warn("schema not ready",
+			zap.Error(err),
+			zap.Int64("version", version),
+			zap.Int64("want", h.migrator.Latest()),
+		)
+
+		resp := healthResponse{
+			Status: "unhealthy",
+			Time:   time.Now().Format(time.RFC3339),
+			Checks: map[string]string{"database": "ok", "schema": check},
+		}
+
+		writeJSON(w, http.StatusServiceUnavailable, resp)
 		return
 	}
 
@@ -67,14 +91,13 @@ func (h *HealthHandler) Readiness(w http.ResponseWriter, r *http.Request) {
 		Status:  "ready",
 		Version: "1.0.0",
 		Time:    time.Now().Format(time.RFC3339),
-		Checks:  map[string]string{"database": "ok"},
+		Checks:  map[string]string{"database": "ok", "schema": "ok"},
 	}
 
-	h.logger.Debug("readiness check passed",
+	log.Debug("readiness check passed",
 		zap.String("database", "ok"),
+		zap.Int64("schema_version", version),
 	)
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(resp)
+	writeJSON(w, http.StatusOK, resp)
 }
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/apierror"
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/internal/service"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"go.uber.org/zap"
+)
+
+type InventoryHandler struct {
+	inventoryService service.InventoryService
+	logger           logger.Logger
+}
+
+func NewInventoryHandler(inventoryService service.InventoryService, logger logger.Logger) *InventoryHandler {
+	return &InventoryHandler{
+		inventoryService: inventoryService,
+		logger:           logger.With(zap.String("component", "handler"))}
+}
+
+type setStockRequest struct {
+	OnHand int `json:"on_hand"`
+}
+
+type stockResponse struct {
+	ProductID string    `json:"product_id"`
+	OnHand    int       `json:"on_hand"`
+	Reserved  int       `json:"reserved"`
+	Available int       `json:"available"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func newStockResponse(level *model.StockLevel) stockResponse {
+	return stockResponse{
+		ProductID: level.ProductID,
+		OnHand:    level.OnHand,
+		Reserved:  level.Reserved,
+		Available: level.Available(),
+		UpdatedAt: level.UpdatedAt,
+	}
+}
+
+func (h *InventoryHandler) GetStock(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !isValidUUID(id) {
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidID, "product id must be a valid UUID"))
+		return
+	}
+
+	level, err := h.inventoryService.GetStock(r.Context(), id)
+	if err != nil {
+		writeProblem(w, r, h.logger, "inventory request failed", err, zap.String("product_id", id))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newStockResponse(level))
+}
+
+func (h *InventoryHandler) SetStock(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context(), h.logger)
+
+	id := r.PathValue("id")
+	if !isValidUUID(id) {
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidID, "product id must be a valid UUID"))
+		return
+	}
+
+	var req setStockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Warn("invalid request body",
+			zap.Error(err),
+			zap.String("remote_addr", r.RemoteAddr),
+		)
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidBody, "invalid request body"))
+		return
+	}
+
+	level, err := h.inventoryService.SetStock(r.Context(), id, req.OnHand)
+	if err != nil {
+		writeProblem(w, r, h.logger, "inventory request failed", err, zap.String("product_id", id))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newStockResponse(level))
+}
@@ -1,15 +1,21 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
+	"github.com/Kosench/ecommerce-lab/internal/apierror"
+	"github.com/Kosench/ecommerce-lab/internal/auth"
+	"github.com/Kosench/ecommerce-lab/internal/metrics"
 	"github.com/Kosench/ecommerce-lab/internal/model"
 	"github.com/Kosench/ecommerce-lab/internal/repository"
 	"github.com/Kosench/ecommerce-lab/internal/service"
+	"github.com/Kosench/ecommerce-lab/internal/tax"
+	"github.com/Kosench/ecommerce-lab/internal/validate"
 	"github.com/Kosench/ecommerce-lab/platform/logger"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
@@ -26,21 +32,231 @@ func NewOrderHandler(orderService service.OrderService, logger logger.Logger) *O
 		logger:       logger.With(zap.String("component", "handler"))}
 }
 
+// createOrderRequest.UserID is honoured for service clients only; users
+// always order for themselves.
 type createOrderRequest struct {
-	UserID string       `json:"user_id"`
-	Items  []createItem `json:"items"`
+	UserID          string       `json:"user_id"`
+	Items           []createItem `json:"items"`
+	CouponCodes     []string     `json:"coupon_codes"`
+	TaxJurisdiction string       `json:"tax_jurisdiction"`
 }
 
 type createItem struct {
 	ProductID string `json:"product_id"`
 	Quantity  int    `json:"quantity"`
-	Price     int64  `json:"price"`
 }
 
 type createOrderResponse struct {
-	ID     string `json:"id"`
-	Status string `json:"status"`
-	Total  int64  `json:"total"`
+	ID       string `json:"id"`
+	Status   string `json:"status"`
+	Currency string `json:"currency"`
+	Subtotal int64  `json:"subtotal"`
+	Discount int64  `json:"discount"`
+	Tax      int64  `json:"tax_amount"`
+	Total    int64  `json:"total"`
+}
+
+type orderResponse struct {
+	ID       string              `json:"id"`
+	UserID   string              `json:"user_id"`
+	CartID   string              `json:"cart_id,omitempty"`
+	Status   string              `json:"status"`
+	Currency string              `json:"currency"`
+	Subtotal int64               `json:"subtotal"`
+	Discount int64               `json:"discount"`
+	Tax      int64               `json:"tax_amount"`
+	Total    int64               `json:"total"`
+	Items    []orderItemResponse `json:"items"`
+	// TaxJurisdiction is omitted for untaxed orders.
+	TaxJurisdiction string `json:"tax_jurisdiction,omitempty"`
+	// Coupons and FreeShipping are omitted for orders without coupons.
+	Coupons      []appliedCouponResponse `json:"coupons,omitempty"`
+	FreeShipping bool                    `json:"free_shipping,omitempty"`
+	// RefundedAmount and Refunds are omitted until the first refund.
+	RefundedAmount int64            `json:"refunded_amount,omitempty"`
+	Refunds        []refundResponse `json:"refunds,omitempty"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+}
+
+type refundResponse struct {
+	ID        string               `json:"id"`
+	Amount    int64                `json:"amount"`
+	Reason    string               `json:"reason,omitempty"`
+	Status    string               `json:"status"`
+	Items     []refundItemResponse `json:"items"`
+	CreatedAt time.Time            `json:"created_at"`
+}
+
+type refundItemResponse struct {
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+	Amount    int64  `json:"amount"`
+}
+
+type orderItemResponse struct {
+	ProductID   string                 `json:"product_id"`
+	ProductName string                 `json:"product_name"`
+	Quantity    int                    `json:"quantity"`
+	Price       int64                  `json:"price"`
+	Discount    int64                  `json:"discount"`
+	TaxCategory string                 `json:"tax_category,omitempty"`
+	Tax         int64                  `json:"tax_amount"`
+	Total       int64                  `json:"total"`
+	Discounts   []lineDiscountResponse `json:"discounts,omitempty"`
+}
+
+type lineDiscountResponse struct {
+	Code   string `json:"code"`
+	Amount int64  `json:"amount"`
+}
+
+type appliedCouponResponse struct {
+	Code   string `json:"code"`
+	Type   string `json:"type"`
+	Amount int64  `json:"amount"`
+}
+
+type listOrdersResponse struct {
+	Orders     []orderResponse `json:"orders"`
+	NextCursor string          `json:"next_cursor,omitempty"`
+}
+
+func newOrderResponse(order *model.Order) orderResponse {
+	items := make([]orderItemResponse, len(order.Items))
+	for i, item := range order.Items {
+		items[i] = orderItemResponse{
+			ProductID:   item.ProductID,
+			ProductName: item.ProductName,
+			Quantity:    item.Quantity,
+			Price:       item.Price.Amount(),
+			Discount:    item.Discount().Amount(),
+			TaxCategory: item.TaxCategory,
+			Tax:         item.Tax.Amount(),
+			Total:       item.Total().Amount(),
+		}
+		for _, d := range item.Discounts {
+			items[i].Discounts = append(items[i].Discounts, lineDiscountResponse{Code: d.Code, Amount: d.Amount.Amount()})
+		}
+	}
+
+	var coupons []appliedCouponResponse
+	for _, c := range order.Coupons {
+		coupons = append(coupons, appliedCouponResponse{Code: c.Code, Type: string(c.Type), Amount: c.Amount.Amount()})
+	}
+
+	var refunds []refundResponse
+	for _, refund := range order.Refunds {
+		refundItems := make([]refundItemResponse, len(refund.Items))
+		for i, item := range refund.Items {
+			refundItems[i] = refundItemResponse{
+				ProductID: item.ProductID,
+				Quantity:  item.Quantity,
+				Amount:    item.Amount.Amount(),
+			}
+		}
+		refunds = append(refunds, refundResponse{
+			ID:        refund.ID,
+			Amount:    refund.Amount.Amount(),
+			Reason:    refund.Reason,
+			Status:    string(refund.Status),
+			Items:     refundItems,
+			CreatedAt: refund.CreatedAt,
+		})
+	}
+
+	return orderResponse{
+		ID:              order.ID,
+		UserID:          order.UserID,
+		CartID:          order.CartID,
+		Status:          string(order.Status),
+		Currency:        string(order.Currency),
+		Subtotal:        order.Subtotal.Amount(),
+		Discount:        order.Discount.Amount(),
+		Tax:             order.Tax.Amount(),
+		Total:           order.Total.Amount(),
+		Items:           items,
+		TaxJurisdiction: order.TaxJurisdiction,
+		Coupons:         coupons,
+		FreeShipping:    order.FreeShipping(),
+		RefundedAmount:  order.RefundedAmount().Amount(),
+		Refunds:         refunds,
+		CreatedAt:       order.CreatedAt,
+		UpdatedAt:       order.UpdatedAt,
+	}
+}
+
+// recordValidationFailures counts every rule an order request broke.
+func recordValidationFailures(err error) {
+	var fieldErrs validate.Errors
+	if !errors.As(err, &fieldErrs) {
+		if reason := validationReason(err); reason != "" {
+			metrics.ValidationFailures.WithLabelValues(reason).Inc()
+		}
+		return
+	}
+	for _, fe := range fieldErrs {
+		if reason := validationReason(fe.Err); reason != "" {
+			metrics.ValidationFailures.WithLabelValues(reason).Inc()
+		}
+	}
+}
+
+// validationReason names the rule an order request broke, for the
+// validation failure metric. It returns "" for errors that are not the
+// client's fault.
+func validationReason(err error) string {
+	switch {
+	case errors.Is(err, model.ErrEmptyUserID):
+		return "missing_user_id"
+	case errors.Is(err, model.ErrInvalidUserID):
+		return "invalid_user_id"
+	case errors.Is(err, model.ErrEmptyItems):
+		return "empty_items"
+	case errors.Is(err, model.ErrInvalidProduct):
+		return "invalid_product_id"
+	case errors.Is(err, model.ErrInvalidQuantity):
+		return "invalid_quantity"
+	case errors.Is(err, model.ErrInvalidPrice):
+		return "invalid_price"
+	case errors.Is(err, model.ErrInvalidCurrency):
+		return "invalid_currency"
+	case errors.Is(err, model.ErrMixedCurrencies):
+		return "mixed_currencies"
+	case errors.Is(err, model.ErrTotalTooLarge):
+		return "total_too_large"
+	case errors.Is(err, repository.ErrCouponNotFound):
+		return "unknown_coupon"
+	case errors.Is(err, model.ErrDuplicateCoupon), errors.Is(err, model.ErrCouponInactive),
+		errors.Is(err, model.ErrCouponNotStarted), errors.Is(err, model.ErrCouponExpired),
+		errors.Is(err, model.ErrCouponCurrency), errors.Is(err, model.ErrCouponMinSubtotal),
+		errors.Is(err, model.ErrCouponNotApplicable), errors.Is(err, model.ErrNothingToPay):
+		return "invalid_coupon"
+	case errors.Is(err, model.ErrCouponLimitReached), errors.Is(err, model.ErrCouponUserLimitReached):
+		return "coupon_limit_reached"
+	case errors.Is(err, tax.ErrJurisdictionRequired):
+		return "missing_tax_jurisdiction"
+	case errors.Is(err, tax.ErrUnknownJurisdiction):
+		return "unknown_tax_jurisdiction"
+	case errors.Is(err, repository.ErrProductNotFound):
+		return "unknown_product"
+	case errors.Is(err, model.ErrProductInactive):
+		return "inactive_product"
+	case errors.Is(err, model.ErrInsufficientStock):
+		return "insufficient_stock"
+	case errors.Is(err, service.ErrInvalidRequest):
+		return "invalid_request"
+	}
+	return ""
+}
+
+// callerID returns the user ID of the authenticated caller, or "" for
+// anonymous requests.
+func callerID(ctx context.Context) string {
+	if p, ok := auth.FromContext(ctx); ok {
+		return p.UserID
+	}
+	return ""
 }
 
 func isValidUUID(s string) bool {
@@ -49,120 +265,199 @@ func isValidUUID(s string) bool {
 }
 
 func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context(), h.logger)
+
 	start := time.Now()
 
 	var req createOrderRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.logger.Warn("invalid request body",
+		log.Warn("invalid request body",
 			zap.Error(err),
 			zap.String("remote_addr", r.RemoteAddr),
 		)
-		http.Error(w, `{"error": "invalid request body"}`, http.StatusBadRequest)
+		metrics.ValidationFailures.WithLabelValues("invalid_body").Inc()
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidBody, "invalid request body"))
+		return
+	}
+
+	items := make([]model.OrderItem, len(req.Items))
+	for i, item := range req.Items {
+		items[i] = model.OrderItem{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+		}
+	}
+
+	userID := callerID(r.Context())
+	if p, ok := auth.FromContext(r.Context()); ok && p.IsService() {
+		userID = req.UserID
+	}
+	order, err := h.orderService.CreateOrder(r.Context(), service.CreateOrderParams{
+		UserID:          userID,
+		Items:           items,
+		CouponCodes:     req.CouponCodes,
+		TaxJurisdiction: req.TaxJurisdiction,
+	})
+	if err != nil {
+		recordValidationFailures(err)
+		writeProblem(w, r, h.logger, "failed to create order", err,
+			zap.String("user_id", userID),
+			zap.Int("items_count", len(items)),
+		)
 		return
 	}
 
-	if req.UserID == "" {
-		h.logger.Warn("missing user_id",
+	duration := time.Since(start)
+	log.Info("order created successfully",
+		zap.String("order_id", order.ID),
+		zap.String("user_id", order.UserID),
+		zap.Stringer("total", order.Total),
+		zap.Int("items_count", len(order.Items)),
+		zap.Duration("duration", duration),
+	)
+
+	resp := createOrderResponse{
+		ID:       order.ID,
+		Status:   string(order.Status),
+		Currency: string(order.Currency),
+		Subtotal: order.Subtotal.Amount(),
+		Discount: order.Discount.Amount(),
+		Tax:      order.Tax.Amount(),
+		Total:    order.Total.Amount(),
+	}
+
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+func (h *OrderHandler) GetOrder(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context(), h.logger)
+
+	id := r.PathValue("id")
+	if !isValidUUID(id) {
+		log.Warn("invalid order id format",
+			zap.String("order_id", id),
 			zap.String("remote_addr", r.RemoteAddr),
 		)
-		http.Error(w, `{"error": "user_id is required"}`, http.StatusBadRequest)
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidID, "order id must be a valid UUID"))
+		return
+	}
+
+	order, err := h.orderService.GetOrder(r.Context(), id)
+	if err != nil {
+		writeProblem(w, r, h.logger, "failed to get order", err, zap.String("order_id", id))
 		return
 	}
-	if len(req.Items) == 0 {
-		h.logger.Warn("empty items",
-			zap.String("user_id", req.UserID),
+
+	writeJSON(w, http.StatusOK, newOrderResponse(order))
+}
+
+func (h *OrderHandler) ListOrders(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context(), h.logger)
+
+	userID := r.URL.Query().Get("user_id")
+	if userID != "" && !isValidUUID(userID) {
+		log.Warn("invalid user_id format",
+			zap.String("user_id", userID),
 			zap.String("remote_addr", r.RemoteAddr),
 		)
-		http.Error(w, `{"error": "items are required"}`, http.StatusBadRequest)
+		apierror.WriteError(w, r, &validate.FieldError{Field: "user_id", Err: model.ErrInvalidUserID})
 		return
 	}
 
-	if !isValidUUID(req.UserID) {
-		h.logger.Warn("invalid user_id format",
-			zap.String("user_id", req.UserID),
+	h.listOrders(w, r, userID)
+}
+
+func (h *OrderHandler) ListUserOrders(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context(), h.logger)
+
+	userID := r.PathValue("id")
+	if !isValidUUID(userID) {
+		log.Warn("invalid user id format",
+			zap.String("user_id", userID),
 			zap.String("remote_addr", r.RemoteAddr),
 		)
-		http.Error(w, `{"error": "user_id must be a valid UUID"}`, http.StatusBadRequest)
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidID, "user id must be a valid UUID"))
 		return
 	}
 
-	items := make([]model.OrderItem, len(req.Items))
-	for i, item := range req.Items {
-		if !isValidUUID(item.ProductID) {
-			h.logger.Warn("invalid product_id format",
-				zap.Int("item_index", i),
-				zap.String("product_id", item.ProductID),
-			)
-			http.Error(w, fmt.Sprintf(`{"error": "item[%d].product_id must be a valid UUID"}`, i), http.StatusBadRequest)
-			return
-		}
-		if item.Quantity <= 0 {
-			h.logger.Warn("invalid quantity",
-				zap.Int("item_index", i),
-				zap.Int("quantity", item.Quantity),
-			)
-			http.Error(w, fmt.Sprintf(`{"error": "item[%d].quantity must be positive"}`, i), http.StatusBadRequest)
-			return
-		}
-		if item.Price <= 0 {
-			h.logger.Warn("invalid price",
-				zap.Int("item_index", i),
-				zap.Int64("price", item.Price),
-			)
-			http.Error(w, fmt.Sprintf(`{"error": "item[%d].price must be positive"}`, i), http.StatusBadRequest)
-			return
-		}
+	h.listOrders(w, r, userID)
+}
 
-		items[i] = model.OrderItem{
-			ProductID: item.ProductID,
-			Quantity:  item.Quantity,
-			Price:     item.Price,
-		}
+func (h *OrderHandler) listOrders(w http.ResponseWriter, r *http.Request, userID string) {
+	query := r.URL.Query()
+	params := service.ListOrdersParams{
+		UserID: userID,
+		Status: model.OrderStatus(query.Get("status")),
+		Cursor: query.Get("cursor"),
 	}
 
-	order, err := h.orderService.CreateOrder(r.Context(), req.UserID, items)
-	if err != nil {
-		h.logger.Error("failed to create order",
-			zap.Error(err),
-			zap.String("user_id", req.UserID),
-			zap.Int("items_count", len(items)),
-		)
+	var v validate.Validator
+	if raw := query.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		v.Check(err == nil && limit > 0, "limit", errNotPositive)
+		params.Limit = limit
+	}
 
-		if errors.Is(err, service.ErrInvalidRequest) ||
-			errors.Is(err, model.ErrEmptyUserID) ||
-			errors.Is(err, model.ErrEmptyItems) ||
-			errors.Is(err, model.ErrInvalidProduct) ||
-			errors.Is(err, model.ErrInvalidQuantity) ||
-			errors.Is(err, model.ErrInvalidPrice) {
-			http.Error(w, fmt.Sprintf(`{"error": "%s"}`, err.Error()), http.StatusBadRequest)
-			return
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{
+		{"created_from", &params.CreatedFrom},
+		{"created_to", &params.CreatedTo},
+	} {
+		raw := query.Get(p.name)
+		if raw == "" {
+			continue
 		}
+		t, err := time.Parse(time.RFC3339, raw)
+		v.Check(err == nil, p.name, errNotTimestamp)
+		*p.dst = t
+	}
 
-		if errors.Is(err, repository.ErrOrderNotFound) {
-			http.Error(w, `{"error": "order not found"}`, http.StatusNotFound)
-			return
-		}
+	if err := v.Err(); err != nil {
+		apierror.WriteError(w, r, err)
+		return
+	}
 
-		http.Error(w, `{"error": "internal server error"}`, http.StatusInternalServerError)
+	page, err := h.orderService.ListOrders(r.Context(), params)
+	if err != nil {
+		writeProblem(w, r, h.logger, "failed to list orders", err, zap.String("user_id", userID))
 		return
 	}
 
-	duration := time.Since(start)
-	h.logger.Info("order created successfully",
-		zap.String("order_id", order.ID),
-		zap.String("user_id", order.UserID),
-		zap.Int64("total", order.Total),
-		zap.Int("items_count", len(order.Items)),
-		zap.Duration("duration", duration),
-	)
+	resp := listOrdersResponse{
+		Orders:     make([]orderResponse, len(page.Orders)),
+		NextCursor: page.NextCursor,
+	}
+	for i, order := range page.Orders {
+		resp.Orders[i] = newOrderResponse(order)
+	}
 
-	resp := createOrderResponse{
-		ID:     order.ID,
-		Status: string(order.Status),
-		Total:  order.Total,
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *OrderHandler) CancelOrder(w http.ResponseWriter, r *http.Request) {
+	h.changeStatus(w, r, h.orderService.CancelOrder)
+}
+
+func (h *OrderHandler) changeStatus(w http.ResponseWriter, r *http.Request, change func(ctx context.Context, id string) (*model.Order, error)) {
+	log := logger.WithContext(r.Context(), h.logger)
+
+	id := r.PathValue("id")
+	if !isValidUUID(id) {
+		log.Warn("invalid order id format",
+			zap.String("order_id", id),
+			zap.String("remote_addr", r.RemoteAddr),
+		)
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidID, "order id must be a valid UUID"))
+		return
+	}
+
+	order, err := change(r.Context(), id)
+	if err != nil {
+		writeProblem(w, r, h.logger, "failed to change order status", err, zap.String("order_id", id))
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(resp)
+	writeJSON(w, http.StatusOK, newOrderResponse(order))
 }
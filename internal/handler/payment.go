@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/Kosench/ecommerce-lab/internal/apierror"
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/internal/payments"
+	"github.com/Kosench/ecommerce-lab/internal/service"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"go.uber.org/zap"
+)
+
+// maxWebhookBody bounds the size of a provider webhook request.
+const maxWebhookBody = 1 << 20
+
+type PaymentHandler struct {
+	paymentService service.PaymentService
+	// webhooks holds the verifier of each provider that sends webhooks, by
+	// provider name.
+	webhooks map[string]payments.WebhookVerifier
+	logger   logger.Logger
+}
+
+func NewPaymentHandler(paymentService service.PaymentService, webhooks map[string]payments.WebhookVerifier, logger logger.Logger) *PaymentHandler {
+	return &PaymentHandler{
+		paymentService: paymentService,
+		webhooks:       webhooks,
+		logger:         logger.With(zap.String("component", "handler"))}
+}
+
+type payOrderRequest struct {
+	// PaymentMethod is the provider's token for the card to charge.
+	PaymentMethod string `json:"payment_method"`
+}
+
+func (h *PaymentHandler) PayOrder(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context(), h.logger)
+
+	id := r.PathValue("id")
+	if !isValidUUID(id) {
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidID, "order id must be a valid UUID"))
+		return
+	}
+
+	var req payOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Warn("invalid request body",
+			zap.Error(err),
+			zap.String("remote_addr", r.RemoteAddr),
+		)
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidBody, "invalid request body"))
+		return
+	}
+
+	order, err := h.paymentService.PayOrder(r.Context(), id, req.PaymentMethod)
+	if err != nil {
+		writeProblem(w, r, h.logger, "failed to pay order", err, zap.String("order_id", id))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newOrderResponse(order))
+}
+
+// refundOrderRequest.Items may be left out to refund everything not
+// refunded yet.
+type refundOrderRequest struct {
+	Items  []refundItemRequest `json:"items"`
+	Reason string              `json:"reason"`
+}
+
+type refundItemRequest struct {
+	ProductID string `json:"product_id"`
+	Quantity  int    `json:"quantity"`
+}
+
+func (h *PaymentHandler) RefundOrder(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context(), h.logger)
+
+	id := r.PathValue("id")
+	if !isValidUUID(id) {
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidID, "order id must be a valid UUID"))
+		return
+	}
+
+	// An empty body asks for a full refund.
+	var req refundOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		log.Warn("invalid request body",
+			zap.Error(err),
+			zap.String("remote_addr", r.RemoteAddr),
+		)
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidBody, "invalid request body"))
+		return
+	}
+
+	items := make([]model.RefundItem, len(req.Items))
+	for i, item := range req.Items {
+		items[i] = model.RefundItem{ProductID: item.ProductID, Quantity: item.Quantity}
+	}
+
+	order, err := h.paymentService.RefundOrder(r.Context(), service.RefundOrderParams{
+		OrderID: id,
+		Items:   items,
+		Reason:  req.Reason,
+	})
+	if err != nil {
+		writeProblem(w, r, h.logger, "failed to refund order", err, zap.String("order_id", id))
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newOrderResponse(order))
+}
+
+// HandleWebhook receives payment events from a provider. Anything but a 2xx
+// makes the provider deliver the event again.
+func (h *PaymentHandler) HandleWebhook(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context(), h.logger)
+
+	provider := r.PathValue("provider")
+	verifier, ok := h.webhooks[provider]
+	if !ok {
+		apierror.Write(w, r, apierror.New(http.StatusNotFound, "unknown_payment_provider", "no webhooks are accepted from this provider"))
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBody))
+	if err != nil {
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidBody, "invalid request body"))
+		return
+	}
+
+	event, err := verifier.VerifyWebhook(r.Header, body)
+	if err != nil {
+		log.Warn("rejected payment webhook",
+			zap.Error(err),
+			zap.String("provider", provider),
+			zap.String("remote_addr", r.RemoteAddr),
+		)
+		apierror.Write(w, r, apierror.FromError(err))
+		return
+	}
+
+	if err := h.paymentService.HandleEvent(r.Context(), provider, event, body); err != nil {
+		writeProblem(w, r, h.logger, "failed to handle payment webhook", err,
+			zap.String("provider", provider),
+			zap.String("event_id", event.ID),
+		)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
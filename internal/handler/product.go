@@ -0,0 +1,213 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/apierror"
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/internal/money"
+	"github.com/Kosench/ecommerce-lab/internal/service"
+	"github.com/Kosench/ecommerce-lab/internal/validate"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"go.uber.org/zap"
+)
+
+type ProductHandler struct {
+	productService service.ProductService
+	logger         logger.Logger
+}
+
+func NewProductHandler(productService service.ProductService, logger logger.Logger) *ProductHandler {
+	return &ProductHandler{
+		productService: productService,
+		logger:         logger.With(zap.String("component", "handler"))}
+}
+
+type createProductRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Price       int64  `json:"price"`
+	Currency    string `json:"currency"`
+	TaxCategory string `json:"tax_category"`
+}
+
+type updateProductRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	Price       *int64  `json:"price"`
+	Currency    *string `json:"currency"`
+	TaxCategory *string `json:"tax_category"`
+	Active      *bool   `json:"active"`
+}
+
+type productResponse struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Price       int64     `json:"price"`
+	Currency    string    `json:"currency"`
+	TaxCategory string    `json:"tax_category"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type listProductsResponse struct {
+	Products []productResponse `json:"products"`
+}
+
+func newProductResponse(p *model.Product) productResponse {
+	return productResponse{
+		ID:          p.ID,
+		Name:        p.Name,
+		Description: p.Description,
+		Price:       p.Price.Amount(),
+		Currency:    string(p.Price.Currency()),
+		TaxCategory: p.TaxCategory,
+		Active:      p.Active,
+		CreatedAt:   p.CreatedAt,
+		UpdatedAt:   p.UpdatedAt,
+	}
+}
+
+func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context(), h.logger)
+
+	var req createProductRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Warn("invalid request body",
+			zap.Error(err),
+			zap.String("remote_addr", r.RemoteAddr),
+		)
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidBody, "invalid request body"))
+		return
+	}
+
+	currency := model.DefaultCurrency
+	if req.Currency != "" {
+		currency = money.Currency(req.Currency)
+	}
+
+	product, err := h.productService.CreateProduct(r.Context(), req.Name, req.Description, money.New(req.Price, currency), req.TaxCategory)
+	if err != nil {
+		writeProblem(w, r, h.logger, "product request failed", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newProductResponse(product))
+}
+
+func (h *ProductHandler) GetProduct(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !isValidUUID(id) {
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidID, "product id must be a valid UUID"))
+		return
+	}
+
+	product, err := h.productService.GetProduct(r.Context(), id)
+	if err != nil {
+		writeProblem(w, r, h.logger, "product request failed", err, zap.String("product_id", id))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newProductResponse(product))
+}
+
+func (h *ProductHandler) ListProducts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	params := service.ListProductsParams{
+		ActiveOnly: query.Get("active") == "true",
+	}
+
+	var v validate.Validator
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{
+		{"limit", &params.Limit},
+		{"offset", &params.Offset},
+	} {
+		raw := query.Get(p.name)
+		if raw == "" {
+			continue
+		}
+		n, err := strconv.Atoi(raw)
+		v.Check(err == nil && n >= 0, p.name, errNegative)
+		*p.dst = n
+	}
+	if err := v.Err(); err != nil {
+		apierror.WriteError(w, r, err)
+		return
+	}
+
+	products, err := h.productService.ListProducts(r.Context(), params)
+	if err != nil {
+		writeProblem(w, r, h.logger, "product request failed", err)
+		return
+	}
+
+	resp := listProductsResponse{Products: make([]productResponse, len(products))}
+	for i, p := range products {
+		resp.Products[i] = newProductResponse(p)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context(), h.logger)
+
+	id := r.PathValue("id")
+	if !isValidUUID(id) {
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidID, "product id must be a valid UUID"))
+		return
+	}
+
+	var req updateProductRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Warn("invalid request body",
+			zap.Error(err),
+			zap.String("remote_addr", r.RemoteAddr),
+		)
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidBody, "invalid request body"))
+		return
+	}
+
+	update := service.ProductUpdate{
+		Name:        req.Name,
+		Description: req.Description,
+		Price:       req.Price,
+		TaxCategory: req.TaxCategory,
+		Active:      req.Active,
+	}
+	if req.Currency != nil {
+		currency := money.Currency(*req.Currency)
+		update.Currency = &currency
+	}
+
+	product, err := h.productService.UpdateProduct(r.Context(), id, update)
+	if err != nil {
+		writeProblem(w, r, h.logger, "product request failed", err, zap.String("product_id", id))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newProductResponse(product))
+}
+
+func (h *ProductHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !isValidUUID(id) {
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidID, "product id must be a valid UUID"))
+		return
+	}
+
+	if err := h.productService.DeleteProduct(r.Context(), id); err != nil {
+		writeProblem(w, r, h.logger, "product request failed", err, zap.String("product_id", id))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
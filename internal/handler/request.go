@@ -0,0 +1,11 @@
+package handler
+
+import "errors"
+
+// Request parameter validation errors, reported against the parameter name.
+var (
+	errNotUUID      = errors.New("must be a valid UUID")
+	errNotPositive  = errors.New("must be a positive integer")
+	errNegative     = errors.New("must be a non-negative integer")
+	errNotTimestamp = errors.New("must be an RFC 3339 timestamp")
+)
@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Kosench/ecommerce-lab/internal/apierror"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"go.uber.org/zap"
+)
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeProblem writes err as a problem document. Only server errors are
+// logged, as msg on log scoped to the request; anything else is the
+// client's to fix.
+func writeProblem(w http.ResponseWriter, r *http.Request, log logger.Logger, msg string, err error, fields ...zap.Field) {
+	p := apierror.FromError(err)
+	if p.Status >= http.StatusInternalServerError {
+		logger.WithContext(r.Context(), log).Error(msg, append([]zap.Field{zap.Error(err)}, fields...)...)
+	}
+	apierror.Write(w, r, p)
+}
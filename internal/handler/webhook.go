@@ -0,0 +1,220 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/apierror"
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/internal/service"
+	"github.com/Kosench/ecommerce-lab/internal/validate"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"go.uber.org/zap"
+)
+
+type WebhookHandler struct {
+	webhookService service.WebhookService
+	logger         logger.Logger
+}
+
+func NewWebhookHandler(webhookService service.WebhookService, logger logger.Logger) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: webhookService,
+		logger:         logger.With(zap.String("component", "handler"))}
+}
+
+type createSubscriptionRequest struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+}
+
+type subscriptionResponse struct {
+	ID         string    `json:"id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Secret     string    `json:"secret,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type listSubscriptionsResponse struct {
+	Subscriptions []subscriptionResponse `json:"subscriptions"`
+}
+
+type deliveryResponse struct {
+	ID            string            `json:"id"`
+	EventID       int64             `json:"event_id"`
+	EventType     string            `json:"event_type"`
+	Status        string            `json:"status"`
+	Attempts      []attemptResponse `json:"attempts"`
+	NextAttemptAt *time.Time        `json:"next_attempt_at,omitempty"`
+	CreatedAt     time.Time         `json:"created_at"`
+}
+
+type attemptResponse struct {
+	Attempt     int       `json:"attempt"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMs  int64     `json:"duration_ms"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+type listDeliveriesResponse struct {
+	Deliveries []deliveryResponse `json:"deliveries"`
+}
+
+// newSubscriptionResponse includes the secret only when withSecret is set:
+// it is shown once, on creation and rotation.
+func newSubscriptionResponse(sub *model.WebhookSubscription, withSecret bool) subscriptionResponse {
+	resp := subscriptionResponse{
+		ID:         sub.ID,
+		URL:        sub.URL,
+		EventTypes: sub.EventTypes,
+		CreatedAt:  sub.CreatedAt,
+		UpdatedAt:  sub.UpdatedAt,
+	}
+	if withSecret {
+		resp.Secret = sub.Secret
+	}
+	return resp
+}
+
+func newDeliveryResponse(d *model.WebhookDelivery) deliveryResponse {
+	resp := deliveryResponse{
+		ID:        d.ID,
+		EventID:   d.EventID,
+		EventType: d.EventType,
+		Status:    string(d.Status),
+		Attempts:  make([]attemptResponse, len(d.AttemptLog)),
+		CreatedAt: d.CreatedAt,
+	}
+	if d.Status == model.DeliveryPending {
+		next := d.NextAttemptAt
+		resp.NextAttemptAt = &next
+	}
+	for i, a := range d.AttemptLog {
+		resp.Attempts[i] = attemptResponse{
+			Attempt:     a.Attempt,
+			StatusCode:  a.StatusCode,
+			Error:       a.Error,
+			DurationMs:  a.Duration.Milliseconds(),
+			AttemptedAt: a.AttemptedAt,
+		}
+	}
+	return resp
+}
+
+func (h *WebhookHandler) CreateSubscription(w http.ResponseWriter, r *http.Request) {
+	log := logger.WithContext(r.Context(), h.logger)
+
+	var req createSubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Warn("invalid request body",
+			zap.Error(err),
+			zap.String("remote_addr", r.RemoteAddr),
+		)
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidBody, "invalid request body"))
+		return
+	}
+
+	sub, err := h.webhookService.CreateSubscription(r.Context(), req.URL, req.EventTypes)
+	if err != nil {
+		writeProblem(w, r, h.logger, "webhook request failed", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, newSubscriptionResponse(sub, true))
+}
+
+func (h *WebhookHandler) ListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subs, err := h.webhookService.ListSubscriptions(r.Context())
+	if err != nil {
+		writeProblem(w, r, h.logger, "webhook request failed", err)
+		return
+	}
+
+	resp := listSubscriptionsResponse{Subscriptions: make([]subscriptionResponse, len(subs))}
+	for i, sub := range subs {
+		resp.Subscriptions[i] = newSubscriptionResponse(sub, false)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func (h *WebhookHandler) GetSubscription(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !isValidUUID(id) {
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidID, "subscription id must be a valid UUID"))
+		return
+	}
+
+	sub, err := h.webhookService.GetSubscription(r.Context(), id)
+	if err != nil {
+		writeProblem(w, r, h.logger, "webhook request failed", err, zap.String("subscription_id", id))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newSubscriptionResponse(sub, false))
+}
+
+func (h *WebhookHandler) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !isValidUUID(id) {
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidID, "subscription id must be a valid UUID"))
+		return
+	}
+
+	if err := h.webhookService.DeleteSubscription(r.Context(), id); err != nil {
+		writeProblem(w, r, h.logger, "webhook request failed", err, zap.String("subscription_id", id))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *WebhookHandler) RotateSecret(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !isValidUUID(id) {
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidID, "subscription id must be a valid UUID"))
+		return
+	}
+
+	sub, err := h.webhookService.RotateSecret(r.Context(), id)
+	if err != nil {
+		writeProblem(w, r, h.logger, "webhook request failed", err, zap.String("subscription_id", id))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, newSubscriptionResponse(sub, true))
+}
+
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if !isValidUUID(id) {
+		apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidID, "subscription id must be a valid UUID"))
+		return
+	}
+
+	var limit int
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			apierror.WriteError(w, r, &validate.FieldError{Field: "limit", Err: errNotPositive})
+			return
+		}
+		limit = n
+	}
+
+	deliveries, err := h.webhookService.ListDeliveries(r.Context(), id, limit)
+	if err != nil {
+		writeProblem(w, r, h.logger, "webhook request failed", err, zap.String("subscription_id", id))
+		return
+	}
+
+	resp := listDeliveriesResponse{Deliveries: make([]deliveryResponse, len(deliveries))}
+	for i, d := range deliveries {
+		resp.Deliveries[i] = newDeliveryResponse(d)
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "ecommerce"
+
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests by method, route pattern and status class.",
+	}, []string{"method", "route", "status_class"})
+
+	HTTPErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "errors_total",
+		Help:      "HTTP requests answered with a 4xx or 5xx status.",
+	}, []string{"method", "route", "status_class"})
+
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by method, route pattern and status class.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status_class"})
+
+	OrdersCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "orders",
+		Name:      "created_total",
+		Help:      "Orders successfully created.",
+	})
+
+	OrderValue = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "orders",
+		Name:      "value_total",
+		Help:      "Sum of created order totals, in minor currency units.",
+	}, []string{"currency"})
+
+	ValidationFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "orders",
+		Name:      "validation_failures_total",
+		Help:      "Rejected order requests by reason.",
+	}, []string{"reason"})
+)
+
+// Handler serves the default registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// StatusClass buckets an HTTP status code into "2xx", "4xx" and so on.
+func StatusClass(code int) string {
+	switch {
+	case code >= 500:
+		return "5xx"
+	case code >= 400:
+		return "4xx"
+	case code >= 300:
+		return "3xx"
+	case code >= 200:
+		return "2xx"
+	}
+	return "1xx"
+}
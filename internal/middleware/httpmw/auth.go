@@ -0,0 +1,123 @@
+package httpmw
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Kosench/ecommerce-lab/internal/apierror"
+	"github.com/Kosench/ecommerce-lab/internal/auth"
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/internal/repository"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"go.uber.org/zap"
+)
+
+// APIKeyHeader carries the API key of a service client.
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyAuthenticator resolves an API key to the principal it stands for.
+type APIKeyAuthenticator interface {
+	Authenticate(ctx context.Context, key string) (*auth.Principal, error)
+}
+
+// Authenticate identifies the caller by API key or bearer token, if the
+// request carries either, and stores the principal in the context. Requests
+// without credentials pass through anonymously; routes that need a caller
+// wrap their handler in RequireAuth or RequireScope. Credentials that fail
+// verification are always rejected.
+func Authenticate(next http.Handler, verifier *auth.Verifier, keys APIKeyAuthenticator, log logger.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			principal *auth.Principal
+			err       error
+		)
+		switch {
+		case r.Header.Get(APIKeyHeader) != "":
+			principal, err = keys.Authenticate(r.Context(), r.Header.Get(APIKeyHeader))
+			if err != nil {
+				if !isInvalidAPIKey(err) {
+					logger.WithContext(r.Context(), log).Error("failed to authenticate api key",
+						zap.Error(err),
+					)
+					apierror.Write(w, r, apierror.Internal())
+					return
+				}
+				logger.WithContext(r.Context(), log).Warn("invalid api key",
+					zap.Error(err),
+					zap.String("remote_addr", r.RemoteAddr),
+				)
+				unauthorized(w, r, "invalid API key")
+				return
+			}
+		case r.Header.Get("Authorization") != "":
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok {
+				unauthorized(w, r, "Authorization header must use the Bearer scheme")
+				return
+			}
+			principal, err = verifier.Verify(strings.TrimSpace(token))
+			if err != nil {
+				logger.WithContext(r.Context(), log).Warn("invalid bearer token",
+					zap.Error(err),
+					zap.String("remote_addr", r.RemoteAddr),
+				)
+				unauthorized(w, r, "invalid bearer token")
+				return
+			}
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := auth.NewContext(r.Context(), principal)
+		if principal.IsService() {
+			ctx = logger.NewContext(ctx, log, zap.String("api_key_id", principal.APIKeyID))
+		} else {
+			ctx = logger.NewContext(ctx, log, zap.String("user_id", principal.UserID))
+		}
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func isInvalidAPIKey(err error) bool {
+	return errors.Is(err, repository.ErrAPIKeyNotFound) ||
+		errors.Is(err, model.ErrAPIKeyRevoked) ||
+		errors.Is(err, model.ErrAPIKeyExpired)
+}
+
+// RequireAuth rejects anonymous requests with 401.
+func RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := auth.FromContext(r.Context()); !ok {
+			unauthorized(w, r, "authentication is required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireScope rejects anonymous requests with 401 and callers lacking scope
+// with 403.
+func RequireScope(scope string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, ok := auth.FromContext(r.Context())
+		if !ok {
+			unauthorized(w, r, "authentication is required")
+			return
+		}
+		if !p.HasScope(scope) {
+			apierror.Write(w, r, apierror.New(http.StatusForbidden, apierror.CodeForbidden, "missing scope "+scope).
+				With("required_scope", scope))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func unauthorized(w http.ResponseWriter, r *http.Request, detail string) {
+	w.Header().Set("WWW-Authenticate", `Bearer`)
+	apierror.Write(w, r, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthenticated, detail))
+}
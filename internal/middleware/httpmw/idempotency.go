@@ -0,0 +1,171 @@
+package httpmw
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/apierror"
+	"github.com/Kosench/ecommerce-lab/internal/auth"
+	"github.com/Kosench/ecommerce-lab/internal/repository"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotencyReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+	maxIdempotentBodySize   = 1 << 20
+)
+
+// Idempotency makes a handler safe to retry. The first request with a given
+// Idempotency-Key runs the handler and stores its response for ttl; later
+// requests from the same caller with the same key and payload get that
+// response replayed. A key stays in progress for at most lease, so a request
+// that died mid-flight does not block retries until ttl. Requests without
+// the header pass through unchanged.
+func Idempotency(next http.Handler, store repository.IdempotencyRepository, ttl, lease time.Duration, log logger.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := logger.WithContext(r.Context(), log)
+
+		key := r.Header.Get(IdempotencyKeyHeader)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			apierror.Write(w, r, apierror.New(http.StatusBadRequest, "invalid_idempotency_key", "Idempotency-Key is too long"))
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBodySize+1))
+		if err != nil || len(body) > maxIdempotentBodySize {
+			apierror.Write(w, r, apierror.New(http.StatusBadRequest, apierror.CodeInvalidBody, "invalid request body"))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		scope := idempotencyScope(r)
+		fingerprint := requestFingerprint(r, body)
+
+		rec, acquired, err := store.Acquire(r.Context(), scope, key, fingerprint, lease)
+		if err != nil {
+			logger.Error("failed to acquire idempotency key",
+				zap.Error(err),
+				zap.String("idempotency_key", key),
+			)
+			apierror.Write(w, r, apierror.Internal())
+			return
+		}
+
+		if !acquired {
+			switch {
+			case rec.Fingerprint != fingerprint:
+				logger.Warn("idempotency key reused with different payload",
+					zap.String("idempotency_key", key),
+				)
+				apierror.Write(w, r, apierror.New(http.StatusUnprocessableEntity, "idempotency_key_reused", "Idempotency-Key was already used with a different request"))
+			case rec.Status == repository.IdempotencyInProgress:
+				apierror.Write(w, r, apierror.New(http.StatusConflict, "idempotency_key_in_progress", "a request with this Idempotency-Key is still in progress"))
+			default:
+				logger.Info("replaying idempotent response",
+					zap.String("idempotency_key", key),
+					zap.Int("status", rec.ResponseStatus),
+				)
+				if rec.ResponseContentType != "" {
+					w.Header().Set("Content-Type", rec.ResponseContentType)
+				}
+				w.Header().Set(IdempotencyReplayedHeader, "true")
+				w.WriteHeader(rec.ResponseStatus)
+				w.Write(rec.ResponseBody)
+			}
+			return
+		}
+
+		// The outcome must be stored even if the client has gone away,
+		// otherwise its retry would see the key stuck in progress.
+		ctx := context.WithoutCancel(r.Context())
+
+		defer func() {
+			if rec := recover(); rec != nil {
+				store.Release(ctx, scope, key)
+				panic(rec)
+			}
+		}()
+
+		rw := &recordingWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		next.ServeHTTP(rw, r)
+
+		if rw.statusCode >= 500 {
+			if err := store.Release(ctx, scope, key); err != nil {
+				logger.Error("failed to release idempotency key",
+					zap.Error(err),
+					zap.String("idempotency_key", key),
+				)
+			}
+			return
+		}
+
+		if err := store.Complete(ctx, scope, key, rw.statusCode, rw.Header().Get("Content-Type"), rw.body.Bytes(), ttl); err != nil {
+			logger.Error("failed to store idempotent response",
+				zap.Error(err),
+				zap.String("idempotency_key", key),
+			)
+		}
+	})
+}
+
+// idempotencyScope namespaces keys by caller: a user, or a service client by
+// its API key. Callers cannot collide on, or replay, each other's keys.
+func idempotencyScope(r *http.Request) string {
+	p, ok := auth.FromContext(r.Context())
+	switch {
+	case !ok:
+		return "anonymous"
+	case p.IsService():
+		return "api_key:" + p.APIKeyID
+	}
+	return "user:" + p.UserID
+}
+
+// requestFingerprint identifies the request a key was first used for.
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method)
+	h.Write([]byte{0})
+	io.WriteString(h, r.URL.Path)
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recordingWriter keeps a copy of the response so it can be replayed.
+type recordingWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+	written    bool
+}
+
+func (rw *recordingWriter) WriteHeader(code int) {
+	if !rw.written {
+		rw.statusCode = code
+		rw.written = true
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recordingWriter) Write(b []byte) (int, error) {
+	if !rw.written {
+		rw.statusCode = http.StatusOK
+		rw.written = true
+	}
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
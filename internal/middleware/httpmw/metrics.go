@@ -0,0 +1,57 @@
+package httpmw
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/metrics"
+)
+
+// Metrics records RED metrics per route. Routes are labelled by the mux
+// pattern rather than the raw path to keep cardinality bounded. The pattern
+// is resolved against mux up front, since middleware between here and the
+// mux may hand it a copy of the request.
+func Metrics(next http.Handler, mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		_, pattern := mux.Handler(r)
+		route := routeFromPattern(pattern)
+		ww := &responseWriter{
+			ResponseWriter: w,
+			statusCode:     http.StatusOK,
+		}
+
+		defer func() {
+			status := ww.statusCode
+			rec := recover()
+			if rec != nil {
+				status = http.StatusInternalServerError
+			}
+
+			labels := []string{r.Method, route, metrics.StatusClass(status)}
+			metrics.HTTPRequests.WithLabelValues(labels...).Inc()
+			metrics.HTTPDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+			if status >= 400 {
+				metrics.HTTPErrors.WithLabelValues(labels...).Inc()
+			}
+
+			if rec != nil {
+				panic(rec)
+			}
+		}()
+
+		next.ServeHTTP(ww, r)
+	})
+}
+
+func routeFromPattern(pattern string) string {
+	if pattern == "" {
+		return "unmatched"
+	}
+	// Patterns may carry a method ("GET /orders/{id}"); it is a label of its own.
+	if _, path, ok := strings.Cut(pattern, " "); ok {
+		return path
+	}
+	return pattern
+}
@@ -0,0 +1,76 @@
+package httpmw_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Kosench/ecommerce-lab/internal/auth"
+	"github.com/Kosench/ecommerce-lab/internal/metrics"
+	"github.com/Kosench/ecommerce-lab/internal/middleware/httpmw"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+type staticKeys struct {
+	principal *auth.Principal
+}
+
+func (k staticKeys) Authenticate(context.Context, string) (*auth.Principal, error) {
+	return k.principal, nil
+}
+
+// TestAuthenticatedRouteIsLabelled checks that metrics and spans carry the
+// route of a request that Authenticate hands on as a copy.
+func TestAuthenticatedRouteIsLabelled(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+
+	log := logger.NewNop()
+	mux := http.NewServeMux()
+	mux.Handle("GET /test/orders/{id}", httpmw.RequireScope(auth.ScopeOrdersRead, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})))
+	keys := staticKeys{principal: &auth.Principal{APIKeyID: "key-1", Scopes: []string{auth.ScopeOrdersRead}}}
+	h := httpmw.Tracing(httpmw.Metrics(httpmw.Authenticate(mux, nil, keys, log), mux), mux, log)
+
+	const route = "/test/orders/{id}"
+	requests := metrics.HTTPRequests.WithLabelValues(http.MethodGet, route, "2xx")
+	before := testutil.ToFloat64(requests)
+
+	req := httptest.NewRequest(http.MethodGet, "/test/orders/42", nil)
+	req.Header.Set(httpmw.APIKeyHeader, "secret")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusNoContent)
+	}
+	if got := testutil.ToFloat64(requests) - before; got != 1 {
+		t.Errorf("requests labelled route=%q grew by %v, want 1", route, got)
+	}
+
+	ended := spans.Ended()
+	if len(ended) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(ended))
+	}
+	if got, want := ended[0].Name(), "GET "+route; got != want {
+		t.Errorf("span name = %q, want %q", got, want)
+	}
+	var gotRoute string
+	for _, attr := range ended[0].Attributes() {
+		if attr.Key == semconv.HTTPRouteKey {
+			gotRoute = attr.Value.AsString()
+		}
+	}
+	if gotRoute != route {
+		t.Errorf("span %s = %q, want %q", semconv.HTTPRouteKey, gotRoute, route)
+	}
+}
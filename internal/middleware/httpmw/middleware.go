@@ -4,18 +4,19 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/Kosench/ecommerce-lab/internal/apierror"
 	"github.com/Kosench/ecommerce-lab/platform/logger"
 	"go.uber.org/zap"
 )
 
-func Logging(next http.Handler, logger logger.Logger) http.Handler {
+func Logging(next http.Handler, log logger.Logger) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
+		logger := logger.WithContext(r.Context(), log)
 
 		// Логируем начало запроса (только для долгих операций в продакшене)
 		// В разработке логируем все
 		logger.Debug("request started",
-			zap.String("method", r.Method),
 			zap.String("path", r.URL.Path),
 			zap.String("remote_addr", r.RemoteAddr),
 		)
@@ -34,7 +35,6 @@ func Logging(next http.Handler, logger logger.Logger) http.Handler {
 		// Логируем завершение запроса
 		// 5xx — error, 4xx — warn, остальное — info
 		logFields := []zap.Field{
-			zap.String("method", r.Method),
 			zap.String("path", r.URL.Path),
 			zap.Int("status", ww.statusCode),
 			zap.Duration("duration", duration),
@@ -59,19 +59,18 @@ func Logging(next http.Handler, logger logger.Logger) http.Handler {
 }
 
 // PanicRecoveryMiddleware ловит паники и возвращает 500
-func Recovery(next http.Handler, logger logger.Logger) http.Handler {
+func Recovery(next http.Handler, log logger.Logger) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		defer func() {
 			if rec := recover(); rec != nil {
-				logger.Error("request panicked",
-					zap.String("method", r.Method),
+				logger.WithContext(r.Context(), log).Error("request panicked",
 					zap.String("path", r.URL.Path),
 					zap.String("remote_addr", r.RemoteAddr),
 					zap.Any("recovered", rec),
 					zap.Stack("stack"),
 				)
 
-				http.Error(w, `{"error": "internal server error"}`, http.StatusInternalServerError)
+				apierror.Write(w, r, apierror.Internal())
 			}
 		}()
 
@@ -0,0 +1,34 @@
+package httpmw
+
+import (
+	"net/http"
+
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"github.com/Kosench/ecommerce-lab/platform/requestid"
+	"go.uber.org/zap"
+)
+
+// RequestID accepts the caller's X-Request-ID or generates one, echoes it in
+// the response and stores a request-scoped logger carrying request_id, method
+// and route in the context. The route is resolved against mux up front so it
+// is present on every log line, not only on those written after routing.
+func RequestID(next http.Handler, mux *http.ServeMux, log logger.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+		w.Header().Set(requestid.Header, id)
+
+		_, pattern := mux.Handler(r)
+
+		ctx := requestid.NewContext(r.Context(), id)
+		ctx = logger.NewContext(ctx, log,
+			zap.String("request_id", id),
+			zap.String("method", r.Method),
+			zap.String("route", routeFromPattern(pattern)),
+		)
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,67 @@
+package httpmw
+
+import (
+	"net/http"
+
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"github.com/Kosench/ecommerce-lab/platform/requestid"
+	"github.com/Kosench/ecommerce-lab/platform/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+const tracerName = "github.com/Kosench/ecommerce-lab/internal/middleware/httpmw"
+
+// Tracing opens a server span per request, continuing the trace from an
+// incoming traceparent header, and puts trace_id and span_id on the
+// request-scoped logger. Spans are named after the route mux resolves.
+func Tracing(next http.Handler, mux *http.ServeMux, log logger.Logger) http.Handler {
+	tracer := tracing.Tracer(tracerName)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				semconv.URLPath(r.URL.Path),
+				semconv.UserAgentOriginal(r.UserAgent()),
+				semconv.ClientAddress(r.RemoteAddr),
+			),
+		)
+		defer span.End()
+
+		if _, pattern := mux.Handler(r); pattern != "" {
+			route := routeFromPattern(pattern)
+			span.SetName(r.Method + " " + route)
+			span.SetAttributes(semconv.HTTPRoute(route))
+		}
+
+		if id := requestid.FromContext(ctx); id != "" {
+			span.SetAttributes(attribute.String("http.request_id", id))
+		}
+
+		if sc := span.SpanContext(); sc.IsValid() {
+			ctx = logger.NewContext(ctx, log,
+				zap.String("trace_id", sc.TraceID().String()),
+				zap.String("span_id", sc.SpanID().String()),
+			)
+		}
+
+		ww := &responseWriter{
+			ResponseWriter: w,
+			statusCode:     http.StatusOK,
+		}
+		next.ServeHTTP(ww, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPResponseStatusCode(ww.statusCode))
+		if ww.statusCode >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(ww.statusCode))
+		}
+	})
+}
@@ -0,0 +1,114 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/money"
+	"github.com/Kosench/ecommerce-lab/internal/validate"
+	"github.com/google/uuid"
+)
+
+type CartStatus string
+
+const (
+	CartOpen       CartStatus = "open"
+	CartCheckedOut CartStatus = "checked_out"
+	CartMerged     CartStatus = "merged"
+)
+
+// Cart is a shopping cart. Anonymous carts have no UserID; they can be
+// merged into a user's cart but not checked out.
+type Cart struct {
+	ID        string
+	UserID    string
+	Status    CartStatus
+	Items     []CartItem
+	OrderID   string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// CartItem is a cart line. Name and price are looked up in the catalog when
+// the cart is read; Available is false for products that were deactivated
+// or deleted since, and such lines do not count towards the total.
+type CartItem struct {
+	ProductID   string
+	ProductName string
+	Quantity    int
+	Price       money.Money
+	Available   bool
+}
+
+func (i CartItem) LineTotal() (money.Money, error) {
+	return i.Price.Mul(int64(i.Quantity))
+}
+
+var (
+	ErrCartNotOpen      = errors.New("cart is no longer open")
+	ErrCartChanged      = errors.New("cart changed during checkout")
+	ErrEmptyCart        = errors.New("cart is empty")
+	ErrCartAnonymous    = errors.New("cart does not belong to a user")
+	ErrCartNotAnonymous = errors.New("only anonymous carts can be merged into another cart")
+	ErrMergeSameCart    = errors.New("must differ from the target cart")
+)
+
+func NewCart(userID string) (*Cart, error) {
+	var v validate.Validator
+	v.Check(userID == "" || isUUID(userID), "user_id", ErrInvalidUserID)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &Cart{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Status:    CartOpen,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, nil
+}
+
+// Currency is the currency of the cart's available lines, or "" if it has
+// none.
+func (c *Cart) Currency() money.Currency {
+	for _, item := range c.Items {
+		if item.Available {
+			return item.Price.Currency()
+		}
+	}
+	return ""
+}
+
+// Total fails if the available lines are in different currencies, which
+// can happen when a product's currency changes after it was added.
+func (c *Cart) Total() (money.Money, error) {
+	total := money.Zero(c.Currency())
+	for _, item := range c.Items {
+		if !item.Available {
+			continue
+		}
+		line, err := item.LineTotal()
+		if err != nil {
+			return money.Money{}, err
+		}
+		if total, err = total.Add(line); err != nil {
+			return money.Money{}, err
+		}
+	}
+	return total, nil
+}
+
+// OrderItems turns the cart lines into order items for checkout. Prices are
+// left to order pricing, which also rejects unavailable products.
+func (c *Cart) OrderItems() []OrderItem {
+	items := make([]OrderItem, 0, len(c.Items))
+	for _, item := range c.Items {
+		items = append(items, OrderItem{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+		})
+	}
+	return items
+}
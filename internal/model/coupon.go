@@ -0,0 +1,298 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/money"
+	"github.com/Kosench/ecommerce-lab/internal/validate"
+	"github.com/google/uuid"
+)
+
+type CouponType string
+
+const (
+	CouponPercent      CouponType = "percent"
+	CouponFixed        CouponType = "fixed"
+	CouponBuyXGetY     CouponType = "buy_x_get_y"
+	CouponFreeShipping CouponType = "free_shipping"
+)
+
+func (t CouponType) IsValid() bool {
+	switch t {
+	case CouponPercent, CouponFixed, CouponBuyXGetY, CouponFreeShipping:
+		return true
+	}
+	return false
+}
+
+// Coupon is a discount code. Its rules decide whether it applies to an
+// order; its type decides what it takes off.
+type Coupon struct {
+	ID string
+	// Code is what customers enter, upper case.
+	Code string
+	Type CouponType
+	// PercentOff is the discount of a percent coupon, 1 to 100.
+	PercentOff int
+	// AmountOff is the discount of a fixed coupon. It is spread over the
+	// eligible lines in proportion to their amounts.
+	AmountOff money.Money
+	// A buy_x_get_y coupon makes GetQuantity units of an eligible line free
+	// for every BuyQuantity units paid for.
+	BuyQuantity int
+	GetQuantity int
+	// MinSubtotal, if positive, is the subtotal an order needs before
+	// discounts.
+	MinSubtotal money.Money
+	// ProductIDs are the products the coupon applies to; empty means all.
+	ProductIDs []string
+	// MaxRedemptions and MaxRedemptionsPerUser cap the orders the coupon
+	// can be used on; zero means no limit. Cancelled orders do not count.
+	MaxRedemptions        int
+	MaxRedemptionsPerUser int
+	StartsAt              *time.Time
+	EndsAt                *time.Time
+	Active                bool
+	CreatedAt             time.Time
+	UpdatedAt             time.Time
+}
+
+// AppliedCoupon is a coupon used on an order and what it took off.
+type AppliedCoupon struct {
+	CouponID string
+	Code     string
+	Type     CouponType
+	// Amount is zero for free shipping.
+	Amount money.Money
+}
+
+var couponCodePattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9_-]{2,31}$`)
+
+var (
+	ErrInvalidCouponCode  = errors.New("must be 3 to 32 letters, digits, '-' or '_'")
+	ErrUnknownCouponType  = errors.New("must be one of percent, fixed, buy_x_get_y, free_shipping")
+	ErrInvalidPercentOff  = errors.New("must be between 1 and 100")
+	ErrInvalidAmountOff   = errors.New("must be positive")
+	ErrInvalidBuyGet      = errors.New("must be positive")
+	ErrInvalidMinSubtotal = errors.New("must not be negative")
+	ErrInvalidLimit       = errors.New("must not be negative")
+	ErrInvalidValidity    = errors.New("must be after starts_at")
+
+	ErrDuplicateCoupon     = errors.New("is already applied")
+	ErrCouponInactive      = errors.New("is not active")
+	ErrCouponNotStarted    = errors.New("is not valid yet")
+	ErrCouponExpired       = errors.New("has expired")
+	ErrCouponCurrency      = errors.New("is for orders in another currency")
+	ErrCouponMinSubtotal   = errors.New("requires a higher order subtotal")
+	ErrCouponNotApplicable = errors.New("does not apply to any item in the order")
+	// Payments must be positive, so discounts cannot cover a whole order.
+	ErrNothingToPay = errors.New("must leave an amount to pay")
+
+	ErrCouponLimitReached     = errors.New("coupon has reached its redemption limit")
+	ErrCouponUserLimitReached = errors.New("coupon has reached its redemption limit for this user")
+)
+
+// NormalizeCouponCode makes codes case-insensitive.
+func NormalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// NewCoupon checks c and returns it active, with an ID, a normalized code
+// and timestamps.
+func NewCoupon(c Coupon) (*Coupon, error) {
+	c.ID = uuid.NewString()
+	c.Code = NormalizeCouponCode(c.Code)
+	c.Active = true
+	c.ProductIDs = slices.Compact(slices.Sorted(slices.Values(c.ProductIDs)))
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	c.CreatedAt = now
+	c.UpdatedAt = now
+	return &c, nil
+}
+
+func (c *Coupon) Validate() error {
+	var v validate.Validator
+	v.Check(couponCodePattern.MatchString(c.Code), "code", ErrInvalidCouponCode)
+	switch c.Type {
+	case CouponPercent:
+		v.Check(c.PercentOff >= 1 && c.PercentOff <= 100, "percent_off", ErrInvalidPercentOff)
+	case CouponFixed:
+		v.Check(c.AmountOff.IsPositive(), "amount_off", ErrInvalidAmountOff)
+	case CouponBuyXGetY:
+		v.Check(c.BuyQuantity > 0, "buy_quantity", ErrInvalidBuyGet)
+		v.Check(c.GetQuantity > 0, "get_quantity", ErrInvalidBuyGet)
+	case CouponFreeShipping:
+	default:
+		v.Add("type", ErrUnknownCouponType)
+	}
+	v.Check(!c.MinSubtotal.IsNegative(), "min_subtotal", ErrInvalidMinSubtotal)
+	for _, m := range []money.Money{c.AmountOff, c.MinSubtotal} {
+		if m.IsZero() {
+			continue
+		}
+		if !m.Currency().IsValid() {
+			v.Add("currency", ErrInvalidCurrency)
+			break
+		}
+		if m.Currency() != c.Currency() {
+			v.Add("currency", ErrMixedCurrencies)
+			break
+		}
+	}
+	for i, id := range c.ProductIDs {
+		v.Check(isUUID(id), fmt.Sprintf("product_ids[%d]", i), ErrInvalidProduct)
+	}
+	v.Check(c.MaxRedemptions >= 0, "max_redemptions", ErrInvalidLimit)
+	v.Check(c.MaxRedemptionsPerUser >= 0, "max_redemptions_per_user", ErrInvalidLimit)
+	if c.StartsAt != nil && c.EndsAt != nil {
+		v.Check(c.EndsAt.After(*c.StartsAt), "ends_at", ErrInvalidValidity)
+	}
+	return v.Err()
+}
+
+// Currency is the currency of the orders the coupon applies to, or "" if
+// it applies in any currency.
+func (c *Coupon) Currency() money.Currency {
+	if !c.AmountOff.IsZero() {
+		return c.AmountOff.Currency()
+	}
+	if !c.MinSubtotal.IsZero() {
+		return c.MinSubtotal.Currency()
+	}
+	return ""
+}
+
+func (c *Coupon) appliesTo(productID string) bool {
+	return len(c.ProductIDs) == 0 || slices.Contains(c.ProductIDs, productID)
+}
+
+// check reports why c cannot be used on o at now, if it cannot. Redemption
+// limits are checked when the order is saved.
+func (c *Coupon) check(o *Order, now time.Time) error {
+	switch {
+	case !c.Active:
+		return ErrCouponInactive
+	case c.StartsAt != nil && now.Before(*c.StartsAt):
+		return ErrCouponNotStarted
+	case c.EndsAt != nil && !now.Before(*c.EndsAt):
+		return ErrCouponExpired
+	case c.Currency() != "" && c.Currency() != o.Currency:
+		return ErrCouponCurrency
+	}
+	if c.MinSubtotal.IsPositive() {
+		if cmp, err := o.Subtotal.Cmp(c.MinSubtotal); err != nil || cmp < 0 {
+			return ErrCouponMinSubtotal
+		}
+	}
+	if !slices.ContainsFunc(o.Items, func(item OrderItem) bool { return c.appliesTo(item.ProductID) }) {
+		return ErrCouponNotApplicable
+	}
+	return nil
+}
+
+// lineDiscounts works out what c takes off each line of items, given what
+// is left of every line after the coupons applied before it. No line gets
+// more off than it has left.
+func (c *Coupon) lineDiscounts(items []OrderItem, left []money.Money) []money.Money {
+	discounts := make([]money.Money, len(items))
+	for i := range items {
+		discounts[i] = money.Zero(left[i].Currency())
+	}
+
+	switch c.Type {
+	case CouponPercent:
+		for i, item := range items {
+			if c.appliesTo(item.ProductID) {
+				// Rounded up, in the customer's favour.
+				discounts[i] = left[i].Split(int64(c.PercentOff), int64(100-c.PercentOff))[0]
+			}
+		}
+	case CouponFixed:
+		weights := make([]int64, len(items))
+		eligible := money.Zero(c.AmountOff.Currency())
+		for i, item := range items {
+			if c.appliesTo(item.ProductID) {
+				weights[i] = left[i].Amount()
+				// Parts of the subtotal, so the sum cannot overflow.
+				eligible, _ = eligible.Add(left[i])
+			}
+		}
+		off := c.AmountOff
+		if cmp, _ := off.Cmp(eligible); cmp > 0 {
+			off = eligible
+		}
+		copy(discounts, off.Split(weights...))
+	case CouponBuyXGetY:
+		group := c.BuyQuantity + c.GetQuantity
+		for i, item := range items {
+			if !c.appliesTo(item.ProductID) {
+				continue
+			}
+			free, _ := item.Price.Mul(int64(item.Quantity / group * c.GetQuantity))
+			if cmp, _ := free.Cmp(left[i]); cmp > 0 {
+				free = left[i]
+			}
+			discounts[i] = free
+		}
+	}
+	return discounts
+}
+
+// applyCoupons applies coupons to o in the order given, each to what the
+// ones before it left of every line. Problems are reported against
+// coupon_codes[i].
+func (o *Order) applyCoupons(coupons []*Coupon, now time.Time) error {
+	left := make([]money.Money, len(o.Items))
+	for i, item := range o.Items {
+		left[i] = item.Subtotal()
+	}
+
+	var v validate.Validator
+	seen := make(map[string]bool, len(coupons))
+	for i, c := range coupons {
+		field := fmt.Sprintf("coupon_codes[%d]", i)
+		if seen[c.ID] {
+			v.Add(field, ErrDuplicateCoupon)
+			continue
+		}
+		seen[c.ID] = true
+		if err := c.check(o, now); err != nil {
+			v.Add(field, err)
+			continue
+		}
+
+		// Discounts are parts of the subtotal, so sums cannot overflow.
+		amount := money.Zero(o.Currency)
+		discounts := c.lineDiscounts(o.Items, left)
+		for j, d := range discounts {
+			if !d.IsPositive() {
+				continue
+			}
+			o.Items[j].Discounts = append(o.Items[j].Discounts, LineDiscount{Code: c.Code, Amount: d})
+			left[j], _ = left[j].Sub(d)
+			amount, _ = amount.Add(d)
+		}
+		if c.Type != CouponFreeShipping && !amount.IsPositive() {
+			v.Add(field, ErrCouponNotApplicable)
+			continue
+		}
+
+		o.Coupons = append(o.Coupons, AppliedCoupon{CouponID: c.ID, Code: c.Code, Type: c.Type, Amount: amount})
+		o.Discount, _ = o.Discount.Add(amount)
+	}
+	return v.Err()
+}
+
+// FreeShipping reports whether a free shipping coupon was applied.
+func (o *Order) FreeShipping() bool {
+	return slices.ContainsFunc(o.Coupons, func(c AppliedCoupon) bool { return c.Type == CouponFreeShipping })
+}
@@ -0,0 +1,118 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/money"
+)
+
+const AggregateOrder = "order"
+
+const (
+	EventOrderCreated   = "order.created"
+	EventOrderPaid      = "order.paid"
+	EventOrderCancelled = "order.cancelled"
+	// EventOrderRefunded is sent for every refund, partial or full.
+	EventOrderRefunded = "order.refunded"
+)
+
+// Event is a domain event recorded in the outbox alongside the change that
+// caused it and published asynchronously.
+type Event struct {
+	ID            int64
+	AggregateType string
+	AggregateID   string
+	Type          string
+	Payload       json.RawMessage
+	CreatedAt     time.Time
+	Attempts      int
+}
+
+type orderEventPayload struct {
+	OrderID  string         `json:"order_id"`
+	UserID   string         `json:"user_id"`
+	Status   OrderStatus    `json:"status"`
+	Currency money.Currency `json:"currency"`
+	Subtotal int64          `json:"subtotal"`
+	Discount int64          `json:"discount"`
+	Tax      int64          `json:"tax_amount"`
+	Total    int64          `json:"total"`
+	// TaxJurisdiction is empty for untaxed orders.
+	TaxJurisdiction string `json:"tax_jurisdiction,omitempty"`
+	// CouponCodes are omitted for orders without coupons.
+	CouponCodes []string `json:"coupon_codes,omitempty"`
+	// RefundedAmount is the sum of all refunds so far.
+	RefundedAmount int64            `json:"refunded_amount,omitempty"`
+	Items          []orderEventItem `json:"items"`
+	CreatedAt      time.Time        `json:"created_at"`
+	UpdatedAt      time.Time        `json:"updated_at"`
+}
+
+type orderEventItem struct {
+	ProductID   string `json:"product_id"`
+	ProductName string `json:"product_name"`
+	Quantity    int    `json:"quantity"`
+	Price       int64  `json:"price"`
+	Discount    int64  `json:"discount"`
+	Tax         int64  `json:"tax_amount"`
+}
+
+// NewOrderEvent snapshots order into an event of the given type.
+func NewOrderEvent(eventType string, order *Order) (Event, error) {
+	items := make([]orderEventItem, len(order.Items))
+	for i, item := range order.Items {
+		items[i] = orderEventItem{
+			ProductID:   item.ProductID,
+			ProductName: item.ProductName,
+			Quantity:    item.Quantity,
+			Price:       item.Price.Amount(),
+			Discount:    item.Discount().Amount(),
+			Tax:         item.Tax.Amount(),
+		}
+	}
+	var codes []string
+	for _, c := range order.Coupons {
+		codes = append(codes, c.Code)
+	}
+
+	payload, err := json.Marshal(orderEventPayload{
+		OrderID:         order.ID,
+		UserID:          order.UserID,
+		Status:          order.Status,
+		Currency:        order.Currency,
+		Subtotal:        order.Subtotal.Amount(),
+		Discount:        order.Discount.Amount(),
+		Tax:             order.Tax.Amount(),
+		Total:           order.Total.Amount(),
+		TaxJurisdiction: order.TaxJurisdiction,
+		CouponCodes:     codes,
+		RefundedAmount:  order.RefundedAmount().Amount(),
+		Items:           items,
+		CreatedAt:       order.CreatedAt,
+		UpdatedAt:       order.UpdatedAt,
+	})
+	if err != nil {
+		return Event{}, err
+	}
+
+	return Event{
+		AggregateType: AggregateOrder,
+		AggregateID:   order.ID,
+		Type:          eventType,
+		Payload:       payload,
+		CreatedAt:     time.Now(),
+	}, nil
+}
+
+// OrderStatusEvent returns the event type announcing that an order entered
+// status, or "" if that status has no event.
+func OrderStatusEvent(status OrderStatus) string {
+	switch status {
+	case StatusPaid:
+		return EventOrderPaid
+	case StatusCancelled:
+		return EventOrderCancelled
+	}
+	return ""
+}
@@ -5,75 +5,272 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/Kosench/ecommerce-lab/internal/money"
+	"github.com/Kosench/ecommerce-lab/internal/tax"
+	"github.com/Kosench/ecommerce-lab/internal/validate"
 	"github.com/google/uuid"
 )
 
 type OrderStatus string
 
 const (
-	StatusPending   OrderStatus = "pending"
-	StatusPaid      OrderStatus = "paid"
-	StatusCancelled OrderStatus = "cancelled"
+	StatusPending           OrderStatus = "pending"
+	StatusPaid              OrderStatus = "paid"
+	StatusCancelled         OrderStatus = "cancelled"
+	StatusPartiallyRefunded OrderStatus = "partially_refunded"
+	StatusRefunded          OrderStatus = "refunded"
 )
 
+func (s OrderStatus) IsValid() bool {
+	switch s {
+	case StatusPending, StatusPaid, StatusCancelled, StatusPartiallyRefunded, StatusRefunded:
+		return true
+	}
+	return false
+}
+
 type Order struct {
-	ID        string
-	UserID    string
-	Items     []OrderItem
-	Status    OrderStatus
-	Total     int64
+	ID     string
+	UserID string
+	// CartID is set on orders placed by checking out a cart.
+	CartID string
+	Items  []OrderItem
+	// Refunds are the refunds issued or in progress, oldest first. Refunds
+	// the provider did not make are left out.
+	Refunds []Refund
+	Status  OrderStatus
+	// Currency is the currency of every amount on the order.
+	Currency money.Currency
+	// Subtotal is the sum of the lines before discounts and tax; Total is
+	// the grand total the customer pays, Subtotal less Discount plus Tax.
+	Subtotal money.Money
+	Discount money.Money
+	Tax      money.Money
+	Total    money.Money
+	// TaxJurisdiction is where the order was taxed.
+	TaxJurisdiction string
+	// Coupons are the coupons applied, in the order they were given.
+	Coupons   []AppliedCoupon
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
 
 type OrderItem struct {
-	ProductID string
-	Quantity  int
-	Price     int64
+	ProductID   string
+	ProductName string
+	Quantity    int
+	Price       money.Money
+	// TaxCategory is the product's tax category when it was ordered.
+	TaxCategory string
+	// Discounts break the line's discount down by coupon.
+	Discounts []LineDiscount
+	// Tax is charged on what is left of the line after discounts.
+	Tax money.Money
+}
+
+type LineDiscount struct {
+	Code   string
+	Amount money.Money
+}
+
+// Subtotal is the line's amount before discounts. NewOrder checks it does
+// not overflow.
+func (i OrderItem) Subtotal() money.Money {
+	subtotal, _ := i.Price.Mul(int64(i.Quantity))
+	return subtotal
 }
 
+func (i OrderItem) Discount() money.Money {
+	sum := money.Zero(i.Price.Currency())
+	for _, d := range i.Discounts {
+		sum, _ = sum.Add(d.Amount)
+	}
+	return sum
+}
+
+// Total is what the customer pays for the line, tax included.
+func (i OrderItem) Total() money.Money {
+	total, _ := i.Subtotal().Sub(i.Discount())
+	total, _ = total.Add(i.Tax)
+	return total
+}
+
+// Validation errors read as a continuation of the field name they are
+// reported against, e.g. "items[3].quantity: must be positive".
 var (
 	ErrInvalidOrder    = errors.New("invalid order")
-	ErrEmptyUserID     = errors.New("user_id is required")
-	ErrEmptyItems      = errors.New("order must have at least one item")
-	ErrInvalidProduct  = errors.New("product_id is required")
-	ErrInvalidQuantity = errors.New("quantity must be positive")
-	ErrInvalidPrice    = errors.New("price must be positive")
+	ErrEmptyUserID     = errors.New("is required")
+	ErrInvalidUserID   = errors.New("must be a valid UUID")
+	ErrEmptyItems      = errors.New("must contain at least one item")
+	ErrInvalidProduct  = errors.New("must be a valid UUID")
+	ErrInvalidQuantity = errors.New("must be positive")
+	ErrInvalidPrice    = errors.New("must be positive")
+	ErrInvalidCurrency = errors.New("must be a supported ISO 4217 currency code")
+	ErrMixedCurrencies = errors.New("must be in the same currency as the other items")
+	ErrTotalTooLarge   = errors.New("order total is too large")
+	ErrUnknownStatus   = errors.New("must be one of pending, paid, cancelled, partially_refunded, refunded")
+
+	ErrInvalidTransition = errors.New("invalid status transition")
 )
 
-func NewOrder(userID string, items []OrderItem) (*Order, error) {
+// orderTransitions lists the statuses each status may move to. Only unpaid
+// orders can be cancelled; money on a paid order is given back through a
+// refund, which moves it to one of the refund statuses.
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	StatusPending:           {StatusPaid, StatusCancelled},
+	StatusPaid:              {StatusPartiallyRefunded, StatusRefunded},
+	StatusPartiallyRefunded: {StatusRefunded},
+}
+
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *Order) TransitionTo(next OrderStatus) error {
+	if !o.Status.CanTransitionTo(next) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, o.Status, next)
+	}
+
+	o.Status = next
+	o.UpdatedAt = time.Now()
+	return nil
+}
+
+// ValidateOrderInput checks what a client supplies for a new order. Prices
+// are not checked: they come from the catalog after this runs.
+func ValidateOrderInput(userID string, items []OrderItem) error {
+	var v validate.Validator
+	validateOrder(&v, userID, items)
+	return v.Err()
+}
+
+func validateOrder(v *validate.Validator, userID string, items []OrderItem) {
 	if userID == "" {
-		return nil, ErrEmptyUserID
+		v.Add("user_id", ErrEmptyUserID)
+	} else {
+		v.Check(isUUID(userID), "user_id", ErrInvalidUserID)
 	}
-	if len(items) == 0 {
-		return nil, ErrEmptyItems
+	v.Check(len(items) > 0, "items", ErrEmptyItems)
+
+	for i, item := range items {
+		v.Check(isUUID(item.ProductID), validate.Index("items", i, "product_id"), ErrInvalidProduct)
+		v.Check(item.Quantity > 0, validate.Index("items", i, "quantity"), ErrInvalidQuantity)
 	}
+}
+
+func isUUID(s string) bool {
+	_, err := uuid.Parse(s)
+	return err == nil
+}
 
+// NewOrder prices an order of items, applying coupons in the order given.
+// The items' Discounts are filled in; any passed in are discarded. The order
+// is untaxed until ApplyTax is called.
+func NewOrder(userID string, items []OrderItem, coupons []*Coupon) (*Order, error) {
+	var v validate.Validator
+	validateOrder(&v, userID, items)
+	var currency money.Currency
 	for i, item := range items {
-		if item.ProductID == "" {
-			return nil, fmt.Errorf("%w: item[%d]", ErrInvalidProduct, i)
-		}
-		if item.Quantity <= 0 {
-			return nil, fmt.Errorf("%w: item[%d]", ErrInvalidQuantity, i)
-		}
-		if item.Price <= 0 {
-			return nil, fmt.Errorf("%w: item[%d]", ErrInvalidPrice, i)
+		field := validate.Index("items", i, "price")
+		switch {
+		case !item.Price.IsPositive():
+			v.Add(field, ErrInvalidPrice)
+		case !item.Price.Currency().IsValid():
+			v.Add(field, ErrInvalidCurrency)
+		case currency == "":
+			currency = item.Price.Currency()
+		case item.Price.Currency() != currency:
+			v.Add(field, ErrMixedCurrencies)
 		}
 	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
 
-	var total int64
+	subtotal := money.Zero(currency)
 	for _, item := range items {
-		total += int64(item.Quantity) * item.Price
+		line, err := item.Price.Mul(int64(item.Quantity))
+		if err == nil {
+			subtotal, err = subtotal.Add(line)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrTotalTooLarge, err)
+		}
 	}
 
 	now := time.Now()
-	return &Order{
+	order := &Order{
 		ID:        uuid.NewString(),
 		UserID:    userID,
-		Items:     items,
+		Items:     make([]OrderItem, len(items)),
 		Status:    StatusPending,
-		Total:     total,
+		Currency:  currency,
+		Subtotal:  subtotal,
+		Discount:  money.Zero(currency),
+		Tax:       money.Zero(currency),
 		CreatedAt: now,
 		UpdatedAt: now,
-	}, nil
+	}
+	for i, item := range items {
+		item.Discounts = nil
+		item.Tax = money.Zero(currency)
+		order.Items[i] = item
+	}
+	if err := order.applyCoupons(coupons, now); err != nil {
+		return nil, err
+	}
+	// The discount never exceeds the subtotal.
+	order.Total, _ = subtotal.Sub(order.Discount)
+	if !order.Total.IsPositive() {
+		return nil, &validate.FieldError{Field: "coupon_codes", Err: ErrNothingToPay}
+	}
+	return order, nil
+}
+
+// ApplyTax taxes every line of o in jurisdiction with calc, replacing any
+// tax worked out before, and adds the tax to the total. An empty
+// jurisdiction is the calculator's default.
+func (o *Order) ApplyTax(calc tax.Calculator, jurisdiction string) error {
+	lines := make([]tax.Line, len(o.Items))
+	for i, item := range o.Items {
+		taxable, _ := item.Subtotal().Sub(item.Discount())
+		lines[i] = tax.Line{Category: item.TaxCategory, Amount: taxable}
+	}
+
+	res, err := calc.Calculate(jurisdiction, lines)
+	if errors.Is(err, tax.ErrJurisdictionRequired) || errors.Is(err, tax.ErrUnknownJurisdiction) {
+		return &validate.FieldError{Field: "tax_jurisdiction", Err: err}
+	}
+	if err != nil {
+		return fmt.Errorf("calculate tax: %w", err)
+	}
+	if len(res.Lines) != len(o.Items) {
+		return fmt.Errorf("calculate tax: got %d lines, want %d", len(res.Lines), len(o.Items))
+	}
+
+	sum := money.Zero(o.Currency)
+	for _, t := range res.Lines {
+		if sum, err = sum.Add(t); err != nil {
+			return fmt.Errorf("%w: %w", ErrTotalTooLarge, err)
+		}
+	}
+	// The discount never exceeds the subtotal.
+	untaxed, _ := o.Subtotal.Sub(o.Discount)
+	total, err := untaxed.Add(sum)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrTotalTooLarge, err)
+	}
+
+	for i := range o.Items {
+		o.Items[i].Tax = res.Lines[i]
+	}
+	o.TaxJurisdiction = res.Jurisdiction
+	o.Tax = sum
+	o.Total = total
+	return nil
 }
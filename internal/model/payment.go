@@ -0,0 +1,98 @@
+package model
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/money"
+	"github.com/google/uuid"
+)
+
+type PaymentStatus string
+
+const (
+	PaymentPending    PaymentStatus = "pending"
+	PaymentAuthorized PaymentStatus = "authorized"
+	PaymentCaptured   PaymentStatus = "captured"
+	PaymentVoided     PaymentStatus = "voided"
+	PaymentFailed     PaymentStatus = "failed"
+	// PaymentRefunded is a capture that was given back because the order
+	// could no longer be paid, e.g. it was cancelled meanwhile.
+	PaymentRefunded PaymentStatus = "refunded"
+)
+
+var ErrEmptyPaymentMethod = errors.New("is required")
+
+// paymentProgress ranks statuses so that a late webhook cannot move a
+// payment back, e.g. a failure reported after the capture.
+var paymentProgress = map[PaymentStatus]int{
+	PaymentPending:    0,
+	PaymentAuthorized: 1,
+	PaymentFailed:     2,
+	PaymentVoided:     2,
+	PaymentCaptured:   3,
+	PaymentRefunded:   4,
+}
+
+// Precedes reports whether next is further along than s.
+func (s PaymentStatus) Precedes(next PaymentStatus) bool {
+	return paymentProgress[s] < paymentProgress[next]
+}
+
+// Payment is one attempt to collect an order's total through a payment
+// provider. Failed attempts are kept with the provider's error code.
+type Payment struct {
+	ID              string
+	OrderID         string
+	Provider        string
+	Status          PaymentStatus
+	Amount          money.Money
+	AuthorizationID string
+	CaptureID       string
+	FailureCode     string
+	FailureMessage  string
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+func NewPayment(orderID, provider string, amount money.Money) *Payment {
+	now := time.Now()
+	return &Payment{
+		ID:        uuid.NewString(),
+		OrderID:   orderID,
+		Provider:  provider,
+		Status:    PaymentPending,
+		Amount:    amount,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+func (p *Payment) Authorized(authorizationID string) {
+	p.Status = PaymentAuthorized
+	p.AuthorizationID = authorizationID
+	p.UpdatedAt = time.Now()
+}
+
+func (p *Payment) Captured(captureID string) {
+	p.Status = PaymentCaptured
+	p.CaptureID = captureID
+	p.UpdatedAt = time.Now()
+}
+
+func (p *Payment) Voided() {
+	p.Status = PaymentVoided
+	p.UpdatedAt = time.Now()
+}
+
+func (p *Payment) Refunded() {
+	p.Status = PaymentRefunded
+	p.UpdatedAt = time.Now()
+}
+
+func (p *Payment) Failed(code, message string) {
+	p.Status = PaymentFailed
+	p.FailureCode = code
+	p.FailureMessage = message
+	p.UpdatedAt = time.Now()
+}
@@ -0,0 +1,43 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type PaymentEventOutcome string
+
+const (
+	PaymentEventApplied PaymentEventOutcome = "applied"
+	// PaymentEventIgnored is an event that changed nothing, e.g. one that
+	// arrived after a later state had already been applied.
+	PaymentEventIgnored PaymentEventOutcome = "ignored"
+)
+
+// PaymentEvent is a webhook received from a payment provider, kept as sent.
+// EventID is the provider's ID; a provider never delivers two events with
+// the same one. Outcome and ProcessedAt are unset until it is processed.
+type PaymentEvent struct {
+	ID          string
+	Provider    string
+	EventID     string
+	EventType   string
+	OrderID     string
+	Payload     []byte
+	Outcome     PaymentEventOutcome
+	ReceivedAt  time.Time
+	ProcessedAt *time.Time
+}
+
+func NewPaymentEvent(provider, eventID, eventType, orderID string, payload []byte) *PaymentEvent {
+	return &PaymentEvent{
+		ID:         uuid.NewString(),
+		Provider:   provider,
+		EventID:    eventID,
+		EventType:  eventType,
+		OrderID:    orderID,
+		Payload:    payload,
+		ReceivedAt: time.Now(),
+	}
+}
@@ -0,0 +1,62 @@
+package model
+
+import (
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/money"
+	"github.com/Kosench/ecommerce-lab/internal/validate"
+	"github.com/google/uuid"
+)
+
+type Product struct {
+	ID          string
+	Name        string
+	Description string
+	Price       money.Money
+	// TaxCategory picks the product's tax rate; "" is the default category.
+	TaxCategory string
+	Active      bool
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+var (
+	ErrEmptyProductName   = errors.New("is required")
+	ErrProductInactive    = errors.New("product is not available")
+	ErrInvalidTaxCategory = errors.New("must be up to 32 lower case letters, digits or '_'")
+)
+
+var taxCategoryPattern = regexp.MustCompile(`^([a-z0-9_]{1,32})?$`)
+
+// DefaultCurrency prices products created without a currency.
+const DefaultCurrency = money.USD
+
+func NewProduct(name, description string, price money.Money, taxCategory string) (*Product, error) {
+	p := &Product{
+		ID:          uuid.NewString(),
+		Name:        name,
+		Description: description,
+		Price:       price,
+		TaxCategory: taxCategory,
+		Active:      true,
+	}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	p.CreatedAt = now
+	p.UpdatedAt = now
+	return p, nil
+}
+
+func (p *Product) Validate() error {
+	var v validate.Validator
+	v.Check(p.Name != "", "name", ErrEmptyProductName)
+	v.Check(p.Price.IsPositive(), "price", ErrInvalidPrice)
+	v.Check(p.Price.Currency().IsValid(), "currency", ErrInvalidCurrency)
+	v.Check(taxCategoryPattern.MatchString(p.TaxCategory), "tax_category", ErrInvalidTaxCategory)
+	return v.Err()
+}
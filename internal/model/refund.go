@@ -0,0 +1,284 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/money"
+	"github.com/Kosench/ecommerce-lab/internal/validate"
+	"github.com/google/uuid"
+)
+
+// Refund gives back part or all of a paid order's total. Items says what
+// was refunded; a full refund lists everything not refunded before.
+type Refund struct {
+	ID        string
+	OrderID   string
+	PaymentID string
+	// ProviderRefundID is the payment provider's reference for the refund.
+	ProviderRefundID string
+	Status           RefundStatus
+	Amount           money.Money
+	Reason           string
+	Items            []RefundItem
+	CreatedAt        time.Time
+}
+
+type RefundStatus string
+
+const (
+	// RefundPending holds back what the refund gives while the provider is
+	// asked to make it, so concurrent refunds cannot exceed the total.
+	RefundPending   RefundStatus = "pending"
+	RefundSucceeded RefundStatus = "succeeded"
+	// RefundFailed marks a refund the provider did not make. It holds back
+	// nothing.
+	RefundFailed RefundStatus = "failed"
+)
+
+type RefundItem struct {
+	ProductID string
+	Quantity  int
+	Amount    money.Money
+}
+
+var (
+	ErrOrderNotRefundable     = errors.New("order is not refundable")
+	ErrRefundExceedsTotal     = errors.New("refund exceeds the order total")
+	ErrNothingToRefund        = errors.New("order is already fully refunded")
+	ErrNoCapturedPayment      = errors.New("order has no captured payment to refund")
+	ErrRefundItemNotInOrder   = errors.New("is not in the order")
+	ErrRefundQuantityExceeded = errors.New("exceeds the quantity not yet refunded")
+	ErrRefundNotPending       = errors.New("refund is not pending")
+)
+
+// IsRefundable reports whether money may be given back on an order in s.
+func (s OrderStatus) IsRefundable() bool {
+	return s == StatusPaid || s == StatusPartiallyRefunded
+}
+
+// RefundedAmount is the sum of the refunds the provider has made.
+func (o *Order) RefundedAmount() money.Money {
+	return o.sumRefunds(func(r Refund) bool { return r.Status == RefundSucceeded })
+}
+
+// reservedAmount is the sum of the refunds made or in progress.
+func (o *Order) reservedAmount() money.Money {
+	return o.sumRefunds(func(Refund) bool { return true })
+}
+
+// sumRefunds adds up the refunds that match. ReserveRefund keeps refunds
+// within the total, so the sum cannot overflow.
+func (o *Order) sumRefunds(match func(Refund) bool) money.Money {
+	sum := money.Zero(o.Currency)
+	for _, r := range o.Refunds {
+		if match(r) {
+			sum, _ = sum.Add(r.Amount)
+		}
+	}
+	return sum
+}
+
+// fits reports whether amount can be refunded on top of earlier refunds,
+// including those still in progress.
+func (o *Order) fits(amount money.Money) bool {
+	left, err := o.Total.Sub(o.reservedAmount())
+	if err != nil {
+		return false
+	}
+	c, err := amount.Cmp(left)
+	return err == nil && c <= 0
+}
+
+// refundLine is what was bought of a product and how much of it is left to
+// refund.
+type refundLine struct {
+	ordered   int
+	remaining int
+	// paid is what all ordered units cost after discounts, tax included.
+	paid money.Money
+}
+
+// refundable returns the refund lines of the order by product.
+func (o *Order) refundable() map[string]*refundLine {
+	lines := make(map[string]*refundLine, len(o.Items))
+	for _, item := range o.Items {
+		line, ok := lines[item.ProductID]
+		if !ok {
+			line = &refundLine{paid: money.Zero(o.Currency)}
+			lines[item.ProductID] = line
+		}
+		line.ordered += item.Quantity
+		line.remaining += item.Quantity
+		// Parts of the order total, so the sum cannot overflow.
+		line.paid, _ = line.paid.Add(item.Total())
+	}
+	for _, r := range o.Refunds {
+		for _, item := range r.Items {
+			if line, ok := lines[item.ProductID]; ok {
+				line.remaining -= item.Quantity
+			}
+		}
+	}
+	return lines
+}
+
+// take prices n more units of the line and marks them refunded. Each unit
+// gets its share of the discounts, and the last unit refunded takes what is
+// left, so refunding every unit gives back exactly what was paid.
+func (l *refundLine) take(n int) money.Money {
+	refunded := l.ordered - l.remaining
+	before := l.share(refunded)
+	after := l.share(refunded + n)
+	l.remaining -= n
+	amount, _ := after.Sub(before)
+	return amount
+}
+
+func (l *refundLine) share(units int) money.Money {
+	return l.paid.Split(int64(units), int64(l.ordered-units))[0]
+}
+
+// NewRefund prices a pending refund of the given items, or of everything not
+// yet refunded if items is empty. Only ProductID and Quantity of items are
+// read. The order is not changed; see ReserveRefund and ApplyRefund.
+func (o *Order) NewRefund(items []RefundItem, reason string) (*Refund, error) {
+	if !o.Status.IsRefundable() {
+		return nil, fmt.Errorf("%w: order is %s", ErrOrderNotRefundable, o.Status)
+	}
+
+	lines := o.refundable()
+	refund := &Refund{
+		ID:        uuid.NewString(),
+		OrderID:   o.ID,
+		Status:    RefundPending,
+		Amount:    money.Zero(o.Currency),
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	}
+
+	// Line amounts are parts of the order total, so they cannot overflow.
+	if len(items) == 0 {
+		for _, item := range o.Items {
+			line := lines[item.ProductID]
+			if q := line.remaining; q > 0 {
+				refund.Items = append(refund.Items, RefundItem{ProductID: item.ProductID, Quantity: q, Amount: line.take(q)})
+			}
+		}
+		amount, err := o.Total.Sub(o.reservedAmount())
+		if err != nil {
+			return nil, err
+		}
+		if !amount.IsPositive() {
+			return nil, ErrNothingToRefund
+		}
+		refund.Amount = amount
+		return refund, nil
+	}
+
+	// Repeated products are merged into one refund line.
+	merged := make(map[string]int, len(items))
+	var v validate.Validator
+	for i, item := range items {
+		line, ok := lines[item.ProductID]
+		switch {
+		case !ok:
+			v.Add(validate.Index("items", i, "product_id"), ErrRefundItemNotInOrder)
+		case item.Quantity <= 0:
+			v.Add(validate.Index("items", i, "quantity"), ErrInvalidQuantity)
+		case item.Quantity > line.remaining:
+			v.Add(validate.Index("items", i, "quantity"), ErrRefundQuantityExceeded)
+		default:
+			amount := line.take(item.Quantity)
+			refund.Amount, _ = refund.Amount.Add(amount)
+			if j, ok := merged[item.ProductID]; ok {
+				refund.Items[j].Quantity += item.Quantity
+				refund.Items[j].Amount, _ = refund.Items[j].Amount.Add(amount)
+				continue
+			}
+			merged[item.ProductID] = len(refund.Items)
+			refund.Items = append(refund.Items, RefundItem{ProductID: item.ProductID, Quantity: item.Quantity, Amount: amount})
+		}
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	if !o.fits(refund.Amount) {
+		return nil, ErrRefundExceedsTotal
+	}
+	return refund, nil
+}
+
+// ReserveRefund records refund on the order as pending. It checks the
+// refund again against the refunds the order holds now, which may include
+// ones added since it was priced. The order status is left alone until the
+// refund is confirmed.
+func (o *Order) ReserveRefund(refund Refund) error {
+	if !o.Status.IsRefundable() {
+		return fmt.Errorf("%w: order is %s", ErrOrderNotRefundable, o.Status)
+	}
+	if !refund.Amount.IsPositive() || !o.fits(refund.Amount) {
+		return ErrRefundExceedsTotal
+	}
+	lines := o.refundable()
+	for _, item := range refund.Items {
+		line, ok := lines[item.ProductID]
+		if !ok || item.Quantity > line.remaining {
+			return fmt.Errorf("%w: product %s", ErrRefundQuantityExceeded, item.ProductID)
+		}
+		line.remaining -= item.Quantity
+	}
+
+	refund.Status = RefundPending
+	o.Refunds = append(o.Refunds, refund)
+	return nil
+}
+
+// ConfirmRefund marks a pending refund as made by the provider and moves
+// the order to refunded or partially_refunded.
+func (o *Order) ConfirmRefund(refundID, providerRefundID string) error {
+	i := o.pendingRefund(refundID)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrRefundNotPending, refundID)
+	}
+	o.Refunds[i].Status = RefundSucceeded
+	o.Refunds[i].ProviderRefundID = providerRefundID
+
+	next := StatusPartiallyRefunded
+	if o.RefundedAmount() == o.Total {
+		next = StatusRefunded
+	}
+	if next != o.Status {
+		return o.TransitionTo(next)
+	}
+	o.UpdatedAt = time.Now()
+	return nil
+}
+
+// VoidRefund drops a pending refund the provider did not make, releasing
+// what it held back.
+func (o *Order) VoidRefund(refundID string) error {
+	i := o.pendingRefund(refundID)
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrRefundNotPending, refundID)
+	}
+	o.Refunds = slices.Delete(o.Refunds, i, i+1)
+	return nil
+}
+
+// ApplyRefund records a refund the provider has already made: it reserves
+// and confirms it in one step.
+func (o *Order) ApplyRefund(refund Refund) error {
+	if err := o.ReserveRefund(refund); err != nil {
+		return err
+	}
+	return o.ConfirmRefund(refund.ID, refund.ProviderRefundID)
+}
+
+func (o *Order) pendingRefund(refundID string) int {
+	return slices.IndexFunc(o.Refunds, func(r Refund) bool {
+		return r.ID == refundID && r.Status == RefundPending
+	})
+}
@@ -0,0 +1,48 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type StockLevel struct {
+	ProductID string
+	OnHand    int
+	Reserved  int
+	UpdatedAt time.Time
+}
+
+func (s StockLevel) Available() int {
+	return s.OnHand - s.Reserved
+}
+
+var (
+	ErrInsufficientStock = errors.New("insufficient stock")
+	ErrInvalidStock      = errors.New("must not be negative")
+	ErrStockBelowReserve = errors.New("stock must not be lower than reserved quantity")
+)
+
+type StockShortage struct {
+	ProductID string
+	Requested int
+	Available int
+}
+
+// InsufficientStockError lists every product an order could not reserve.
+type InsufficientStockError struct {
+	Shortages []StockShortage
+}
+
+func (e *InsufficientStockError) Error() string {
+	parts := make([]string, len(e.Shortages))
+	for i, s := range e.Shortages {
+		parts[i] = fmt.Sprintf("%s (requested %d, available %d)", s.ProductID, s.Requested, s.Available)
+	}
+	return fmt.Sprintf("%s: %s", ErrInsufficientStock, strings.Join(parts, ", "))
+}
+
+func (e *InsufficientStockError) Is(target error) bool {
+	return target == ErrInsufficientStock
+}
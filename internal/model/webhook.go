@@ -0,0 +1,111 @@
+package model
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/validate"
+	"github.com/google/uuid"
+)
+
+// WebhookEventTypes are the events partners can subscribe to.
+var WebhookEventTypes = []string{EventOrderCreated, EventOrderPaid, EventOrderCancelled, EventOrderRefunded}
+
+var (
+	ErrInvalidWebhookURL = errors.New("must be an absolute http or https URL")
+	ErrEmptyEventTypes   = errors.New("must contain at least one event type")
+	ErrUnknownEventType  = errors.New("unknown event type")
+)
+
+type WebhookSubscription struct {
+	ID         string
+	URL        string
+	EventTypes []string
+	Secret     string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func NewWebhookSubscription(rawURL string, eventTypes []string) (*WebhookSubscription, error) {
+	var v validate.Validator
+	u, err := url.Parse(rawURL)
+	v.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "url", ErrInvalidWebhookURL)
+	v.Check(len(eventTypes) > 0, "event_types", ErrEmptyEventTypes)
+	for i, t := range eventTypes {
+		v.Check(slices.Contains(WebhookEventTypes, t), fmt.Sprintf("event_types[%d]", i), ErrUnknownEventType)
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &WebhookSubscription{
+		ID:         uuid.NewString(),
+		URL:        rawURL,
+		EventTypes: slices.Compact(slices.Sorted(slices.Values(eventTypes))),
+		Secret:     secret,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}, nil
+}
+
+// RotateSecret replaces the signing secret. Deliveries made afterwards are
+// signed with the new one only.
+func (s *WebhookSubscription) RotateSecret() error {
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return err
+	}
+	s.Secret = secret
+	s.UpdatedAt = time.Now()
+	return nil
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	DeliveryPending   WebhookDeliveryStatus = "pending"
+	DeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	DeliveryFailed    WebhookDeliveryStatus = "failed"
+)
+
+type WebhookDelivery struct {
+	ID             string
+	SubscriptionID string
+	EventID        int64
+	EventType      string
+	Payload        json.RawMessage
+	Status         WebhookDeliveryStatus
+	Attempts       int
+	NextAttemptAt  time.Time
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	AttemptLog     []WebhookAttempt
+}
+
+type WebhookAttempt struct {
+	Attempt     int
+	StatusCode  int
+	Error       string
+	Duration    time.Duration
+	AttemptedAt time.Time
+}
@@ -0,0 +1,208 @@
+// Package money represents amounts in the minor unit of an ISO 4217
+// currency, such as cents for USD. Arithmetic is checked: it fails on
+// overflow or on mixing currencies instead of returning a wrong amount.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Currency is an ISO 4217 alphabetic code.
+type Currency string
+
+const (
+	USD Currency = "USD"
+	EUR Currency = "EUR"
+	GBP Currency = "GBP"
+	JPY Currency = "JPY"
+)
+
+// currencies maps the supported currencies to the number of digits of their
+// minor unit.
+var currencies = map[Currency]int{
+	"AUD": 2, "BHD": 3, "BRL": 2, "CAD": 2, "CHF": 2, "CNY": 2, "CZK": 2,
+	"DKK": 2, "EUR": 2, "GBP": 2, "HKD": 2, "HUF": 2, "INR": 2, "JPY": 0,
+	"KRW": 0, "KWD": 3, "MXN": 2, "NOK": 2, "NZD": 2, "PLN": 2, "SEK": 2,
+	"SGD": 2, "TRY": 2, "UAH": 2, "USD": 2, "ZAR": 2,
+}
+
+var (
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	ErrOverflow         = errors.New("amount overflow")
+)
+
+func (c Currency) IsValid() bool {
+	_, ok := currencies[c]
+	return ok
+}
+
+// Digits is the number of decimal digits of the minor unit, e.g. 2 for USD
+// and 0 for JPY.
+func (c Currency) Digits() int {
+	return currencies[c]
+}
+
+// Money is an amount in minor units of a currency. The zero value has no
+// currency; it is the starting point of a sum and adopts the currency of
+// the first amount added to it.
+type Money struct {
+	amount   int64
+	currency Currency
+}
+
+func New(amount int64, currency Currency) Money {
+	return Money{amount: amount, currency: currency}
+}
+
+// Zero returns no money in currency.
+func Zero(currency Currency) Money {
+	return Money{currency: currency}
+}
+
+func (m Money) Amount() int64 {
+	return m.amount
+}
+
+func (m Money) Currency() Currency {
+	return m.currency
+}
+
+func (m Money) IsZero() bool {
+	return m.amount == 0
+}
+
+func (m Money) IsPositive() bool {
+	return m.amount > 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.amount < 0
+}
+
+// unset reports whether m is the zero value.
+func (m Money) unset() bool {
+	return m.currency == "" && m.amount == 0
+}
+
+func (m Money) sameCurrency(o Money) (Currency, error) {
+	switch {
+	case m.unset():
+		return o.currency, nil
+	case o.unset():
+		return m.currency, nil
+	case m.currency != o.currency:
+		return "", fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.currency, o.currency)
+	}
+	return m.currency, nil
+}
+
+func (m Money) Add(o Money) (Money, error) {
+	c, err := m.sameCurrency(o)
+	if err != nil {
+		return Money{}, err
+	}
+	if (o.amount > 0 && m.amount > math.MaxInt64-o.amount) || (o.amount < 0 && m.amount < math.MinInt64-o.amount) {
+		return Money{}, fmt.Errorf("%w: %s + %s", ErrOverflow, m, o)
+	}
+	return Money{amount: m.amount + o.amount, currency: c}, nil
+}
+
+func (m Money) Sub(o Money) (Money, error) {
+	c, err := m.sameCurrency(o)
+	if err != nil {
+		return Money{}, err
+	}
+	if (o.amount < 0 && m.amount > math.MaxInt64+o.amount) || (o.amount > 0 && m.amount < math.MinInt64+o.amount) {
+		return Money{}, fmt.Errorf("%w: %s - %s", ErrOverflow, m, o)
+	}
+	return Money{amount: m.amount - o.amount, currency: c}, nil
+}
+
+// Mul multiplies m by n, e.g. a unit price by a quantity.
+func (m Money) Mul(n int64) (Money, error) {
+	if m.amount == 0 || n == 0 {
+		return Money{currency: m.currency}, nil
+	}
+	p := m.amount * n
+	if p/n != m.amount || (m.amount == -1 && n == math.MinInt64) || (n == -1 && m.amount == math.MinInt64) {
+		return Money{}, fmt.Errorf("%w: %s * %d", ErrOverflow, m, n)
+	}
+	return Money{amount: p, currency: m.currency}, nil
+}
+
+// Split divides m in proportion to weights, which must not be negative.
+// Parts are rounded toward zero and what is left is handed out a minor unit
+// at a time to the parts with a nonzero weight, first to last, so the parts
+// always add up to m. If every weight is zero, so is every part.
+func (m Money) Split(weights ...int64) []Money {
+	parts := make([]Money, len(weights))
+	total := new(big.Int)
+	for i, w := range weights {
+		parts[i].currency = m.currency
+		total.Add(total, big.NewInt(w))
+	}
+	if total.Sign() == 0 {
+		return parts
+	}
+
+	left := m.amount
+	amount := big.NewInt(m.amount)
+	for i, w := range weights {
+		part := new(big.Int).Mul(amount, big.NewInt(w))
+		part.Quo(part, total)
+		parts[i].amount = part.Int64()
+		left -= parts[i].amount
+	}
+
+	unit := int64(1)
+	if left < 0 {
+		unit = -1
+	}
+	for i := 0; left != 0; i++ {
+		if weights[i] > 0 {
+			parts[i].amount += unit
+			left -= unit
+		}
+	}
+	return parts
+}
+
+// Cmp compares m and o, returning -1, 0 or +1.
+func (m Money) Cmp(o Money) (int, error) {
+	if _, err := m.sameCurrency(o); err != nil {
+		return 0, err
+	}
+	switch {
+	case m.amount < o.amount:
+		return -1, nil
+	case m.amount > o.amount:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// String formats m in major units, e.g. "12.50 USD".
+func (m Money) String() string {
+	digits := m.currency.Digits()
+	s := strconv.FormatInt(m.amount, 10)
+	neg := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	if digits > 0 {
+		if len(s) <= digits {
+			s = strings.Repeat("0", digits-len(s)+1) + s
+		}
+		s = s[:len(s)-digits] + "." + s[len(s)-digits:]
+	}
+	if neg {
+		s = "-" + s
+	}
+	if m.currency == "" {
+		return s
+	}
+	return s + " " + string(m.currency)
+}
@@ -0,0 +1,178 @@
+package money_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/Kosench/ecommerce-lab/internal/money"
+)
+
+func TestArithmeticOverflow(t *testing.T) {
+	usd := func(amount int64) money.Money { return money.New(amount, money.USD) }
+	add := func(a, b int64) (money.Money, error) { return usd(a).Add(usd(b)) }
+	sub := func(a, b int64) (money.Money, error) { return usd(a).Sub(usd(b)) }
+	mul := func(a, b int64) (money.Money, error) { return usd(a).Mul(b) }
+
+	tests := []struct {
+		name    string
+		op      func(a, b int64) (money.Money, error)
+		a, b    int64
+		want    int64
+		wantErr bool
+	}{
+		{"add up to max", add, math.MaxInt64 - 1, 1, math.MaxInt64, false},
+		{"add past max", add, math.MaxInt64, 1, 0, true},
+		{"add down to min", add, math.MinInt64 + 1, -1, math.MinInt64, false},
+		{"add past min", add, math.MinInt64, -1, 0, true},
+		{"add max and min", add, math.MaxInt64, math.MinInt64, -1, false},
+		{"sub down to min", sub, math.MinInt64 + 1, 1, math.MinInt64, false},
+		{"sub past min", sub, math.MinInt64, 1, 0, true},
+		{"sub up to max", sub, math.MaxInt64 - 1, -1, math.MaxInt64, false},
+		{"sub past max", sub, math.MaxInt64, -1, 0, true},
+		{"sub min from zero", sub, 0, math.MinInt64, 0, true},
+		{"sub min from min", sub, math.MinInt64, math.MinInt64, 0, false},
+		{"mul max by one", mul, math.MaxInt64, 1, math.MaxInt64, false},
+		{"mul max by minus one", mul, math.MaxInt64, -1, -math.MaxInt64, false},
+		{"mul max by two", mul, math.MaxInt64, 2, 0, true},
+		{"mul half max by two", mul, math.MaxInt64 / 2, 2, math.MaxInt64 - 1, false},
+		{"mul min by one", mul, math.MinInt64, 1, math.MinInt64, false},
+		{"mul min by minus one", mul, math.MinInt64, -1, 0, true},
+		{"mul minus one by min", mul, -1, math.MinInt64, 0, true},
+		{"mul min by two", mul, math.MinInt64, 2, 0, true},
+		{"mul min by zero", mul, math.MinInt64, 0, 0, false},
+		{"mul large by large", mul, 1 << 32, 1 << 32, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.op(tt.a, tt.b)
+			if tt.wantErr {
+				if !errors.Is(err, money.ErrOverflow) {
+					t.Fatalf("error = %v (result %s), want ErrOverflow", err, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if got != usd(tt.want) {
+				t.Errorf("result = %s, want %s", got, usd(tt.want))
+			}
+		})
+	}
+}
+
+func TestCurrencyMismatch(t *testing.T) {
+	usd, eur := money.New(100, money.USD), money.New(100, money.EUR)
+
+	if _, err := usd.Add(eur); !errors.Is(err, money.ErrCurrencyMismatch) {
+		t.Errorf("Add() error = %v, want ErrCurrencyMismatch", err)
+	}
+	if _, err := usd.Sub(eur); !errors.Is(err, money.ErrCurrencyMismatch) {
+		t.Errorf("Sub() error = %v, want ErrCurrencyMismatch", err)
+	}
+	if _, err := usd.Cmp(eur); !errors.Is(err, money.ErrCurrencyMismatch) {
+		t.Errorf("Cmp() error = %v, want ErrCurrencyMismatch", err)
+	}
+	// No money in a currency still has that currency.
+	if _, err := money.Zero(money.USD).Add(eur); !errors.Is(err, money.ErrCurrencyMismatch) {
+		t.Errorf("Zero(USD).Add(EUR) error = %v, want ErrCurrencyMismatch", err)
+	}
+}
+
+func TestZeroValueAdoptsCurrency(t *testing.T) {
+	eur := money.New(250, money.EUR)
+
+	var sum money.Money
+	sum, err := sum.Add(eur)
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if sum != eur {
+		t.Errorf("zero + %s = %s, want %s", eur, sum, eur)
+	}
+
+	got, err := eur.Add(money.Money{})
+	if err != nil || got != eur {
+		t.Errorf("%s + zero = %s, %v, want %s", eur, got, err, eur)
+	}
+	got, err = money.Money{}.Sub(eur)
+	if err != nil || got != money.New(-250, money.EUR) {
+		t.Errorf("zero - %s = %s, %v, want -2.50 EUR", eur, got, err)
+	}
+	if c, err := (money.Money{}).Cmp(eur); err != nil || c != -1 {
+		t.Errorf("Cmp(zero, %s) = %d, %v, want -1", eur, c, err)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  int64
+		weights []int64
+		want    []int64
+	}{
+		{"even", 300, []int64{1, 1, 1}, []int64{100, 100, 100}},
+		{"remainder goes first to last", 100, []int64{1, 1, 1}, []int64{34, 33, 33}},
+		{"uneven weights", 1000, []int64{1, 2, 3}, []int64{167, 333, 500}},
+		{"proportional", 1001, []int64{250, 750}, []int64{251, 750}},
+		{"zero weight gets nothing", 100, []int64{0, 1, 0, 2}, []int64{0, 34, 0, 66}},
+		{"all weights zero", 100, []int64{0, 0}, []int64{0, 0}},
+		{"single part", 99, []int64{7}, []int64{99}},
+		{"no weights", 100, nil, []int64{}},
+		{"less than one unit each", 2, []int64{1, 1, 1}, []int64{1, 1, 0}},
+		{"negative", -100, []int64{1, 1, 1}, []int64{-34, -33, -33}},
+		{"max amount", math.MaxInt64, []int64{1, 1}, []int64{math.MaxInt64/2 + 1, math.MaxInt64 / 2}},
+		{"min amount", math.MinInt64, []int64{1, 2}, []int64{-3074457345618258603, -6148914691236517205}},
+		{"large weights", 10, []int64{math.MaxInt64, math.MaxInt64}, []int64{5, 5}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts := money.New(tt.amount, money.USD).Split(tt.weights...)
+			if len(parts) != len(tt.want) {
+				t.Fatalf("parts = %v, want %d of them", parts, len(tt.want))
+			}
+
+			var sum money.Money
+			for i, part := range parts {
+				if want := money.New(tt.want[i], money.USD); part != want {
+					t.Errorf("part[%d] = %s, want %s", i, part, want)
+				}
+				sum, _ = sum.Add(part)
+			}
+			allZero := true
+			for _, w := range tt.weights {
+				allZero = allZero && w == 0
+			}
+			if !allZero && sum.Amount() != tt.amount {
+				t.Errorf("parts sum to %s, want %s", sum, money.New(tt.amount, money.USD))
+			}
+		})
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		m    money.Money
+		want string
+	}{
+		{money.New(1250, money.USD), "12.50 USD"},
+		{money.New(5, money.USD), "0.05 USD"},
+		{money.New(0, money.USD), "0.00 USD"},
+		{money.New(-1250, money.USD), "-12.50 USD"},
+		{money.New(-5, money.USD), "-0.05 USD"},
+		{money.New(1250, money.JPY), "1250 JPY"},
+		{money.New(-1250, money.JPY), "-1250 JPY"},
+		{money.New(0, money.JPY), "0 JPY"},
+		{money.New(12345, "KWD"), "12.345 KWD"},
+		{money.New(5, "KWD"), "0.005 KWD"},
+		{money.New(-5, "KWD"), "-0.005 KWD"},
+		{money.New(math.MinInt64, money.USD), "-92233720368547758.08 USD"},
+		{money.Money{}, "0"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.String(); got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+	}
+}
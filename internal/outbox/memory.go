@@ -0,0 +1,47 @@
+package outbox
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Kosench/ecommerce-lab/internal/model"
+)
+
+// MemoryPublisher keeps published events in memory. It is meant for tests;
+// FailWith makes subsequent publishes fail until it is called with nil.
+type MemoryPublisher struct {
+	mu     sync.Mutex
+	events []model.Event
+	err    error
+}
+
+func NewMemoryPublisher() *MemoryPublisher {
+	return &MemoryPublisher{}
+}
+
+func (p *MemoryPublisher) Publish(_ context.Context, event model.Event) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return p.err
+	}
+	p.events = append(p.events, event)
+	return nil
+}
+
+func (p *MemoryPublisher) FailWith(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+// Events returns a copy of everything published so far, in publish order.
+func (p *MemoryPublisher) Events() []model.Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	out := make([]model.Event, len(p.events))
+	copy(out, p.events)
+	return out
+}
@@ -0,0 +1,98 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/model"
+)
+
+// Publisher delivers a single event downstream. Delivery is at least once:
+// an event may be published again if recording its success fails, so
+// consumers should deduplicate by event ID.
+type Publisher interface {
+	Publish(ctx context.Context, event model.Event) error
+}
+
+type envelope struct {
+	ID            int64           `json:"id"`
+	Type          string          `json:"type"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   string          `json:"aggregate_id"`
+	Payload       json.RawMessage `json:"payload"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// WriterPublisher writes every event as a JSON line to an io.Writer.
+type WriterPublisher struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterPublisher(w io.Writer) *WriterPublisher {
+	return &WriterPublisher{w: w}
+}
+
+func NewStdoutPublisher() *WriterPublisher {
+	return NewWriterPublisher(os.Stdout)
+}
+
+// NewFilePublisher appends events to the file at path.
+func NewFilePublisher(path string) (*WriterPublisher, io.Closer, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open outbox file: %w", err)
+	}
+	return NewWriterPublisher(f), f, nil
+}
+
+func (p *WriterPublisher) Publish(_ context.Context, event model.Event) error {
+	b, err := json.Marshal(envelope{
+		ID:            event.ID,
+		Type:          event.Type,
+		AggregateType: event.AggregateType,
+		AggregateID:   event.AggregateID,
+		Payload:       event.Payload,
+		CreatedAt:     event.CreatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal event: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.w.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("write event: %w", err)
+	}
+	return nil
+}
+
+// NopPublisher drops every event.
+type NopPublisher struct{}
+
+func (NopPublisher) Publish(context.Context, model.Event) error { return nil }
+
+// FanOut publishes every event to all publishers. If any of them fails the
+// event is retried for all, so each publisher must tolerate duplicates.
+func FanOut(publishers ...Publisher) Publisher {
+	return fanOut(publishers)
+}
+
+type fanOut []Publisher
+
+func (f fanOut) Publish(ctx context.Context, event model.Event) error {
+	var errs []error
+	for _, p := range f {
+		if err := p.Publish(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
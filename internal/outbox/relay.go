@@ -0,0 +1,94 @@
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/repository"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"go.uber.org/zap"
+)
+
+type RelayConfig struct {
+	PollInterval time.Duration
+	BatchSize    int
+	MinBackoff   time.Duration
+	MaxBackoff   time.Duration
+}
+
+// Relay moves events from the outbox table to a Publisher.
+type Relay struct {
+	repo      repository.OutboxRepository
+	publisher Publisher
+	cfg       RelayConfig
+	logger    logger.Logger
+}
+
+func NewRelay(repo repository.OutboxRepository, publisher Publisher, cfg RelayConfig, logger logger.Logger) *Relay {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 100
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = time.Second
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = 5 * time.Minute
+	}
+
+	return &Relay{
+		repo:      repo,
+		publisher: publisher,
+		cfg:       cfg,
+		logger:    logger.With(zap.String("component", "outbox")),
+	}
+}
+
+// Run polls the outbox until ctx is cancelled. A full batch is followed by
+// another poll right away so a backlog drains without waiting.
+func (r *Relay) Run(ctx context.Context) {
+	r.logger.Info("outbox relay started",
+		zap.Duration("poll_interval", r.cfg.PollInterval),
+		zap.Int("batch_size", r.cfg.BatchSize),
+	)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.logger.Info("outbox relay stopped")
+			return
+		case <-timer.C:
+		}
+
+		published, err := r.repo.Dispatch(ctx, r.cfg.BatchSize, r.publisher.Publish, r.retryAt)
+		if err != nil && ctx.Err() == nil {
+			r.logger.Error("outbox dispatch failed",
+				zap.Error(err),
+			)
+		}
+		if published > 0 {
+			r.logger.Debug("outbox events published",
+				zap.Int("count", published),
+			)
+		}
+
+		if err == nil && published == r.cfg.BatchSize {
+			timer.Reset(0)
+		} else {
+			timer.Reset(r.cfg.PollInterval)
+		}
+	}
+}
+
+func (r *Relay) retryAt(attempts int) time.Time {
+	backoff := r.cfg.MinBackoff
+	for i := 1; i < attempts && backoff < r.cfg.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	return time.Now().Add(min(backoff, r.cfg.MaxBackoff))
+}
@@ -0,0 +1,145 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Kosench/ecommerce-lab/internal/money"
+)
+
+// Magic card numbers understood by Fake. Any other payment method succeeds.
+const (
+	CardSuccess           = "4242424242424242"
+	CardDeclined          = "4000000000000002"
+	CardInsufficientFunds = "4000000000009995"
+	CardCaptureDeclined   = "4000000000000341"
+	CardProviderError     = "4000000000000119"
+)
+
+// FakeAmountLimit is the largest amount, in minor units, Fake authorizes;
+// larger amounts are declined with amount_too_large.
+const FakeAmountLimit = 1_000_000_00
+
+var errFakeUnavailable = errors.New("fake provider: simulated processing error")
+
+// Fake is an in-memory PaymentProvider with deterministic outcomes, for
+// local runs and tests. Decline codes mimic a card processor's.
+type Fake struct {
+	mu    sync.Mutex
+	seq   int
+	auths map[string]*fakeAuthorization
+	caps  map[string]*fakeAuthorization
+}
+
+type fakeAuthorization struct {
+	method   string
+	amount   money.Money
+	captured money.Money
+	refunded money.Money
+	voided   bool
+}
+
+func NewFake() *Fake {
+	return &Fake{
+		auths: make(map[string]*fakeAuthorization),
+		caps:  make(map[string]*fakeAuthorization),
+	}
+}
+
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+func (f *Fake) Authorize(ctx context.Context, req AuthorizeRequest) (Transaction, error) {
+	switch {
+	case req.PaymentMethod == CardDeclined:
+		return Transaction{}, &DeclineError{Code: "card_declined", Message: "the card was declined"}
+	case req.PaymentMethod == CardInsufficientFunds:
+		return Transaction{}, &DeclineError{Code: "insufficient_funds", Message: "the card has insufficient funds"}
+	case req.PaymentMethod == CardProviderError:
+		return Transaction{}, errFakeUnavailable
+	case !req.Amount.IsPositive():
+		return Transaction{}, &DeclineError{Code: "invalid_amount", Message: "amount must be positive"}
+	case !req.Amount.Currency().IsValid():
+		return Transaction{}, &DeclineError{Code: "invalid_currency", Message: "unsupported currency"}
+	case req.Amount.Amount() > FakeAmountLimit:
+		return Transaction{}, &DeclineError{Code: "amount_too_large", Message: "amount exceeds the card limit"}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := f.nextID("auth")
+	f.auths[id] = &fakeAuthorization{method: req.PaymentMethod, amount: req.Amount, refunded: money.Zero(req.Amount.Currency())}
+	return Transaction{ID: id}, nil
+}
+
+func (f *Fake) Capture(ctx context.Context, authorizationID string, amount money.Money) (Transaction, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	auth, ok := f.auths[authorizationID]
+	switch {
+	case !ok:
+		return Transaction{}, &DeclineError{Code: "authorization_not_found", Message: "no such authorization"}
+	case auth.voided:
+		return Transaction{}, &DeclineError{Code: "authorization_voided", Message: "the authorization was voided"}
+	case auth.captured.IsPositive():
+		return Transaction{}, &DeclineError{Code: "already_captured", Message: "the authorization was already captured"}
+	case !amount.IsPositive() || !within(amount, auth.amount):
+		return Transaction{}, &DeclineError{Code: "invalid_amount", Message: "amount exceeds the authorized amount"}
+	case auth.method == CardCaptureDeclined:
+		return Transaction{}, &DeclineError{Code: "capture_declined", Message: "the issuer refused the capture"}
+	}
+
+	auth.captured = amount
+	id := f.nextID("cap")
+	f.caps[id] = auth
+	return Transaction{ID: id}, nil
+}
+
+func (f *Fake) Void(ctx context.Context, authorizationID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	auth, ok := f.auths[authorizationID]
+	switch {
+	case !ok:
+		return &DeclineError{Code: "authorization_not_found", Message: "no such authorization"}
+	case auth.captured.IsPositive():
+		return &DeclineError{Code: "already_captured", Message: "a captured authorization cannot be voided"}
+	}
+	auth.voided = true
+	return nil
+}
+
+func (f *Fake) Refund(ctx context.Context, captureID string, amount money.Money) (Transaction, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	auth, ok := f.caps[captureID]
+	if !ok {
+		return Transaction{}, &DeclineError{Code: "capture_not_found", Message: "no such capture"}
+	}
+	refunded, err := auth.refunded.Add(amount)
+	if err != nil || !amount.IsPositive() || !within(refunded, auth.captured) {
+		return Transaction{}, &DeclineError{Code: "invalid_amount", Message: "amount exceeds the unrefunded captured amount"}
+	}
+
+	auth.refunded = refunded
+	return Transaction{ID: f.nextID("ref")}, nil
+}
+
+// within reports whether amount is in limit's currency and at most limit.
+func within(amount, limit money.Money) bool {
+	c, err := amount.Cmp(limit)
+	return err == nil && c <= 0
+}
+
+// nextID returns sequential IDs, so runs are reproducible. f.mu must be held.
+func (f *Fake) nextID(kind string) string {
+	f.seq++
+	return fmt.Sprintf("fake_%s_%06d", kind, f.seq)
+}
@@ -0,0 +1,56 @@
+package payments
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/webhook"
+)
+
+// FakeSignatureHeader carries the signature of the fake provider's webhooks.
+const FakeSignatureHeader = "Fake-Signature"
+
+// FakeWebhooks stands in for the fake provider's webhook sender: it signs
+// events the way a provider would and verifies them on receipt. Signatures
+// use the same scheme as our own outbound webhooks.
+type FakeWebhooks struct {
+	secret string
+}
+
+func NewFakeWebhooks(secret string) *FakeWebhooks {
+	return &FakeWebhooks{secret: secret}
+}
+
+// Sign encodes e as sent at ts and returns the body and headers to POST.
+func (w *FakeWebhooks) Sign(e Event, ts time.Time) ([]byte, http.Header, error) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return nil, nil, fmt.Errorf("encode event: %w", err)
+	}
+	header := make(http.Header)
+	header.Set("Content-Type", "application/json")
+	header.Set(FakeSignatureHeader, webhook.Sign(w.secret, ts, body))
+	return body, header, nil
+}
+
+func (w *FakeWebhooks) VerifyWebhook(header http.Header, body []byte) (Event, error) {
+	err := webhook.Verify(w.secret, header.Get(FakeSignatureHeader), body, webhook.DefaultTolerance, time.Now())
+	if errors.Is(err, webhook.ErrInvalidSignature) {
+		return Event{}, ErrInvalidSignature
+	}
+	if err != nil {
+		return Event{}, fmt.Errorf("%w: %w", ErrInvalidSignature, err)
+	}
+
+	var e Event
+	if err := json.Unmarshal(body, &e); err != nil {
+		return Event{}, fmt.Errorf("%w: %w", ErrInvalidEvent, err)
+	}
+	if err := e.Validate(); err != nil {
+		return Event{}, err
+	}
+	return e, nil
+}
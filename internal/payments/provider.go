@@ -0,0 +1,59 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Kosench/ecommerce-lab/internal/money"
+)
+
+// PaymentProvider moves money through an external payment service. Refusals by the provider, such as a declined card, are
+// returned as *DeclineError; other errors mean the outcome is unknown.
+type PaymentProvider interface {
+	// Name identifies the provider in payment records and webhook routes.
+	Name() string
+	// Authorize places a hold on the customer's funds.
+	Authorize(ctx context.Context, req AuthorizeRequest) (Transaction, error)
+	// Capture collects up to the authorized amount.
+	Capture(ctx context.Context, authorizationID string, amount money.Money) (Transaction, error)
+	// Void releases an authorization that was not captured.
+	Void(ctx context.Context, authorizationID string) error
+	// Refund returns up to the captured amount.
+	Refund(ctx context.Context, captureID string, amount money.Money) (Transaction, error)
+}
+
+type AuthorizeRequest struct {
+	OrderID string
+	Amount  money.Money
+	// PaymentMethod is the provider's token for the card or account to
+	// charge.
+	PaymentMethod string
+}
+
+// Transaction is the provider's record of an operation.
+type Transaction struct {
+	ID string
+}
+
+var (
+	ErrPaymentDeclined = errors.New("payment declined")
+	// ErrProviderFailed wraps errors that leave the outcome of an operation
+	// unknown, such as timeouts.
+	ErrProviderFailed = errors.New("payment provider error")
+)
+
+// DeclineError is a refusal by the provider. Code is the provider's own
+// error code and is kept on the payment record.
+type DeclineError struct {
+	Code    string
+	Message string
+}
+
+func (e *DeclineError) Error() string {
+	return fmt.Sprintf("%s: %s (%s)", ErrPaymentDeclined, e.Message, e.Code)
+}
+
+func (e *DeclineError) Is(target error) bool {
+	return target == ErrPaymentDeclined
+}
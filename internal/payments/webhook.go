@@ -0,0 +1,63 @@
+package payments
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// EventType is the kind of payment change a provider reports by webhook.
+type EventType string
+
+const (
+	EventPaymentCaptured EventType = "payment.captured"
+	EventPaymentFailed   EventType = "payment.failed"
+	EventPaymentRefunded EventType = "payment.refunded"
+)
+
+func (t EventType) IsValid() bool {
+	switch t {
+	case EventPaymentCaptured, EventPaymentFailed, EventPaymentRefunded:
+		return true
+	}
+	return false
+}
+
+// Event is a provider notification about a payment, decoded from a verified
+// webhook. Providers may deliver an event more than once and in any order.
+type Event struct {
+	// ID is the provider's event ID, unique per provider.
+	ID      string    `json:"id"`
+	Type    EventType `json:"type"`
+	OrderID string    `json:"order_id"`
+	// AuthorizationID links the event to the payment it is about.
+	AuthorizationID string    `json:"authorization_id"`
+	CaptureID       string    `json:"capture_id,omitempty"`
+	Amount          int64     `json:"amount,omitempty"`
+	FailureCode     string    `json:"failure_code,omitempty"`
+	FailureMessage  string    `json:"failure_message,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// WebhookVerifier authenticates and decodes a provider's webhook requests.
+type WebhookVerifier interface {
+	VerifyWebhook(header http.Header, body []byte) (Event, error)
+}
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrInvalidEvent     = errors.New("invalid payment event")
+)
+
+func (e Event) Validate() error {
+	switch {
+	case e.ID == "":
+		return fmt.Errorf("%w: missing id", ErrInvalidEvent)
+	case !e.Type.IsValid():
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidEvent, e.Type)
+	case e.OrderID == "":
+		return fmt.Errorf("%w: missing order_id", ErrInvalidEvent)
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package policy
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/Kosench/ecommerce-lab/internal/auth"
+	"gopkg.in/yaml.v3"
+)
+
+// Actions the order service asks about.
+const (
+	ActionOrderCreate = "orders:create"
+	ActionOrderRead   = "orders:read"
+	ActionOrderList   = "orders:list"
+	ActionOrderPay    = "orders:pay"
+	ActionOrderCancel = "orders:cancel"
+	ActionOrderRefund = "orders:refund"
+)
+
+var actions = []string{
+	ActionOrderCreate,
+	ActionOrderRead,
+	ActionOrderList,
+	ActionOrderPay,
+	ActionOrderCancel,
+	ActionOrderRefund,
+}
+
+const (
+	// RoleService is held by every client authenticated with an API key.
+	RoleService = "service"
+	// Any matches every role, or every action, in a rule.
+	Any = "*"
+
+	// DefaultDenyRule names the decision for requests no rule allows.
+	DefaultDenyRule = "default-deny"
+)
+
+type Effect string
+
+const (
+	Allow Effect = "allow"
+	Deny  Effect = "deny"
+)
+
+// Policy is an ordered list of rules. A request is allowed if an allow rule
+// matches it and no deny rule does.
+type Policy struct {
+	Rules []Rule `json:"rules" yaml:"rules"`
+}
+
+type Rule struct {
+	Name    string     `json:"name" yaml:"name"`
+	Effect  Effect     `json:"effect" yaml:"effect"`
+	Roles   []string   `json:"roles" yaml:"roles"`
+	Actions []string   `json:"actions" yaml:"actions"`
+	When    Conditions `json:"when" yaml:"when"`
+}
+
+// Conditions narrow a rule to some resources. Unset conditions match all.
+type Conditions struct {
+	// Owner matches resources owned by the caller.
+	Owner bool `json:"owner" yaml:"owner"`
+	// Status matches resources in one of these statuses.
+	Status []string `json:"status" yaml:"status"`
+}
+
+// Resource is what an action is performed on.
+type Resource struct {
+	// OwnerID is the user the resource belongs to. It is empty for
+	// collections spanning users, which no caller owns.
+	OwnerID string
+	Status  string
+}
+
+type Decision struct {
+	Allowed bool
+	Rule    string
+}
+
+//go:embed default.yaml
+var defaultPolicy []byte
+
+// Default returns the built-in policy, used when no policy file is
+// configured.
+func Default() *Policy {
+	p, err := parse(defaultPolicy, decodeYAML)
+	if err != nil {
+		panic(fmt.Sprintf("policy: invalid default policy: %v", err))
+	}
+	return p
+}
+
+// Load reads a policy from a .json, .yaml or .yml file.
+func Load(path string) (*Policy, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read policy: %w", err)
+	}
+
+	switch filepath.Ext(path) {
+	case ".json":
+		return parse(b, decodeJSON)
+	case ".yaml", ".yml":
+		return parse(b, decodeYAML)
+	}
+	return nil, fmt.Errorf("policy file %s: extension must be .json, .yaml or .yml", path)
+}
+
+func parse(b []byte, decode func([]byte, any) error) (*Policy, error) {
+	var p Policy
+	if err := decode(b, &p); err != nil {
+		return nil, fmt.Errorf("parse policy: %w", err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// A misspelt key would otherwise be dropped silently, leaving a rule broader
+// than intended, so policies are decoded strictly.
+func decodeJSON(b []byte, v any) error {
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	return d.Decode(v)
+}
+
+func decodeYAML(b []byte, v any) error {
+	d := yaml.NewDecoder(bytes.NewReader(b))
+	d.KnownFields(true)
+	if err := d.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+func (p *Policy) validate() error {
+	if len(p.Rules) == 0 {
+		return errors.New("policy has no rules")
+	}
+
+	seen := make(map[string]bool, len(p.Rules))
+	for i, r := range p.Rules {
+		switch {
+		case r.Name == "":
+			return fmt.Errorf("rule %d: name is required", i)
+		case r.Name == DefaultDenyRule || seen[r.Name]:
+			return fmt.Errorf("rule %q: name is reserved or already used", r.Name)
+		case r.Effect != Allow && r.Effect != Deny:
+			return fmt.Errorf("rule %q: effect must be allow or deny", r.Name)
+		case len(r.Roles) == 0:
+			return fmt.Errorf("rule %q: roles are required", r.Name)
+		case len(r.Actions) == 0:
+			return fmt.Errorf("rule %q: actions are required", r.Name)
+		}
+		for _, action := range r.Actions {
+			if action != Any && !slices.Contains(actions, action) {
+				return fmt.Errorf("rule %q: unknown action %q", r.Name, action)
+			}
+		}
+		seen[r.Name] = true
+	}
+	return nil
+}
+
+// Decide evaluates the policy for principal performing action on res.
+func (p *Policy) Decide(principal *auth.Principal, action string, res Resource) Decision {
+	roles := subjectRoles(principal)
+
+	allowedBy := ""
+	for _, r := range p.Rules {
+		if !r.matches(roles, principal, action, res) {
+			continue
+		}
+		if r.Effect == Deny {
+			return Decision{Allowed: false, Rule: r.Name}
+		}
+		if allowedBy == "" {
+			allowedBy = r.Name
+		}
+	}
+	if allowedBy != "" {
+		return Decision{Allowed: true, Rule: allowedBy}
+	}
+	return Decision{Allowed: false, Rule: DefaultDenyRule}
+}
+
+func (r *Rule) matches(roles []string, principal *auth.Principal, action string, res Resource) bool {
+	if !slices.Contains(r.Roles, Any) && !slices.ContainsFunc(r.Roles, func(role string) bool {
+		return slices.Contains(roles, role)
+	}) {
+		return false
+	}
+	if !slices.Contains(r.Actions, Any) && !slices.Contains(r.Actions, action) {
+		return false
+	}
+	if r.When.Owner && (res.OwnerID == "" || res.OwnerID != principal.UserID) {
+		return false
+	}
+	if len(r.When.Status) > 0 && !slices.Contains(r.When.Status, res.Status) {
+		return false
+	}
+	return true
+}
+
+// subjectRoles are the roles a principal holds for policy purposes: its
+// token roles, plus service for API key clients and admin for keys with the
+// admin scope.
+func subjectRoles(p *auth.Principal) []string {
+	roles := slices.Clone(p.Roles)
+	if p.IsService() {
+		roles = append(roles, RoleService)
+	}
+	if p.IsAdmin() && !slices.Contains(roles, auth.RoleAdmin) {
+		roles = append(roles, auth.RoleAdmin)
+	}
+	return roles
+}
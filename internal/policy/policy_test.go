@@ -0,0 +1,144 @@
+package policy_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Kosench/ecommerce-lab/internal/auth"
+	"github.com/Kosench/ecommerce-lab/internal/policy"
+)
+
+func TestDefaultPolicyDecide(t *testing.T) {
+	const (
+		owner = "11111111-1111-1111-1111-111111111111"
+		other = "22222222-2222-2222-2222-222222222222"
+	)
+	user := &auth.Principal{UserID: owner}
+	support := &auth.Principal{UserID: owner, Roles: []string{"support"}}
+	finance := &auth.Principal{UserID: other, Roles: []string{"finance"}}
+
+	tests := []struct {
+		name        string
+		principal   *auth.Principal
+		action      string
+		res         policy.Resource
+		wantAllowed bool
+		wantRule    string
+	}{
+		{"admin may do anything", &auth.Principal{UserID: other, Roles: []string{auth.RoleAdmin}}, policy.ActionOrderRefund, policy.Resource{OwnerID: owner, Status: "paid"}, true, "admin-full-access"},
+		{"admin-scoped key counts as admin", &auth.Principal{APIKeyID: "k1", Scopes: []string{auth.ScopeAdmin}}, policy.ActionOrderList, policy.Resource{}, true, "admin-full-access"},
+		{"service key", &auth.Principal{APIKeyID: "k1", Scopes: []string{auth.ScopeOrdersRead}}, policy.ActionOrderRead, policy.Resource{OwnerID: owner}, true, "service-clients"},
+		{"owner reads own order", user, policy.ActionOrderRead, policy.Resource{OwnerID: owner, Status: "paid"}, true, "owner-access"},
+		{"owner cancels own order", user, policy.ActionOrderCancel, policy.Resource{OwnerID: owner, Status: "pending"}, true, "owner-access"},
+		{"other user's order is denied by default", user, policy.ActionOrderRead, policy.Resource{OwnerID: other}, false, policy.DefaultDenyRule},
+		{"nobody owns a collection", user, policy.ActionOrderList, policy.Resource{}, false, policy.DefaultDenyRule},
+		{"owner may not refund", user, policy.ActionOrderRefund, policy.Resource{OwnerID: owner, Status: "paid"}, false, policy.DefaultDenyRule},
+		{"support reads any order", support, policy.ActionOrderRead, policy.Resource{OwnerID: other}, true, "support-read"},
+		{"support cancels a pending order", support, policy.ActionOrderCancel, policy.Resource{OwnerID: other, Status: "pending"}, true, "support-cancel-pending"},
+		{"support cancelling a paid order is denied by default", support, policy.ActionOrderCancel, policy.Resource{OwnerID: other, Status: "paid"}, false, policy.DefaultDenyRule},
+		{"finance refunds a paid order", finance, policy.ActionOrderRefund, policy.Resource{OwnerID: owner, Status: "paid"}, true, "finance-refund"},
+		{"finance refunds a partially refunded order", finance, policy.ActionOrderRefund, policy.Resource{OwnerID: owner, Status: "partially_refunded"}, true, "finance-refund"},
+		{"finance may not refund a pending order", finance, policy.ActionOrderRefund, policy.Resource{OwnerID: owner, Status: "pending"}, false, policy.DefaultDenyRule},
+	}
+
+	p := policy.Default()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := p.Decide(tt.principal, tt.action, tt.res)
+			if d.Allowed != tt.wantAllowed || d.Rule != tt.wantRule {
+				t.Errorf("Decide() = %+v, want allowed %t by %s", d, tt.wantAllowed, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestDecideDenyOverridesAllow(t *testing.T) {
+	p := &policy.Policy{Rules: []policy.Rule{
+		{Name: "owner", Effect: policy.Allow, Roles: []string{policy.Any}, Actions: []string{policy.Any}, When: policy.Conditions{Owner: true}},
+		{Name: "support", Effect: policy.Allow, Roles: []string{"support"}, Actions: []string{policy.ActionOrderCancel}},
+		{Name: "no-refunded", Effect: policy.Deny, Roles: []string{policy.Any}, Actions: []string{policy.ActionOrderCancel}, When: policy.Conditions{Status: []string{"refunded"}}},
+	}}
+	support := &auth.Principal{UserID: "u1", Roles: []string{"support"}}
+
+	tests := []struct {
+		name        string
+		res         policy.Resource
+		wantAllowed bool
+		wantRule    string
+	}{
+		{"first matching allow decides", policy.Resource{OwnerID: "u1", Status: "pending"}, true, "owner"},
+		{"later allow applies when earlier ones do not match", policy.Resource{OwnerID: "u2", Status: "pending"}, true, "support"},
+		{"deny wins over every allow", policy.Resource{OwnerID: "u1", Status: "refunded"}, false, "no-refunded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := p.Decide(support, policy.ActionOrderCancel, tt.res)
+			if d.Allowed != tt.wantAllowed || d.Rule != tt.wantRule {
+				t.Errorf("Decide() = %+v, want allowed %t by %s", d, tt.wantAllowed, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		body    string
+		wantErr string
+	}{
+		{
+			name: "yaml",
+			file: "policy.yaml",
+			body: "rules:\n  - {name: all, effect: allow, roles: [\"*\"], actions: [\"*\"]}\n",
+		},
+		{
+			name: "json",
+			file: "policy.json",
+			body: `{"rules": [{"name": "read", "effect": "allow", "roles": ["support"], "actions": ["orders:read"], "when": {"status": ["paid"]}}]}`,
+		},
+		{
+			name:    "unknown yaml field",
+			file:    "policy.yaml",
+			body:    "rules:\n  - {name: own, effect: allow, roles: [\"*\"], actions: [orders:read], whne: {owner: true}}\n",
+			wantErr: "field whne not found",
+		},
+		{
+			name:    "unknown json field",
+			file:    "policy.json",
+			body:    `{"rules": [{"name": "own", "effect": "allow", "roles": ["*"], "actions": ["orders:read"], "when": {"owned": true}}]}`,
+			wantErr: `unknown field "owned"`,
+		},
+		{
+			name:    "unknown action",
+			file:    "policy.yaml",
+			body:    "rules:\n  - {name: read, effect: allow, roles: [support], actions: [order:read]}\n",
+			wantErr: `unknown action "order:read"`,
+		},
+		{
+			name:    "empty",
+			file:    "policy.yaml",
+			body:    "",
+			wantErr: "no rules",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.body), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := policy.Load(path)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Load() error = %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("Load() error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+type APIKeyRepository interface {
+	Create(ctx context.Context, key *model.APIKey) error
+	GetByHash(ctx context.Context, hash string) (*model.APIKey, error)
+	List(ctx context.Context) ([]*model.APIKey, error)
+	// Revoke marks a key revoked. Revoking a revoked key keeps the original
+	// revocation time.
+	Revoke(ctx context.Context, id string) (*model.APIKey, error)
+	TouchLastUsed(ctx context.Context, id string, at time.Time) error
+}
+
+type pgAPIKeyRepository struct {
+	pool   *pgxpool.Pool
+	logger logger.Logger
+}
+
+func NewAPIKeyRepository(pool *pgxpool.Pool, logger logger.Logger) APIKeyRepository {
+	return &pgAPIKeyRepository{
+		pool:   pool,
+		logger: logger.With(zap.String("component", "repository")),
+	}
+}
+
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+const apiKeyColumns = `id, prefix, key_hash, name, scopes, expires_at, last_used_at, revoked_at, created_at`
+
+func scanAPIKey(row pgx.Row) (*model.APIKey, error) {
+	var k model.APIKey
+	if err := row.Scan(&k.ID, &k.Prefix, &k.Hash, &k.Name, &k.Scopes, &k.ExpiresAt, &k.LastUsedAt, &k.RevokedAt, &k.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+func (r *pgAPIKeyRepository) Create(ctx context.Context, key *model.APIKey) error {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `INSERT INTO api_keys (` + apiKeyColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	_, err := r.pool.Exec(ctx, q, key.ID, key.Prefix, key.Hash, key.Name, key.Scopes, key.ExpiresAt, key.LastUsedAt, key.RevokedAt, key.CreatedAt)
+	if err != nil {
+		log.Error("failed to insert api key",
+			zap.Error(err),
+			zap.String("api_key_id", key.ID),
+		)
+		return fmt.Errorf("insert api key: %w", err)
+	}
+	return nil
+}
+
+func (r *pgAPIKeyRepository) GetByHash(ctx context.Context, hash string) (*model.APIKey, error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `SELECT ` + apiKeyColumns + ` FROM api_keys WHERE key_hash = $1`
+	key, err := scanAPIKey(r.pool.QueryRow(ctx, q, hash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		log.Error("failed to select api key",
+			zap.Error(err),
+		)
+		return nil, fmt.Errorf("select api key: %w", err)
+	}
+	return key, nil
+}
+
+func (r *pgAPIKeyRepository) List(ctx context.Context) ([]*model.APIKey, error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY created_at, id`
+	rows, err := r.pool.Query(ctx, q)
+	if err != nil {
+		log.Error("failed to query api keys",
+			zap.Error(err),
+		)
+		return nil, fmt.Errorf("query api keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []*model.APIKey
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan api key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate api keys: %w", err)
+	}
+	return keys, nil
+}
+
+func (r *pgAPIKeyRepository) Revoke(ctx context.Context, id string) (*model.APIKey, error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `UPDATE api_keys SET revoked_at = COALESCE(revoked_at, NOW()) WHERE id = $1 RETURNING ` + apiKeyColumns
+	key, err := scanAPIKey(r.pool.QueryRow(ctx, q, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		log.Error("failed to revoke api key",
+			zap.Error(err),
+			zap.String("api_key_id", id),
+		)
+		return nil, fmt.Errorf("revoke api key: %w", err)
+	}
+	return key, nil
+}
+
+func (r *pgAPIKeyRepository) TouchLastUsed(ctx context.Context, id string, at time.Time) error {
+	q := `UPDATE api_keys SET last_used_at = $2 WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < $2)`
+	if _, err := r.pool.Exec(ctx, q, id, at); err != nil {
+		return fmt.Errorf("update api key last used: %w", err)
+	}
+	return nil
+}
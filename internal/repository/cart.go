@@ -0,0 +1,289 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+// CartRepository stores carts and their lines. Catalog names and prices are
+// not stored; the service fills them in when a cart is read.
+type CartRepository interface {
+	Create(ctx context.Context, cart *model.Cart) error
+	GetByID(ctx context.Context, id string) (*model.Cart, error)
+	AddItem(ctx context.Context, cartID, productID string, quantity int) error
+	SetItemQuantity(ctx context.Context, cartID, productID string, quantity int) error
+	RemoveItem(ctx context.Context, cartID, productID string) error
+	Merge(ctx context.Context, targetID, sourceID string) error
+}
+
+type pgCartRepository struct {
+	pool   *pgxpool.Pool
+	logger logger.Logger
+}
+
+func NewCartRepository(pool *pgxpool.Pool, logger logger.Logger) CartRepository {
+	return &pgCartRepository{
+		pool:   pool,
+		logger: logger.With(zap.String("component", "repository")),
+	}
+}
+
+var (
+	ErrCartNotFound     = errors.New("cart not found")
+	ErrCartItemNotFound = errors.New("cart item not found")
+)
+
+func (r *pgCartRepository) Create(ctx context.Context, cart *model.Cart) error {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `INSERT INTO carts (id, user_id, status, created_at, updated_at)
+	      VALUES ($1, NULLIF($2::text, '')::uuid, $3, $4, $5)`
+	_, err := r.pool.Exec(ctx, q, cart.ID, cart.UserID, cart.Status, cart.CreatedAt, cart.UpdatedAt)
+	if err != nil {
+		log.Error("failed to insert cart",
+			zap.Error(err),
+			zap.String("cart_id", cart.ID),
+		)
+		return fmt.Errorf("insert cart: %w", err)
+	}
+
+	log.Debug("cart inserted",
+		zap.String("cart_id", cart.ID),
+	)
+	return nil
+}
+
+func (r *pgCartRepository) GetByID(ctx context.Context, id string) (*model.Cart, error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `SELECT c.id, COALESCE(c.user_id::text, ''), c.status, COALESCE(o.id::text, ''), c.created_at, c.updated_at
+	      FROM carts c LEFT JOIN orders o ON o.cart_id = c.id
+	      WHERE c.id = $1`
+	var cart model.Cart
+	err := r.pool.QueryRow(ctx, q, id).Scan(&cart.ID, &cart.UserID, &cart.Status, &cart.OrderID, &cart.CreatedAt, &cart.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrCartNotFound
+	}
+	if err != nil {
+		log.Error("failed to select cart",
+			zap.Error(err),
+			zap.String("cart_id", id),
+		)
+		return nil, fmt.Errorf("select cart: %w", err)
+	}
+
+	q = `SELECT product_id, quantity FROM cart_items WHERE cart_id = $1 ORDER BY added_at, product_id`
+	rows, err := r.pool.Query(ctx, q, id)
+	if err != nil {
+		log.Error("failed to query cart items",
+			zap.Error(err),
+			zap.String("cart_id", id),
+		)
+		return nil, fmt.Errorf("query cart items: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item model.CartItem
+		if err := rows.Scan(&item.ProductID, &item.Quantity); err != nil {
+			return nil, fmt.Errorf("scan cart item: %w", err)
+		}
+		cart.Items = append(cart.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate cart items: %w", err)
+	}
+
+	return &cart, nil
+}
+
+// AddItem adds quantity of a product, on top of what the cart already holds.
+func (r *pgCartRepository) AddItem(ctx context.Context, cartID, productID string, quantity int) error {
+	return r.mutate(ctx, cartID, func(tx pgx.Tx) error {
+		q := `INSERT INTO cart_items (cart_id, product_id, quantity) VALUES ($1, $2, $3)
+		      ON CONFLICT (cart_id, product_id) DO UPDATE SET quantity = cart_items.quantity + EXCLUDED.quantity`
+		_, err := tx.Exec(ctx, q, cartID, productID, quantity)
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == pgForeignKeyViolation {
+			return ErrProductNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("upsert cart item: %w", err)
+		}
+		return nil
+	})
+}
+
+func (r *pgCartRepository) SetItemQuantity(ctx context.Context, cartID, productID string, quantity int) error {
+	return r.mutate(ctx, cartID, func(tx pgx.Tx) error {
+		q := `UPDATE cart_items SET quantity = $3 WHERE cart_id = $1 AND product_id = $2`
+		tag, err := tx.Exec(ctx, q, cartID, productID, quantity)
+		if err != nil {
+			return fmt.Errorf("update cart item: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrCartItemNotFound
+		}
+		return nil
+	})
+}
+
+func (r *pgCartRepository) RemoveItem(ctx context.Context, cartID, productID string) error {
+	return r.mutate(ctx, cartID, func(tx pgx.Tx) error {
+		q := `DELETE FROM cart_items WHERE cart_id = $1 AND product_id = $2`
+		tag, err := tx.Exec(ctx, q, cartID, productID)
+		if err != nil {
+			return fmt.Errorf("delete cart item: %w", err)
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrCartItemNotFound
+		}
+		return nil
+	})
+}
+
+// Merge moves the lines of an anonymous cart into the target cart, adding
+// up quantities of products both hold, and closes the source cart.
+func (r *pgCartRepository) Merge(ctx context.Context, targetID, sourceID string) error {
+	log := logger.WithContext(ctx, r.logger)
+
+	return r.mutate(ctx, targetID, func(tx pgx.Tx) error {
+		source, err := lockOpenCart(ctx, tx, sourceID)
+		if err != nil {
+			return err
+		}
+		if source.UserID != "" {
+			return model.ErrCartNotAnonymous
+		}
+
+		q := `INSERT INTO cart_items (cart_id, product_id, quantity)
+		      SELECT $1, product_id, quantity FROM cart_items WHERE cart_id = $2
+		      ON CONFLICT (cart_id, product_id) DO UPDATE SET quantity = cart_items.quantity + EXCLUDED.quantity`
+		if _, err := tx.Exec(ctx, q, targetID, sourceID); err != nil {
+			return fmt.Errorf("merge cart items: %w", err)
+		}
+
+		q = `UPDATE carts SET status = $2, updated_at = NOW() WHERE id = $1`
+		if _, err := tx.Exec(ctx, q, sourceID, model.CartMerged); err != nil {
+			return fmt.Errorf("close merged cart: %w", err)
+		}
+
+		log.Info("cart merged",
+			zap.String("cart_id", targetID),
+			zap.String("source_cart_id", sourceID),
+		)
+		return nil
+	})
+}
+
+// mutate runs fn in a transaction holding the lock on an open cart, so
+// changes are serialised with each other and with checkout.
+func (r *pgCartRepository) mutate(ctx context.Context, cartID string, fn func(tx pgx.Tx) error) (err error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		log.Error("failed to begin transaction",
+			zap.Error(err),
+		)
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		}
+	}()
+
+	if _, err = lockOpenCart(ctx, tx, cartID); err != nil {
+		return err
+	}
+	if err = fn(tx); err != nil {
+		return err
+	}
+
+	q := `UPDATE carts SET updated_at = NOW() WHERE id = $1`
+	if _, err = tx.Exec(ctx, q, cartID); err != nil {
+		return fmt.Errorf("touch cart: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		log.Error("failed to commit transaction",
+			zap.Error(err),
+			zap.String("cart_id", cartID),
+		)
+		return fmt.Errorf("commit tx: %w", err)
+	}
+	return nil
+}
+
+// lockOpenCart locks a cart row for the rest of tx and checks it can still
+// change.
+func lockOpenCart(ctx context.Context, tx pgx.Tx, id string) (*model.Cart, error) {
+	q := `SELECT id, COALESCE(user_id::text, ''), status FROM carts WHERE id = $1 FOR UPDATE`
+	var cart model.Cart
+	err := tx.QueryRow(ctx, q, id).Scan(&cart.ID, &cart.UserID, &cart.Status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrCartNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lock cart: %w", err)
+	}
+	if cart.Status != model.CartOpen {
+		return nil, model.ErrCartNotOpen
+	}
+	return &cart, nil
+}
+
+// checkoutCart closes the cart an order is placed from, inside the order's
+// transaction. The cart lock serialises this with cart changes; if the lines
+// no longer match what the order was built from, the checkout is refused.
+func checkoutCart(ctx context.Context, tx pgx.Tx, order *model.Order) error {
+	if _, err := lockOpenCart(ctx, tx, order.CartID); err != nil {
+		return err
+	}
+
+	q := `SELECT product_id, quantity FROM cart_items WHERE cart_id = $1`
+	rows, err := tx.Query(ctx, q, order.CartID)
+	if err != nil {
+		return fmt.Errorf("query cart items: %w", err)
+	}
+	inCart := make(map[string]int)
+	for rows.Next() {
+		var (
+			productID string
+			quantity  int
+		)
+		if err := rows.Scan(&productID, &quantity); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan cart item: %w", err)
+		}
+		inCart[productID] = quantity
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate cart items: %w", err)
+	}
+
+	ordered := make(map[string]int, len(order.Items))
+	for _, item := range order.Items {
+		ordered[item.ProductID] += item.Quantity
+	}
+	if !maps.Equal(inCart, ordered) {
+		return model.ErrCartChanged
+	}
+
+	q = `UPDATE carts SET status = $2, updated_at = NOW() WHERE id = $1`
+	if _, err := tx.Exec(ctx, q, order.CartID, model.CartCheckedOut); err != nil {
+		return fmt.Errorf("close cart: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/internal/money"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrCouponNotFound  = errors.New("coupon not found")
+	ErrCouponCodeTaken = errors.New("coupon code is already in use")
+)
+
+type CouponRepository interface {
+	Create(ctx context.Context, coupon *model.Coupon) error
+	GetByCode(ctx context.Context, code string) (*model.Coupon, error)
+	// GetByCodes returns the coupons that exist among codes, keyed by code.
+	GetByCodes(ctx context.Context, codes []string) (map[string]*model.Coupon, error)
+	List(ctx context.Context, filter CouponFilter) ([]*model.Coupon, error)
+	// Update saves whether the coupon is active and when it ends.
+	Update(ctx context.Context, coupon *model.Coupon) error
+}
+
+type CouponFilter struct {
+	ActiveOnly bool
+	Limit      int
+	Offset     int
+}
+
+type pgCouponRepository struct {
+	pool   *pgxpool.Pool
+	logger logger.Logger
+}
+
+func NewCouponRepository(pool *pgxpool.Pool, logger logger.Logger) CouponRepository {
+	return &pgCouponRepository{
+		pool:   pool,
+		logger: logger.With(zap.String("component", "repository")),
+	}
+}
+
+const couponColumns = `id, code, type, percent_off, amount_off, buy_quantity, get_quantity, currency, min_subtotal,
+	product_ids, max_redemptions, max_redemptions_per_user, starts_at, ends_at, active, created_at, updated_at`
+
+func scanCoupon(row pgx.Row) (*model.Coupon, error) {
+	var (
+		c                      model.Coupon
+		amountOff, minSubtotal int64
+		currency               money.Currency
+	)
+	err := row.Scan(&c.ID, &c.Code, &c.Type, &c.PercentOff, &amountOff, &c.BuyQuantity, &c.GetQuantity, &currency, &minSubtotal,
+		&c.ProductIDs, &c.MaxRedemptions, &c.MaxRedemptionsPerUser, &c.StartsAt, &c.EndsAt, &c.Active, &c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	c.AmountOff = money.New(amountOff, currency)
+	c.MinSubtotal = money.New(minSubtotal, currency)
+	return &c, nil
+}
+
+func (r *pgCouponRepository) Create(ctx context.Context, c *model.Coupon) error {
+	log := logger.WithContext(ctx, r.logger)
+
+	// A nil slice would be stored as NULL.
+	productIDs := c.ProductIDs
+	if productIDs == nil {
+		productIDs = []string{}
+	}
+
+	q := `INSERT INTO coupons (` + couponColumns + `)
+	      VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)`
+	_, err := r.pool.Exec(ctx, q, c.ID, c.Code, c.Type, c.PercentOff, c.AmountOff.Amount(), c.BuyQuantity, c.GetQuantity,
+		c.Currency(), c.MinSubtotal.Amount(), productIDs, c.MaxRedemptions, c.MaxRedemptionsPerUser,
+		c.StartsAt, c.EndsAt, c.Active, c.CreatedAt, c.UpdatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation {
+		return ErrCouponCodeTaken
+	}
+	if err != nil {
+		log.Error("failed to insert coupon",
+			zap.Error(err),
+			zap.String("coupon_id", c.ID),
+		)
+		return fmt.Errorf("insert coupon: %w", err)
+	}
+
+	log.Debug("coupon inserted",
+		zap.String("coupon_id", c.ID),
+	)
+	return nil
+}
+
+func (r *pgCouponRepository) GetByCode(ctx context.Context, code string) (*model.Coupon, error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `SELECT ` + couponColumns + ` FROM coupons WHERE code = $1`
+	coupon, err := scanCoupon(r.pool.QueryRow(ctx, q, code))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrCouponNotFound
+	}
+	if err != nil {
+		log.Error("failed to select coupon",
+			zap.Error(err),
+			zap.String("code", code),
+		)
+		return nil, fmt.Errorf("select coupon: %w", err)
+	}
+	return coupon, nil
+}
+
+func (r *pgCouponRepository) GetByCodes(ctx context.Context, codes []string) (map[string]*model.Coupon, error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `SELECT ` + couponColumns + ` FROM coupons WHERE code = ANY($1)`
+	rows, err := r.pool.Query(ctx, q, codes)
+	if err != nil {
+		log.Error("failed to query coupons",
+			zap.Error(err),
+			zap.Int("codes_count", len(codes)),
+		)
+		return nil, fmt.Errorf("query coupons: %w", err)
+	}
+	defer rows.Close()
+
+	coupons := make(map[string]*model.Coupon, len(codes))
+	for rows.Next() {
+		coupon, err := scanCoupon(rows)
+		if err != nil {
+			log.Error("failed to scan coupon",
+				zap.Error(err),
+			)
+			return nil, fmt.Errorf("scan coupon: %w", err)
+		}
+		coupons[coupon.Code] = coupon
+	}
+	if err := rows.Err(); err != nil {
+		log.Error("error iterating coupons",
+			zap.Error(err),
+		)
+		return nil, fmt.Errorf("iterate coupons: %w", err)
+	}
+
+	return coupons, nil
+}
+
+func (r *pgCouponRepository) List(ctx context.Context, filter CouponFilter) ([]*model.Coupon, error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `SELECT ` + couponColumns + ` FROM coupons
+	      WHERE NOT $1 OR active
+	      ORDER BY code
+	      LIMIT $2 OFFSET $3`
+	rows, err := r.pool.Query(ctx, q, filter.ActiveOnly, filter.Limit, filter.Offset)
+	if err != nil {
+		log.Error("failed to query coupons",
+			zap.Error(err),
+		)
+		return nil, fmt.Errorf("query coupons: %w", err)
+	}
+	defer rows.Close()
+
+	var coupons []*model.Coupon
+	for rows.Next() {
+		coupon, err := scanCoupon(rows)
+		if err != nil {
+			log.Error("failed to scan coupon",
+				zap.Error(err),
+			)
+			return nil, fmt.Errorf("scan coupon: %w", err)
+		}
+		coupons = append(coupons, coupon)
+	}
+	if err := rows.Err(); err != nil {
+		log.Error("error iterating coupons",
+			zap.Error(err),
+		)
+		return nil, fmt.Errorf("iterate coupons: %w", err)
+	}
+
+	return coupons, nil
+}
+
+func (r *pgCouponRepository) Update(ctx context.Context, c *model.Coupon) error {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `UPDATE coupons SET active = $2, ends_at = $3, updated_at = $4 WHERE id = $1`
+	tag, err := r.pool.Exec(ctx, q, c.ID, c.Active, c.EndsAt, c.UpdatedAt)
+	if err != nil {
+		log.Error("failed to update coupon",
+			zap.Error(err),
+			zap.String("coupon_id", c.ID),
+		)
+		return fmt.Errorf("update coupon: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrCouponNotFound
+	}
+	return nil
+}
+
+// redeemCoupons records the coupons of a new order. The coupon rows are
+// locked, in a fixed order so concurrent orders cannot deadlock, before
+// their redemptions are counted, so limits hold however many orders race
+// for the last use.
+func redeemCoupons(ctx context.Context, tx pgx.Tx, order *model.Order) error {
+	if len(order.Coupons) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(order.Coupons))
+	for i, c := range order.Coupons {
+		ids[i] = c.CouponID
+	}
+	slices.Sort(ids)
+
+	type limits struct{ total, perUser int }
+	locked := make(map[string]limits, len(ids))
+	q := `SELECT id, max_redemptions, max_redemptions_per_user FROM coupons WHERE id = ANY($1) ORDER BY id FOR UPDATE`
+	rows, err := tx.Query(ctx, q, ids)
+	if err != nil {
+		return fmt.Errorf("lock coupons: %w", err)
+	}
+	for rows.Next() {
+		var (
+			id string
+			l  limits
+		)
+		if err := rows.Scan(&id, &l.total, &l.perUser); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan coupon: %w", err)
+		}
+		locked[id] = l
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate coupons: %w", err)
+	}
+
+	for i, c := range order.Coupons {
+		l, ok := locked[c.CouponID]
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrCouponNotFound, c.Code)
+		}
+
+		if l.total > 0 || l.perUser > 0 {
+			var total, byUser int
+			q = `SELECT COUNT(*), COUNT(*) FILTER (WHERE r.user_id = $2)
+			     FROM coupon_redemptions r JOIN orders o ON o.id = r.order_id
+			     WHERE r.coupon_id = $1 AND o.status <> $3`
+			err := tx.QueryRow(ctx, q, c.CouponID, order.UserID, model.StatusCancelled).Scan(&total, &byUser)
+			if err != nil {
+				return fmt.Errorf("count coupon redemptions: %w", err)
+			}
+			switch {
+			case l.total > 0 && total >= l.total:
+				return fmt.Errorf("%w: %s", model.ErrCouponLimitReached, c.Code)
+			case l.perUser > 0 && byUser >= l.perUser:
+				return fmt.Errorf("%w: %s", model.ErrCouponUserLimitReached, c.Code)
+			}
+		}
+
+		q = `INSERT INTO coupon_redemptions (coupon_id, order_id, user_id, position, amount, created_at)
+		     VALUES ($1, $2, $3, $4, $5, $6)`
+		if _, err := tx.Exec(ctx, q, c.CouponID, order.ID, order.UserID, i, c.Amount.Amount(), order.CreatedAt); err != nil {
+			return fmt.Errorf("insert coupon redemption: %w", err)
+		}
+	}
+	return nil
+}
+
+// loadCoupons fetches the coupons applied to several orders in a single
+// query.
+func (r *pgOrderRepository) loadCoupons(ctx context.Context, db querier, orderIDs []string) (map[string][]model.AppliedCoupon, error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `SELECT r.order_id, r.coupon_id, c.code, c.type, r.amount, o.currency
+	      FROM coupon_redemptions r JOIN coupons c ON c.id = r.coupon_id JOIN orders o ON o.id = r.order_id
+	      WHERE r.order_id = ANY($1) ORDER BY r.order_id, r.position`
+	rows, err := db.Query(ctx, q, orderIDs)
+	if err != nil {
+		log.Error("failed to query order coupons",
+			zap.Error(err),
+			zap.Int("orders_count", len(orderIDs)),
+		)
+		return nil, fmt.Errorf("query coupons: %w", err)
+	}
+	defer rows.Close()
+
+	coupons := make(map[string][]model.AppliedCoupon, len(orderIDs))
+	for rows.Next() {
+		var (
+			orderID  string
+			c        model.AppliedCoupon
+			amount   int64
+			currency money.Currency
+		)
+		if err := rows.Scan(&orderID, &c.CouponID, &c.Code, &c.Type, &amount, &currency); err != nil {
+			log.Error("failed to scan order coupon",
+				zap.Error(err),
+			)
+			return nil, fmt.Errorf("scan coupon: %w", err)
+		}
+		c.Amount = money.New(amount, currency)
+		coupons[orderID] = append(coupons[orderID], c)
+	}
+	if err := rows.Err(); err != nil {
+		log.Error("error iterating order coupons",
+			zap.Error(err),
+		)
+		return nil, fmt.Errorf("iterate coupons: %w", err)
+	}
+
+	return coupons, nil
+}
@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+type IdempotencyStatus string
+
+const (
+	IdempotencyInProgress IdempotencyStatus = "in_progress"
+	IdempotencyCompleted  IdempotencyStatus = "completed"
+)
+
+// IdempotencyRecord is a key as used by one caller. Keys of different
+// scopes never collide.
+type IdempotencyRecord struct {
+	Scope               string
+	Key                 string
+	Fingerprint         string
+	Status              IdempotencyStatus
+	ResponseStatus      int
+	ResponseContentType string
+	ResponseBody        []byte
+	CreatedAt           time.Time
+	ExpiresAt           time.Time
+}
+
+type IdempotencyRepository interface {
+	// Acquire claims key in scope for a new request, for lease. When the key
+	// is already held by an unexpired record, that record is returned with
+	// acquired == false. A key left in progress by a request that never
+	// finished can be claimed again once its lease runs out.
+	Acquire(ctx context.Context, scope, key, fingerprint string, lease time.Duration) (rec *IdempotencyRecord, acquired bool, err error)
+	// Complete stores the response to replay and keeps it for ttl.
+	Complete(ctx context.Context, scope, key string, status int, contentType string, body []byte, ttl time.Duration) error
+	Release(ctx context.Context, scope, key string) error
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+type pgIdempotencyRepository struct {
+	pool   *pgxpool.Pool
+	logger logger.Logger
+}
+
+func NewIdempotencyRepository(pool *pgxpool.Pool, logger logger.Logger) IdempotencyRepository {
+	return &pgIdempotencyRepository{
+		pool:   pool,
+		logger: logger.With(zap.String("component", "repository")),
+	}
+}
+
+func (r *pgIdempotencyRepository) Acquire(ctx context.Context, scope, key, fingerprint string, lease time.Duration) (*IdempotencyRecord, bool, error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	// An expired record is taken over in place; a live one is left untouched
+	// and read back below. Retry once in case it expires in between.
+	for attempt := 0; attempt < 2; attempt++ {
+		now := time.Now()
+		q := `INSERT INTO idempotency_keys (scope, key, fingerprint, status, created_at, expires_at)
+		      VALUES ($1, $2, $3, $4, $5, $6)
+		      ON CONFLICT (scope, key) DO UPDATE SET
+		          fingerprint = EXCLUDED.fingerprint,
+		          status = EXCLUDED.status,
+		          response_status = NULL,
+		          response_content_type = NULL,
+		          response_body = NULL,
+		          created_at = EXCLUDED.created_at,
+		          expires_at = EXCLUDED.expires_at
+		      WHERE idempotency_keys.expires_at <= EXCLUDED.created_at
+		      RETURNING key`
+		var claimed string
+		err := r.pool.QueryRow(ctx, q, scope, key, fingerprint, IdempotencyInProgress, now, now.Add(lease)).Scan(&claimed)
+		if err == nil {
+			log.Debug("idempotency key acquired",
+				zap.String("idempotency_scope", scope),
+				zap.String("idempotency_key", key),
+			)
+			return &IdempotencyRecord{
+				Scope:       scope,
+				Key:         key,
+				Fingerprint: fingerprint,
+				Status:      IdempotencyInProgress,
+				CreatedAt:   now,
+				ExpiresAt:   now.Add(lease),
+			}, true, nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			log.Error("failed to acquire idempotency key",
+				zap.Error(err),
+				zap.String("idempotency_key", key),
+			)
+			return nil, false, fmt.Errorf("insert idempotency key: %w", err)
+		}
+
+		q = `SELECT scope, key, fingerprint, status, COALESCE(response_status, 0), COALESCE(response_content_type, ''), response_body,
+		            created_at, expires_at
+		     FROM idempotency_keys WHERE scope = $1 AND key = $2 AND expires_at > $3`
+		var rec IdempotencyRecord
+		err = r.pool.QueryRow(ctx, q, scope, key, now).Scan(&rec.Scope, &rec.Key, &rec.Fingerprint, &rec.Status, &rec.ResponseStatus,
+			&rec.ResponseContentType, &rec.ResponseBody, &rec.CreatedAt, &rec.ExpiresAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			log.Error("failed to select idempotency key",
+				zap.Error(err),
+				zap.String("idempotency_key", key),
+			)
+			return nil, false, fmt.Errorf("select idempotency key: %w", err)
+		}
+
+		return &rec, false, nil
+	}
+
+	return nil, false, fmt.Errorf("acquire idempotency key %q: record changed concurrently", key)
+}
+
+func (r *pgIdempotencyRepository) Complete(ctx context.Context, scope, key string, status int, contentType string, body []byte, ttl time.Duration) error {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `UPDATE idempotency_keys
+	      SET status = $3, response_status = $4, response_content_type = $5, response_body = $6, expires_at = $7
+	      WHERE scope = $1 AND key = $2`
+	if _, err := r.pool.Exec(ctx, q, scope, key, IdempotencyCompleted, status, contentType, body, time.Now().Add(ttl)); err != nil {
+		log.Error("failed to complete idempotency key",
+			zap.Error(err),
+			zap.String("idempotency_key", key),
+		)
+		return fmt.Errorf("complete idempotency key: %w", err)
+	}
+	return nil
+}
+
+func (r *pgIdempotencyRepository) Release(ctx context.Context, scope, key string) error {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `DELETE FROM idempotency_keys WHERE scope = $1 AND key = $2 AND status = $3`
+	if _, err := r.pool.Exec(ctx, q, scope, key, IdempotencyInProgress); err != nil {
+		log.Error("failed to release idempotency key",
+			zap.Error(err),
+			zap.String("idempotency_key", key),
+		)
+		return fmt.Errorf("release idempotency key: %w", err)
+	}
+	return nil
+}
+
+func (r *pgIdempotencyRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	tag, err := r.pool.Exec(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= NOW()`)
+	if err != nil {
+		log.Error("failed to delete expired idempotency keys",
+			zap.Error(err),
+		)
+		return 0, fmt.Errorf("delete expired idempotency keys: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/internal/money"
 	"github.com/Kosench/ecommerce-lab/platform/logger"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
@@ -16,6 +19,36 @@ import (
 type OrderRepository interface {
 	Create(ctx context.Context, order *model.Order) error
 	GetByID(ctx context.Context, id string) (*model.Order, error)
+	List(ctx context.Context, filter OrderFilter) ([]*model.Order, error)
+	UpdateStatus(ctx context.Context, id string, status model.OrderStatus) (*model.Order, error)
+	// AddRefund records a refund the provider has already made and moves
+	// the order to partially_refunded or refunded. It rejects refunds that
+	// no longer fit the order.
+	AddRefund(ctx context.Context, refund *model.Refund) (*model.Order, error)
+	// ReserveRefund prices a refund of items, or of everything left if items
+	// is empty, against the order as it is under lock, and records it as
+	// pending. Once the provider has been asked to make it, the refund is
+	// confirmed with ConfirmRefund or dropped with VoidRefund.
+	ReserveRefund(ctx context.Context, orderID, paymentID string, items []model.RefundItem, reason string) (*model.Refund, error)
+	ConfirmRefund(ctx context.Context, orderID, refundID, providerRefundID string) (*model.Order, error)
+	VoidRefund(ctx context.Context, orderID, refundID string) error
+}
+
+// OrderFilter narrows List results. Zero values mean "no constraint".
+// Orders are always returned newest first; After continues a previous page.
+type OrderFilter struct {
+	UserID      string
+	Status      model.OrderStatus
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	After       *OrderCursor
+	Limit       int
+}
+
+// OrderCursor is the keyset position of the last order on a page.
+type OrderCursor struct {
+	CreatedAt time.Time
+	ID        string
 }
 
 type pgOrderRepository struct {
@@ -32,10 +65,35 @@ func NewOrderRepository(pool *pgxpool.Pool, logger logger.Logger) OrderRepositor
 
 var ErrOrderNotFound = errors.New("order not found")
 
+const orderColumns = `id, user_id, COALESCE(cart_id::text, ''), status, currency, subtotal, discount, tax_amount, total, tax_jurisdiction, created_at, updated_at`
+
+func scanOrder(row pgx.Row, order *model.Order) error {
+	var subtotal, discount, tax, total int64
+	err := row.Scan(&order.ID, &order.UserID, &order.CartID, &order.Status, &order.Currency, &subtotal, &discount, &tax, &total,
+		&order.TaxJurisdiction, &order.CreatedAt, &order.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	order.Subtotal = money.New(subtotal, order.Currency)
+	order.Discount = money.New(discount, order.Currency)
+	order.Tax = money.New(tax, order.Currency)
+	order.Total = money.New(total, order.Currency)
+	return nil
+}
+
+// lineDiscount is how order_items.discounts stores a model.LineDiscount;
+// amounts are in the order's currency.
+type lineDiscount struct {
+	Code   string `json:"code"`
+	Amount int64  `json:"amount"`
+}
+
 func (r *pgOrderRepository) Create(ctx context.Context, order *model.Order) error {
+	log := logger.WithContext(ctx, r.logger)
+
 	tx, err := r.pool.Begin(ctx)
 	if err != nil {
-		r.logger.Error("failed to begin transaction",
+		log.Error("failed to begin transaction",
 			zap.Error(err),
 		)
 		return fmt.Errorf("begin tx: %w", err)
@@ -43,35 +101,42 @@ func (r *pgOrderRepository) Create(ctx context.Context, order *model.Order) erro
 
 	defer func() {
 		if err != nil {
-			r.logger.Warn("rolling back transaction",
+			log.Warn("rolling back transaction",
 				zap.Error(err),
 			)
 			tx.Rollback(ctx)
 		}
 	}()
 
-	q := `INSERT INTO orders (id, user_id, status, total, created_at, updated_at) 
-	      VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
-	err = tx.QueryRow(ctx, q, order.ID, order.UserID, order.Status, order.Total, order.CreatedAt, order.UpdatedAt).Scan(&order.ID)
+	q := `INSERT INTO orders (id, user_id, cart_id, status, currency, subtotal, discount, tax_amount, total, tax_jurisdiction, created_at, updated_at) 
+	      VALUES ($1, $2, NULLIF($3::text, '')::uuid, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING id`
+	err = tx.QueryRow(ctx, q, order.ID, order.UserID, order.CartID, order.Status, order.Currency, order.Subtotal.Amount(), order.Discount.Amount(),
+		order.Tax.Amount(), order.Total.Amount(), order.TaxJurisdiction, order.CreatedAt, order.UpdatedAt).Scan(&order.ID)
 	if err != nil {
-		r.logger.Error("failed to insert order",
+		log.Error("failed to insert order",
 			zap.Error(err),
 			zap.String("order_id", order.ID),
 		)
 		return fmt.Errorf("insert order: %w", err)
 	}
 
-	r.logger.Debug("order inserted",
+	log.Debug("order inserted",
 		zap.String("order_id", order.ID),
 	)
 
 	for i, item := range order.Items {
+		discounts := make([]lineDiscount, len(item.Discounts))
+		for j, d := range item.Discounts {
+			discounts[j] = lineDiscount{Code: d.Code, Amount: d.Amount.Amount()}
+		}
+
 		itemID := uuid.NewString()
-		q = `INSERT INTO order_items (id, order_id, product_id, quantity, price) 
-		      VALUES ($1, $2, $3, $4, $5)`
-		_, err = tx.Exec(ctx, q, itemID, order.ID, item.ProductID, item.Quantity, item.Price)
+		q = `INSERT INTO order_items (id, order_id, position, product_id, product_name, quantity, price, discounts, tax_category, tax_amount) 
+		      VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+		_, err = tx.Exec(ctx, q, itemID, order.ID, i, item.ProductID, item.ProductName, item.Quantity, item.Price.Amount(), discounts,
+			item.TaxCategory, item.Tax.Amount())
 		if err != nil {
-			r.logger.Error("failed to insert order item",
+			log.Error("failed to insert order item",
 				zap.Error(err),
 				zap.String("order_id", order.ID),
 				zap.Int("item_index", i),
@@ -80,20 +145,65 @@ func (r *pgOrderRepository) Create(ctx context.Context, order *model.Order) erro
 		}
 	}
 
-	r.logger.Debug("order items inserted",
+	log.Debug("order items inserted",
 		zap.String("order_id", order.ID),
 		zap.Int("items_count", len(order.Items)),
 	)
 
+	if order.CartID != "" {
+		if err = checkoutCart(ctx, tx, order); err != nil {
+			log.Warn("cart checkout rejected",
+				zap.Error(err),
+				zap.String("order_id", order.ID),
+				zap.String("cart_id", order.CartID),
+			)
+			return err
+		}
+	}
+
+	if err = redeemCoupons(ctx, tx, order); err != nil {
+		if errors.Is(err, model.ErrCouponLimitReached) || errors.Is(err, model.ErrCouponUserLimitReached) {
+			log.Warn("coupon redemption rejected",
+				zap.Error(err),
+				zap.String("order_id", order.ID),
+			)
+		} else {
+			log.Error("failed to redeem coupons",
+				zap.Error(err),
+				zap.String("order_id", order.ID),
+			)
+		}
+		return err
+	}
+
+	if err = reserveStock(ctx, tx, order.Items); err != nil {
+		if errors.Is(err, model.ErrInsufficientStock) {
+			log.Warn("insufficient stock for order",
+				zap.Error(err),
+				zap.String("order_id", order.ID),
+			)
+		} else {
+			log.Error("failed to reserve stock",
+				zap.Error(err),
+				zap.String("order_id", order.ID),
+			)
+		}
+		return err
+	}
+
+	if err = r.recordEvent(ctx, tx, model.EventOrderCreated, order); err != nil {
+		return err
+	}
+
 	if err = tx.Commit(ctx); err != nil {
-		r.logger.Error("failed to commit transaction",
+		log.Error("failed to commit transaction",
 			zap.Error(err),
 			zap.String("order_id", order.ID),
 		)
 		return fmt.Errorf("commit tx: %w", err)
 	}
 
-	r.logger.Info("order transaction committed",
+	log.Info("order transaction committed",
 		zap.String("order_id", order.ID),
 	)
 
@@ -101,61 +211,323 @@ func (r *pgOrderRepository) Create(ctx context.Context, order *model.Order) erro
 }
 
 func (r *pgOrderRepository) GetByID(ctx context.Context, id string) (*model.Order, error) {
-	q := `SELECT id, user_id, status, total, created_at, updated_at 
-	      FROM orders WHERE id = $1`
-	row := r.pool.QueryRow(ctx, q, id)
+	log := logger.WithContext(ctx, r.logger)
 
+	q := `SELECT ` + orderColumns + ` FROM orders WHERE id = $1`
 	var order model.Order
-	err := row.Scan(&order.ID, &order.UserID, &order.Status, &order.Total, &order.CreatedAt, &order.UpdatedAt)
+	err := scanOrder(r.pool.QueryRow(ctx, q, id), &order)
 	if errors.Is(err, pgx.ErrNoRows) {
-		r.logger.Warn("order not found",
+		log.Warn("order not found",
 			zap.String("order_id", id),
 		)
 		return nil, ErrOrderNotFound
 	}
 	if err != nil {
-		r.logger.Error("failed to select order",
+		log.Error("failed to select order",
 			zap.Error(err),
 			zap.String("order_id", id),
 		)
 		return nil, fmt.Errorf("select order: %w", err)
 	}
 
-	q = `SELECT product_id, quantity, price FROM order_items WHERE order_id = $1 ORDER BY id`
-	rows, err := r.pool.Query(ctx, q, id)
+	if err := r.loadDetails(ctx, r.pool, []*model.Order{&order}); err != nil {
+		return nil, err
+	}
+
+	log.Debug("order loaded with items",
+		zap.String("order_id", order.ID),
+		zap.Int("items_count", len(order.Items)),
+	)
+
+	return &order, nil
+}
+
+func (r *pgOrderRepository) List(ctx context.Context, filter OrderFilter) ([]*model.Order, error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	var (
+		conds []string
+		args  []any
+	)
+	addCond := func(cond string, vals ...any) {
+		for _, v := range vals {
+			args = append(args, v)
+			cond = strings.Replace(cond, "?", fmt.Sprintf("$%d", len(args)), 1)
+		}
+		conds = append(conds, cond)
+	}
+
+	if filter.UserID != "" {
+		addCond("user_id = ?", filter.UserID)
+	}
+	if filter.Status != "" {
+		addCond("status = ?", filter.Status)
+	}
+	if !filter.CreatedFrom.IsZero() {
+		addCond("created_at >= ?", filter.CreatedFrom)
+	}
+	if !filter.CreatedTo.IsZero() {
+		addCond("created_at < ?", filter.CreatedTo)
+	}
+	if filter.After != nil {
+		addCond("(created_at, id) < (?, ?)", filter.After.CreatedAt, filter.After.ID)
+	}
+
+	q := `SELECT ` + orderColumns + ` FROM orders`
+	if len(conds) > 0 {
+		q += " WHERE " + strings.Join(conds, " AND ")
+	}
+	q += " ORDER BY created_at DESC, id DESC"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		q += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := r.pool.Query(ctx, q, args...)
 	if err != nil {
-		r.logger.Error("failed to query order items",
+		log.Error("failed to query orders",
 			zap.Error(err),
-			zap.String("order_id", id),
 		)
-		return nil, fmt.Errorf("query items: %w", err)
+		return nil, fmt.Errorf("query orders: %w", err)
 	}
 	defer rows.Close()
 
+	var orders []*model.Order
 	for rows.Next() {
-		var item model.OrderItem
-		if err := rows.Scan(&item.ProductID, &item.Quantity, &item.Price); err != nil {
-			r.logger.Error("failed to scan order item",
+		var order model.Order
+		if err := scanOrder(rows, &order); err != nil {
+			log.Error("failed to scan order",
 				zap.Error(err),
-				zap.String("order_id", id),
 			)
-			return nil, fmt.Errorf("scan item: %w", err)
+			return nil, fmt.Errorf("scan order: %w", err)
 		}
-		order.Items = append(order.Items, item)
+		orders = append(orders, &order)
 	}
-
 	if err := rows.Err(); err != nil {
-		r.logger.Error("error iterating order items",
+		log.Error("error iterating orders",
+			zap.Error(err),
+		)
+		return nil, fmt.Errorf("iterate orders: %w", err)
+	}
+
+	if len(orders) == 0 {
+		return orders, nil
+	}
+
+	if err := r.loadDetails(ctx, r.pool, orders); err != nil {
+		return nil, err
+	}
+
+	log.Debug("orders listed",
+		zap.Int("orders_count", len(orders)),
+	)
+
+	return orders, nil
+}
+
+// UpdateStatus moves an order to status under a row lock, so concurrent
+// transitions of the same order are serialized and validated one by one.
+func (r *pgOrderRepository) UpdateStatus(ctx context.Context, id string, status model.OrderStatus) (*model.Order, error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		log.Error("failed to begin transaction",
+			zap.Error(err),
+		)
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			log.Warn("rolling back transaction",
+				zap.Error(err),
+			)
+			tx.Rollback(ctx)
+		}
+	}()
+
+	q := `SELECT ` + orderColumns + ` FROM orders WHERE id = $1 FOR UPDATE`
+	var order model.Order
+	err = scanOrder(tx.QueryRow(ctx, q, id), &order)
+	if errors.Is(err, pgx.ErrNoRows) {
+		log.Warn("order not found",
+			zap.String("order_id", id),
+		)
+		err = ErrOrderNotFound
+		return nil, err
+	}
+	if err != nil {
+		log.Error("failed to lock order",
 			zap.Error(err),
 			zap.String("order_id", id),
 		)
-		return nil, fmt.Errorf("iterate items: %w", err)
+		return nil, fmt.Errorf("lock order: %w", err)
 	}
 
-	r.logger.Debug("order loaded with items",
-		zap.String("order_id", order.ID),
-		zap.Int("items_count", len(order.Items)),
+	from := order.Status
+	if err = order.TransitionTo(status); err != nil {
+		log.Warn("rejected status transition",
+			zap.String("order_id", id),
+			zap.String("from", string(from)),
+			zap.String("to", string(status)),
+		)
+		return nil, err
+	}
+
+	q = `UPDATE orders SET status = $2, updated_at = $3 WHERE id = $1`
+	if _, err = tx.Exec(ctx, q, order.ID, order.Status, order.UpdatedAt); err != nil {
+		log.Error("failed to update order status",
+			zap.Error(err),
+			zap.String("order_id", id),
+		)
+		return nil, fmt.Errorf("update status: %w", err)
+	}
+
+	if err = r.loadDetails(ctx, tx, []*model.Order{&order}); err != nil {
+		return nil, err
+	}
+
+	if err = applyStockTransition(ctx, tx, from, order.Status, order.Items); err != nil {
+		log.Error("failed to update stock for status change",
+			zap.Error(err),
+			zap.String("order_id", id),
+		)
+		return nil, err
+	}
+
+	if eventType := model.OrderStatusEvent(order.Status); eventType != "" {
+		if err = r.recordEvent(ctx, tx, eventType, &order); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		log.Error("failed to commit transaction",
+			zap.Error(err),
+			zap.String("order_id", id),
+		)
+		return nil, fmt.Errorf("commit tx: %w", err)
+	}
+
+	log.Info("order status updated",
+		zap.String("order_id", id),
+		zap.String("from", string(from)),
+		zap.String("to", string(order.Status)),
 	)
 
 	return &order, nil
 }
+
+func (r *pgOrderRepository) recordEvent(ctx context.Context, tx pgx.Tx, eventType string, order *model.Order) error {
+	log := logger.WithContext(ctx, r.logger)
+
+	event, err := model.NewOrderEvent(eventType, order)
+	if err != nil {
+		return fmt.Errorf("build %s event: %w", eventType, err)
+	}
+
+	if err := insertOutboxEvent(ctx, tx, event); err != nil {
+		log.Error("failed to record outbox event",
+			zap.Error(err),
+			zap.String("order_id", order.ID),
+			zap.String("event_type", eventType),
+		)
+		return err
+	}
+	return nil
+}
+
+// applyStockTransition keeps stock in line with an order status change:
+// cancelling an unpaid order frees its reservation and paying consumes it.
+func applyStockTransition(ctx context.Context, tx pgx.Tx, from, to model.OrderStatus, items []model.OrderItem) error {
+	switch {
+	case from == model.StatusPending && to == model.StatusCancelled:
+		return releaseStock(ctx, tx, items)
+	case from == model.StatusPending && to == model.StatusPaid:
+		return commitStock(ctx, tx, items)
+	}
+	return nil
+}
+
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// loadDetails fills in the items, refunds and coupons of orders.
+func (r *pgOrderRepository) loadDetails(ctx context.Context, db querier, orders []*model.Order) error {
+	ids := make([]string, len(orders))
+	for i, order := range orders {
+		ids[i] = order.ID
+	}
+
+	items, err := r.loadItems(ctx, db, ids)
+	if err != nil {
+		return err
+	}
+	refunds, err := r.loadRefunds(ctx, db, ids)
+	if err != nil {
+		return err
+	}
+	coupons, err := r.loadCoupons(ctx, db, ids)
+	if err != nil {
+		return err
+	}
+	for _, order := range orders {
+		order.Items = items[order.ID]
+		order.Refunds = refunds[order.ID]
+		order.Coupons = coupons[order.ID]
+	}
+	return nil
+}
+
+// loadItems fetches the items of several orders in a single query.
+func (r *pgOrderRepository) loadItems(ctx context.Context, db querier, orderIDs []string) (map[string][]model.OrderItem, error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `SELECT i.order_id, i.product_id, i.product_name, i.quantity, i.price, i.discounts, i.tax_category, i.tax_amount, o.currency
+	      FROM order_items i JOIN orders o ON o.id = i.order_id
+	      WHERE i.order_id = ANY($1) ORDER BY i.order_id, i.position, i.id`
+	rows, err := db.Query(ctx, q, orderIDs)
+	if err != nil {
+		log.Error("failed to query order items",
+			zap.Error(err),
+			zap.Int("orders_count", len(orderIDs)),
+		)
+		return nil, fmt.Errorf("query items: %w", err)
+	}
+	defer rows.Close()
+
+	items := make(map[string][]model.OrderItem, len(orderIDs))
+	for rows.Next() {
+		var (
+			orderID   string
+			item      model.OrderItem
+			price     int64
+			discounts []lineDiscount
+			tax       int64
+			currency  money.Currency
+		)
+		if err := rows.Scan(&orderID, &item.ProductID, &item.ProductName, &item.Quantity, &price, &discounts, &item.TaxCategory, &tax,
+			&currency); err != nil {
+			log.Error("failed to scan order item",
+				zap.Error(err),
+			)
+			return nil, fmt.Errorf("scan item: %w", err)
+		}
+		item.Price = money.New(price, currency)
+		item.Tax = money.New(tax, currency)
+		for _, d := range discounts {
+			item.Discounts = append(item.Discounts, model.LineDiscount{Code: d.Code, Amount: money.New(d.Amount, currency)})
+		}
+		items[orderID] = append(items[orderID], item)
+	}
+	if err := rows.Err(); err != nil {
+		log.Error("error iterating order items",
+			zap.Error(err),
+		)
+		return nil, fmt.Errorf("iterate items: %w", err)
+	}
+
+	return items, nil
+}
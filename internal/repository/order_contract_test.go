@@ -0,0 +1,617 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/internal/money"
+	"github.com/Kosench/ecommerce-lab/internal/repository"
+	"github.com/Kosench/ecommerce-lab/internal/tax"
+	"github.com/google/uuid"
+)
+
+// orderRepoHarness is what the contract suite needs from an implementation.
+type orderRepoHarness struct {
+	repo repository.OrderRepository
+	// newProductID returns a product orders can reserve plenty of.
+	newProductID func(t *testing.T) string
+	// newPaymentID returns a payment of order that refunds can refer to.
+	newPaymentID func(t *testing.T, order *model.Order) string
+	// newCoupon issues a coupon like c, with a unique code.
+	newCoupon func(t *testing.T, c model.Coupon) *model.Coupon
+}
+
+// testOrderRepositoryContract checks the behaviour every OrderRepository
+// must share. Each case uses its own user so it can run against a database
+// that already holds data.
+func testOrderRepositoryContract(t *testing.T, newHarness func(t *testing.T) orderRepoHarness) {
+	t.Run("GetByID unknown order", func(t *testing.T) {
+		h := newHarness(t)
+
+		_, err := h.repo.GetByID(context.Background(), uuid.NewString())
+		if !errors.Is(err, repository.ErrOrderNotFound) {
+			t.Fatalf("GetByID() error = %v, want ErrOrderNotFound", err)
+		}
+	})
+
+	t.Run("Create then GetByID round-trips", func(t *testing.T) {
+		h := newHarness(t)
+		ctx := context.Background()
+		order := newTestOrder(t, h, uuid.NewString(), 3)
+
+		if err := h.repo.Create(ctx, order); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		got, err := h.repo.GetByID(ctx, order.ID)
+		if err != nil {
+			t.Fatalf("GetByID() error = %v", err)
+		}
+
+		assertSameOrder(t, got, order)
+	})
+
+	t.Run("Create with coupons round-trips discounts", func(t *testing.T) {
+		h := newHarness(t)
+		ctx := context.Background()
+		items := newTestOrder(t, h, uuid.NewString(), 3).Items
+		coupons := []*model.Coupon{
+			h.newCoupon(t, model.Coupon{Type: model.CouponPercent, PercentOff: 15}),
+			h.newCoupon(t, model.Coupon{Type: model.CouponFixed, AmountOff: money.New(250, money.USD), ProductIDs: []string{items[2].ProductID}}),
+			h.newCoupon(t, model.Coupon{Type: model.CouponFreeShipping}),
+		}
+		order, err := model.NewOrder(uuid.NewString(), items, coupons)
+		if err != nil {
+			t.Fatalf("NewOrder() error = %v", err)
+		}
+
+		if err := h.repo.Create(ctx, order); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		got, err := h.repo.GetByID(ctx, order.ID)
+		if err != nil {
+			t.Fatalf("GetByID() error = %v", err)
+		}
+
+		assertSameOrder(t, got, order)
+		if !got.Discount.IsPositive() || !got.FreeShipping() {
+			t.Errorf("discount = %s, free shipping = %t, want a discount and free shipping", got.Discount, got.FreeShipping())
+		}
+	})
+
+	t.Run("Create with tax round-trips tax amounts", func(t *testing.T) {
+		h := newHarness(t)
+		ctx := context.Background()
+		items := newTestOrder(t, h, uuid.NewString(), 3).Items
+		items[1].TaxCategory = "books"
+		order, err := model.NewOrder(uuid.NewString(), items, nil)
+		if err != nil {
+			t.Fatalf("NewOrder() error = %v", err)
+		}
+		if err := order.ApplyTax(newTestTaxTable(t), "de"); err != nil {
+			t.Fatalf("ApplyTax() error = %v", err)
+		}
+
+		if err := h.repo.Create(ctx, order); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		got, err := h.repo.GetByID(ctx, order.ID)
+		if err != nil {
+			t.Fatalf("GetByID() error = %v", err)
+		}
+
+		assertSameOrder(t, got, order)
+		if got.TaxJurisdiction != "DE" || !got.Tax.IsPositive() {
+			t.Errorf("tax = %s in %q, want tax in DE", got.Tax, got.TaxJurisdiction)
+		}
+	})
+
+	t.Run("AddRefund of a discounted, taxed order gives back what was paid", func(t *testing.T) {
+		h := newHarness(t)
+		ctx := context.Background()
+		items := newTestOrder(t, h, uuid.NewString(), 2).Items
+		coupon := h.newCoupon(t, model.Coupon{Type: model.CouponPercent, PercentOff: 33})
+		order, err := model.NewOrder(uuid.NewString(), items, []*model.Coupon{coupon})
+		if err != nil {
+			t.Fatalf("NewOrder() error = %v", err)
+		}
+		if err := order.ApplyTax(newTestTaxTable(t), "DE"); err != nil {
+			t.Fatalf("ApplyTax() error = %v", err)
+		}
+		if err := h.repo.Create(ctx, order); err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		order, err = h.repo.UpdateStatus(ctx, order.ID, model.StatusPaid)
+		if err != nil {
+			t.Fatalf("UpdateStatus(paid) error = %v", err)
+		}
+
+		// One unit at a time, so every unit's share of the discount is rounded.
+		for order.Status != model.StatusRefunded {
+			var item model.RefundItem
+			for _, r := range order.Items {
+				if refunded := refundedQuantity(order, r.ProductID); refunded < r.Quantity {
+					item = model.RefundItem{ProductID: r.ProductID, Quantity: 1}
+					break
+				}
+			}
+			order, err = h.repo.AddRefund(ctx, newTestRefund(t, h, order, []model.RefundItem{item}))
+			if err != nil {
+				t.Fatalf("AddRefund() error = %v", err)
+			}
+		}
+		if got := order.RefundedAmount(); got != order.Total {
+			t.Errorf("refunded = %s, want %s", got, order.Total)
+		}
+	})
+
+	t.Run("UpdateStatus unknown order", func(t *testing.T) {
+		h := newHarness(t)
+
+		_, err := h.repo.UpdateStatus(context.Background(), uuid.NewString(), model.StatusPaid)
+		if !errors.Is(err, repository.ErrOrderNotFound) {
+			t.Fatalf("UpdateStatus() error = %v, want ErrOrderNotFound", err)
+		}
+	})
+
+	t.Run("UpdateStatus applies a valid transition", func(t *testing.T) {
+		h := newHarness(t)
+		ctx := context.Background()
+		order := createTestOrder(t, h, uuid.NewString())
+
+		updated, err := h.repo.UpdateStatus(ctx, order.ID, model.StatusPaid)
+		if err != nil {
+			t.Fatalf("UpdateStatus() error = %v", err)
+		}
+		if updated.Status != model.StatusPaid {
+			t.Errorf("status = %s, want %s", updated.Status, model.StatusPaid)
+		}
+		if len(updated.Items) != len(order.Items) {
+			t.Errorf("items = %d, want %d", len(updated.Items), len(order.Items))
+		}
+		if !updated.UpdatedAt.After(order.UpdatedAt) {
+			t.Errorf("updated_at = %v, want after %v", updated.UpdatedAt, order.UpdatedAt)
+		}
+
+		got, err := h.repo.GetByID(ctx, order.ID)
+		if err != nil {
+			t.Fatalf("GetByID() error = %v", err)
+		}
+		if got.Status != model.StatusPaid {
+			t.Errorf("stored status = %s, want %s", got.Status, model.StatusPaid)
+		}
+		if !got.UpdatedAt.Equal(updated.UpdatedAt.Truncate(time.Microsecond)) {
+			t.Errorf("stored updated_at = %v, want %v", got.UpdatedAt, updated.UpdatedAt)
+		}
+	})
+
+	t.Run("UpdateStatus rejects an invalid transition", func(t *testing.T) {
+		h := newHarness(t)
+		ctx := context.Background()
+		order := createTestOrder(t, h, uuid.NewString())
+
+		if _, err := h.repo.UpdateStatus(ctx, order.ID, model.StatusCancelled); err != nil {
+			t.Fatalf("UpdateStatus(cancelled) error = %v", err)
+		}
+		_, err := h.repo.UpdateStatus(ctx, order.ID, model.StatusPaid)
+		if !errors.Is(err, model.ErrInvalidTransition) {
+			t.Fatalf("UpdateStatus(paid) error = %v, want ErrInvalidTransition", err)
+		}
+
+		got, err := h.repo.GetByID(ctx, order.ID)
+		if err != nil {
+			t.Fatalf("GetByID() error = %v", err)
+		}
+		if got.Status != model.StatusCancelled {
+			t.Errorf("status = %s, want %s", got.Status, model.StatusCancelled)
+		}
+	})
+
+	t.Run("UpdateStatus serialises concurrent transitions", func(t *testing.T) {
+		h := newHarness(t)
+		ctx := context.Background()
+		order := createTestOrder(t, h, uuid.NewString())
+
+		const workers = 8
+		var (
+			wg        sync.WaitGroup
+			mu        sync.Mutex
+			succeeded int
+		)
+		for range workers {
+			wg.Go(func() {
+				_, err := h.repo.UpdateStatus(ctx, order.ID, model.StatusPaid)
+				switch {
+				case err == nil:
+					mu.Lock()
+					succeeded++
+					mu.Unlock()
+				case !errors.Is(err, model.ErrInvalidTransition):
+					t.Errorf("UpdateStatus() error = %v", err)
+				}
+			})
+		}
+		wg.Wait()
+
+		if succeeded != 1 {
+			t.Errorf("%d transitions succeeded, want exactly 1", succeeded)
+		}
+	})
+
+	t.Run("AddRefund unknown order", func(t *testing.T) {
+		h := newHarness(t)
+
+		_, err := h.repo.AddRefund(context.Background(), &model.Refund{ID: uuid.NewString(), OrderID: uuid.NewString(), Amount: money.New(100, money.USD)})
+		if !errors.Is(err, repository.ErrOrderNotFound) {
+			t.Fatalf("AddRefund() error = %v, want ErrOrderNotFound", err)
+		}
+	})
+
+	t.Run("AddRefund records partial then full refunds", func(t *testing.T) {
+		h := newHarness(t)
+		ctx := context.Background()
+		order := createPaidTestOrder(t, h)
+
+		partial := newTestRefund(t, h, order, []model.RefundItem{{ProductID: order.Items[1].ProductID, Quantity: 1}})
+		updated, err := h.repo.AddRefund(ctx, partial)
+		if err != nil {
+			t.Fatalf("AddRefund(partial) error = %v", err)
+		}
+		if updated.Status != model.StatusPartiallyRefunded {
+			t.Errorf("status = %s, want %s", updated.Status, model.StatusPartiallyRefunded)
+		}
+
+		full := newTestRefund(t, h, updated, nil)
+		if _, err := h.repo.AddRefund(ctx, full); err != nil {
+			t.Fatalf("AddRefund(full) error = %v", err)
+		}
+
+		got, err := h.repo.GetByID(ctx, order.ID)
+		if err != nil {
+			t.Fatalf("GetByID() error = %v", err)
+		}
+		if got.Status != model.StatusRefunded {
+			t.Errorf("status = %s, want %s", got.Status, model.StatusRefunded)
+		}
+		if got.RefundedAmount() != order.Total {
+			t.Errorf("refunded = %s, want %s", got.RefundedAmount(), order.Total)
+		}
+		if len(got.Refunds) != 2 {
+			t.Fatalf("refunds = %d, want 2", len(got.Refunds))
+		}
+		assertSameRefund(t, got.Refunds[0], partial)
+		assertSameRefund(t, got.Refunds[1], full)
+	})
+
+	t.Run("AddRefund rejects a refund over the total", func(t *testing.T) {
+		h := newHarness(t)
+		ctx := context.Background()
+		order := createPaidTestOrder(t, h)
+
+		// Both are priced before either is recorded.
+		partial := newTestRefund(t, h, order, []model.RefundItem{{ProductID: order.Items[0].ProductID, Quantity: 1}})
+		full := newTestRefund(t, h, order, nil)
+		if _, err := h.repo.AddRefund(ctx, partial); err != nil {
+			t.Fatalf("AddRefund(partial) error = %v", err)
+		}
+		_, err := h.repo.AddRefund(ctx, full)
+		if !errors.Is(err, model.ErrRefundExceedsTotal) {
+			t.Fatalf("AddRefund(full) error = %v, want ErrRefundExceedsTotal", err)
+		}
+
+		got, err := h.repo.GetByID(ctx, order.ID)
+		if err != nil {
+			t.Fatalf("GetByID() error = %v", err)
+		}
+		if len(got.Refunds) != 1 {
+			t.Errorf("refunds = %d, want 1", len(got.Refunds))
+		}
+	})
+
+	t.Run("ReserveRefund holds the amount back until confirmed", func(t *testing.T) {
+		h := newHarness(t)
+		ctx := context.Background()
+		order := createPaidTestOrder(t, h)
+		paymentID := h.newPaymentID(t, order)
+
+		reserved, err := h.repo.ReserveRefund(ctx, order.ID, paymentID, nil, "contract test")
+		if err != nil {
+			t.Fatalf("ReserveRefund() error = %v", err)
+		}
+		if reserved.Status != model.RefundPending || reserved.Amount != order.Total {
+			t.Fatalf("reserved = %+v, want pending refund of %s", *reserved, order.Total)
+		}
+
+		// The pending refund already covers the whole order.
+		_, err = h.repo.ReserveRefund(ctx, order.ID, paymentID, []model.RefundItem{{ProductID: order.Items[0].ProductID, Quantity: 1}}, "contract test")
+		if !errors.Is(err, model.ErrRefundQuantityExceeded) && !errors.Is(err, model.ErrRefundExceedsTotal) {
+			t.Fatalf("ReserveRefund(second) error = %v, want refund rejected", err)
+		}
+
+		got, err := h.repo.GetByID(ctx, order.ID)
+		if err != nil {
+			t.Fatalf("GetByID() error = %v", err)
+		}
+		if got.Status != model.StatusPaid || !got.RefundedAmount().IsZero() {
+			t.Errorf("pending: status = %s, refunded = %s, want paid and nothing refunded", got.Status, got.RefundedAmount())
+		}
+
+		confirmed, err := h.repo.ConfirmRefund(ctx, order.ID, reserved.ID, "re_contract")
+		if err != nil {
+			t.Fatalf("ConfirmRefund() error = %v", err)
+		}
+		if confirmed.Status != model.StatusRefunded || confirmed.RefundedAmount() != order.Total {
+			t.Errorf("confirmed: status = %s, refunded = %s, want refunded %s", confirmed.Status, confirmed.RefundedAmount(), order.Total)
+		}
+		if len(confirmed.Refunds) != 1 {
+			t.Fatalf("refunds = %d, want 1", len(confirmed.Refunds))
+		}
+		reserved.Status, reserved.ProviderRefundID = model.RefundSucceeded, "re_contract"
+		assertSameRefund(t, confirmed.Refunds[0], reserved)
+
+		if _, err := h.repo.ConfirmRefund(ctx, order.ID, reserved.ID, "re_contract"); !errors.Is(err, model.ErrRefundNotPending) {
+			t.Errorf("ConfirmRefund(again) error = %v, want ErrRefundNotPending", err)
+		}
+	})
+
+	t.Run("VoidRefund releases a pending refund", func(t *testing.T) {
+		h := newHarness(t)
+		ctx := context.Background()
+		order := createPaidTestOrder(t, h)
+		paymentID := h.newPaymentID(t, order)
+
+		reserved, err := h.repo.ReserveRefund(ctx, order.ID, paymentID, nil, "contract test")
+		if err != nil {
+			t.Fatalf("ReserveRefund() error = %v", err)
+		}
+		if err := h.repo.VoidRefund(ctx, order.ID, reserved.ID); err != nil {
+			t.Fatalf("VoidRefund() error = %v", err)
+		}
+		if err := h.repo.VoidRefund(ctx, order.ID, reserved.ID); !errors.Is(err, model.ErrRefundNotPending) {
+			t.Errorf("VoidRefund(again) error = %v, want ErrRefundNotPending", err)
+		}
+
+		got, err := h.repo.GetByID(ctx, order.ID)
+		if err != nil {
+			t.Fatalf("GetByID() error = %v", err)
+		}
+		if got.Status != model.StatusPaid || len(got.Refunds) != 0 {
+			t.Errorf("status = %s, refunds = %d, want paid with none", got.Status, len(got.Refunds))
+		}
+
+		// The voided amount can be refunded again.
+		if _, err := h.repo.ReserveRefund(ctx, order.ID, paymentID, nil, "contract test"); err != nil {
+			t.Errorf("ReserveRefund(after void) error = %v", err)
+		}
+	})
+
+	t.Run("List filters and pages newest first", func(t *testing.T) {
+		h := newHarness(t)
+		ctx := context.Background()
+		userID := uuid.NewString()
+		base := time.Now().Add(-time.Hour).Truncate(time.Microsecond)
+
+		var orders []*model.Order
+		for i := range 5 {
+			order := newTestOrder(t, h, userID, 1)
+			order.CreatedAt = base.Add(time.Duration(i) * time.Minute)
+			order.UpdatedAt = order.CreatedAt
+			if err := h.repo.Create(ctx, order); err != nil {
+				t.Fatalf("Create() error = %v", err)
+			}
+			orders = append(orders, order)
+		}
+		if _, err := h.repo.UpdateStatus(ctx, orders[1].ID, model.StatusPaid); err != nil {
+			t.Fatalf("UpdateStatus() error = %v", err)
+		}
+
+		all, err := h.repo.List(ctx, repository.OrderFilter{UserID: userID})
+		if err != nil {
+			t.Fatalf("List() error = %v", err)
+		}
+		assertOrderIDs(t, all, orders[4], orders[3], orders[2], orders[1], orders[0])
+		for _, o := range all {
+			if len(o.Items) != 1 {
+				t.Errorf("order %s has %d items, want 1", o.ID, len(o.Items))
+			}
+		}
+
+		page, err := h.repo.List(ctx, repository.OrderFilter{UserID: userID, Limit: 2})
+		if err != nil {
+			t.Fatalf("List(limit) error = %v", err)
+		}
+		assertOrderIDs(t, page, orders[4], orders[3])
+
+		last := page[len(page)-1]
+		next, err := h.repo.List(ctx, repository.OrderFilter{
+			UserID: userID,
+			After:  &repository.OrderCursor{CreatedAt: last.CreatedAt, ID: last.ID},
+			Limit:  2,
+		})
+		if err != nil {
+			t.Fatalf("List(after) error = %v", err)
+		}
+		assertOrderIDs(t, next, orders[2], orders[1])
+
+		paid, err := h.repo.List(ctx, repository.OrderFilter{UserID: userID, Status: model.StatusPaid})
+		if err != nil {
+			t.Fatalf("List(status) error = %v", err)
+		}
+		assertOrderIDs(t, paid, orders[1])
+
+		window, err := h.repo.List(ctx, repository.OrderFilter{
+			UserID:      userID,
+			CreatedFrom: orders[1].CreatedAt,
+			CreatedTo:   orders[3].CreatedAt,
+		})
+		if err != nil {
+			t.Fatalf("List(range) error = %v", err)
+		}
+		assertOrderIDs(t, window, orders[2], orders[1])
+	})
+
+	t.Run("List with no matches", func(t *testing.T) {
+		h := newHarness(t)
+
+		orders, err := h.repo.List(context.Background(), repository.OrderFilter{UserID: uuid.NewString()})
+		if err != nil {
+			t.Fatalf("List() error = %v", err)
+		}
+		if len(orders) != 0 {
+			t.Errorf("List() = %d orders, want none", len(orders))
+		}
+	})
+}
+
+func newTestOrder(t *testing.T, h orderRepoHarness, userID string, items int) *model.Order {
+	t.Helper()
+
+	lines := make([]model.OrderItem, items)
+	for i := range lines {
+		lines[i] = model.OrderItem{
+			ProductID:   h.newProductID(t),
+			ProductName: "product",
+			Quantity:    i + 1,
+			Price:       money.New(int64(100*(i+1)), money.USD),
+		}
+	}
+	order, err := model.NewOrder(userID, lines, nil)
+	if err != nil {
+		t.Fatalf("NewOrder() error = %v", err)
+	}
+	return order
+}
+
+func newTestTaxTable(t *testing.T) *tax.Table {
+	t.Helper()
+
+	rate := func(s string) tax.Rate {
+		r, err := tax.ParseRate(s)
+		if err != nil {
+			t.Fatalf("ParseRate(%q) error = %v", s, err)
+		}
+		return r
+	}
+	table, err := tax.NewTable(tax.Config{
+		Rounding:        tax.RoundHalfEven,
+		DefaultCategory: "standard",
+		Jurisdictions: map[string]map[string]tax.Rate{
+			"DE": {"standard": rate("19"), "books": rate("7")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewTable() error = %v", err)
+	}
+	return table
+}
+
+func refundedQuantity(order *model.Order, productID string) int {
+	var n int
+	for _, r := range order.Refunds {
+		for _, item := range r.Items {
+			if item.ProductID == productID {
+				n += item.Quantity
+			}
+		}
+	}
+	return n
+}
+
+func createTestOrder(t *testing.T, h orderRepoHarness, userID string) *model.Order {
+	t.Helper()
+
+	order := newTestOrder(t, h, userID, 2)
+	if err := h.repo.Create(context.Background(), order); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	return order
+}
+
+func createPaidTestOrder(t *testing.T, h orderRepoHarness) *model.Order {
+	t.Helper()
+
+	order := createTestOrder(t, h, uuid.NewString())
+	paid, err := h.repo.UpdateStatus(context.Background(), order.ID, model.StatusPaid)
+	if err != nil {
+		t.Fatalf("UpdateStatus(paid) error = %v", err)
+	}
+	return paid
+}
+
+func newTestRefund(t *testing.T, h orderRepoHarness, order *model.Order, items []model.RefundItem) *model.Refund {
+	t.Helper()
+
+	refund, err := order.NewRefund(items, "contract test")
+	if err != nil {
+		t.Fatalf("NewRefund() error = %v", err)
+	}
+	refund.PaymentID = h.newPaymentID(t, order)
+	return refund
+}
+
+func assertSameRefund(t *testing.T, got model.Refund, want *model.Refund) {
+	t.Helper()
+
+	if got.ID != want.ID || got.OrderID != want.OrderID || got.PaymentID != want.PaymentID || got.Amount != want.Amount || got.Reason != want.Reason ||
+		got.Status != want.Status || got.ProviderRefundID != want.ProviderRefundID {
+		t.Errorf("refund = %+v, want %+v", got, *want)
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt.Truncate(time.Microsecond)) {
+		t.Errorf("refund created_at = %v, want %v", got.CreatedAt, want.CreatedAt)
+	}
+	if len(got.Items) != len(want.Items) {
+		t.Fatalf("refund items = %d, want %d", len(got.Items), len(want.Items))
+	}
+	for i := range want.Items {
+		if got.Items[i] != want.Items[i] {
+			t.Errorf("refund item[%d] = %+v, want %+v", i, got.Items[i], want.Items[i])
+		}
+	}
+}
+
+func assertSameOrder(t *testing.T, got, want *model.Order) {
+	t.Helper()
+
+	if got.ID != want.ID || got.UserID != want.UserID || got.CartID != want.CartID || got.Status != want.Status ||
+		got.Currency != want.Currency || got.Subtotal != want.Subtotal || got.Discount != want.Discount || got.Tax != want.Tax ||
+		got.Total != want.Total || got.TaxJurisdiction != want.TaxJurisdiction {
+		t.Errorf("order = %+v, want %+v", got, want)
+	}
+	if !slices.Equal(got.Coupons, want.Coupons) {
+		t.Errorf("coupons = %+v, want %+v", got.Coupons, want.Coupons)
+	}
+	// Postgres keeps microseconds.
+	if !got.CreatedAt.Equal(want.CreatedAt.Truncate(time.Microsecond)) {
+		t.Errorf("created_at = %v, want %v", got.CreatedAt, want.CreatedAt)
+	}
+	if !got.UpdatedAt.Equal(want.UpdatedAt.Truncate(time.Microsecond)) {
+		t.Errorf("updated_at = %v, want %v", got.UpdatedAt, want.UpdatedAt)
+	}
+	if len(got.Items) != len(want.Items) {
+		t.Fatalf("items = %d, want %d", len(got.Items), len(want.Items))
+	}
+	for i := range want.Items {
+		g, w := got.Items[i], want.Items[i]
+		if g.ProductID != w.ProductID || g.ProductName != w.ProductName || g.Quantity != w.Quantity || g.Price != w.Price ||
+			g.TaxCategory != w.TaxCategory || g.Tax != w.Tax || !slices.Equal(g.Discounts, w.Discounts) {
+			t.Errorf("item[%d] = %+v, want %+v", i, g, w)
+		}
+	}
+}
+
+func assertOrderIDs(t *testing.T, got []*model.Order, want ...*model.Order) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d orders, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].ID != want[i].ID {
+			t.Errorf("order[%d] = %s, want %s", i, got[i].ID, want[i].ID)
+		}
+	}
+}
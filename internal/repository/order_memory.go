@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/model"
+)
+
+// memoryOrderRepository is an OrderRepository kept in process memory, for
+// tests that should not need Postgres. It matches the Postgres semantics
+// checked by the contract tests: errors, item order and timestamp precision.
+// Stock reservations, coupon redemption limits and outbox events are not
+// modelled.
+type memoryOrderRepository struct {
+	mu     sync.RWMutex
+	orders map[string]*model.Order
+}
+
+func NewMemoryOrderRepository() OrderRepository {
+	return &memoryOrderRepository{
+		orders: make(map[string]*model.Order),
+	}
+}
+
+func (r *memoryOrderRepository) Create(ctx context.Context, order *model.Order) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.orders[order.ID]; ok {
+		return fmt.Errorf("insert order: duplicate id %s", order.ID)
+	}
+	r.orders[order.ID] = stored(order)
+	return nil
+}
+
+func (r *memoryOrderRepository) GetByID(ctx context.Context, id string) (*model.Order, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	order, ok := r.orders[id]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+	return cloneOrder(order), nil
+}
+
+func (r *memoryOrderRepository) List(ctx context.Context, filter OrderFilter) ([]*model.Order, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var orders []*model.Order
+	for _, order := range r.orders {
+		if matchesFilter(order, filter) {
+			orders = append(orders, order)
+		}
+	}
+
+	slices.SortFunc(orders, func(a, b *model.Order) int {
+		return compareKeyset(b.CreatedAt, b.ID, a.CreatedAt, a.ID)
+	})
+	if filter.Limit > 0 && len(orders) > filter.Limit {
+		orders = orders[:filter.Limit]
+	}
+
+	for i, order := range orders {
+		orders[i] = cloneOrder(order)
+	}
+	return orders, nil
+}
+
+func (r *memoryOrderRepository) UpdateStatus(ctx context.Context, id string, status model.OrderStatus) (*model.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.orders[id]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+
+	order := cloneOrder(current)
+	if err := order.TransitionTo(status); err != nil {
+		return nil, err
+	}
+	r.orders[id] = stored(order)
+
+	return order, nil
+}
+
+func (r *memoryOrderRepository) AddRefund(ctx context.Context, refund *model.Refund) (*model.Order, error) {
+	order, err := r.mutateRefunds(refund.OrderID, func(order *model.Order) error {
+		return order.ApplyRefund(*refund)
+	})
+	if err != nil {
+		return nil, err
+	}
+	refund.Status = model.RefundSucceeded
+	return order, nil
+}
+
+func (r *memoryOrderRepository) ReserveRefund(ctx context.Context, orderID, paymentID string, items []model.RefundItem, reason string) (*model.Refund, error) {
+	var refund *model.Refund
+	_, err := r.mutateRefunds(orderID, func(order *model.Order) error {
+		var err error
+		if refund, err = order.NewRefund(items, reason); err != nil {
+			return err
+		}
+		refund.PaymentID = paymentID
+		return order.ReserveRefund(*refund)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+func (r *memoryOrderRepository) ConfirmRefund(ctx context.Context, orderID, refundID, providerRefundID string) (*model.Order, error) {
+	return r.mutateRefunds(orderID, func(order *model.Order) error {
+		return order.ConfirmRefund(refundID, providerRefundID)
+	})
+}
+
+func (r *memoryOrderRepository) VoidRefund(ctx context.Context, orderID, refundID string) error {
+	_, err := r.mutateRefunds(orderID, func(order *model.Order) error {
+		return order.VoidRefund(refundID)
+	})
+	return err
+}
+
+func (r *memoryOrderRepository) mutateRefunds(orderID string, fn func(order *model.Order) error) (*model.Order, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.orders[orderID]
+	if !ok {
+		return nil, ErrOrderNotFound
+	}
+
+	order := cloneOrder(current)
+	if err := fn(order); err != nil {
+		return nil, err
+	}
+	r.orders[order.ID] = stored(order)
+
+	return cloneOrder(r.orders[order.ID]), nil
+}
+
+func matchesFilter(order *model.Order, filter OrderFilter) bool {
+	switch {
+	case filter.UserID != "" && order.UserID != filter.UserID:
+		return false
+	case filter.Status != "" && order.Status != filter.Status:
+		return false
+	case !filter.CreatedFrom.IsZero() && order.CreatedAt.Before(filter.CreatedFrom):
+		return false
+	case !filter.CreatedTo.IsZero() && !order.CreatedAt.Before(filter.CreatedTo):
+		return false
+	case filter.After != nil && compareKeyset(order.CreatedAt, order.ID, filter.After.CreatedAt, filter.After.ID) >= 0:
+		return false
+	}
+	return true
+}
+
+// compareKeyset orders (created_at, id) pairs the way Postgres compares row
+// values. UUIDs in canonical form compare the same as strings and as bytes.
+func compareKeyset(aTime time.Time, aID string, bTime time.Time, bID string) int {
+	if c := aTime.Compare(bTime); c != 0 {
+		return c
+	}
+	return cmp.Compare(aID, bID)
+}
+
+// stored copies order the way Postgres would keep it: TIMESTAMPTZ holds
+// microseconds and no monotonic clock reading.
+func stored(order *model.Order) *model.Order {
+	o := cloneOrder(order)
+	o.CreatedAt = o.CreatedAt.Round(0).Truncate(time.Microsecond)
+	o.UpdatedAt = o.UpdatedAt.Round(0).Truncate(time.Microsecond)
+	for i := range o.Refunds {
+		o.Refunds[i].CreatedAt = o.Refunds[i].CreatedAt.Round(0).Truncate(time.Microsecond)
+	}
+	return o
+}
+
+func cloneOrder(order *model.Order) *model.Order {
+	o := *order
+	o.Items = slices.Clone(order.Items)
+	for i := range o.Items {
+		o.Items[i].Discounts = slices.Clone(o.Items[i].Discounts)
+	}
+	o.Coupons = slices.Clone(order.Coupons)
+	o.Refunds = slices.Clone(order.Refunds)
+	for i := range o.Refunds {
+		o.Refunds[i].Items = slices.Clone(o.Refunds[i].Items)
+	}
+	return &o
+}
@@ -0,0 +1,31 @@
+package repository_test
+
+import (
+	"testing"
+
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/internal/repository"
+	"github.com/google/uuid"
+)
+
+func newTestCoupon(t *testing.T, c model.Coupon) *model.Coupon {
+	t.Helper()
+
+	c.Code = "TEST-" + uuid.NewString()[:8]
+	coupon, err := model.NewCoupon(c)
+	if err != nil {
+		t.Fatalf("NewCoupon() error = %v", err)
+	}
+	return coupon
+}
+
+func TestMemoryOrderRepository(t *testing.T) {
+	testOrderRepositoryContract(t, func(t *testing.T) orderRepoHarness {
+		return orderRepoHarness{
+			repo:         repository.NewMemoryOrderRepository(),
+			newProductID: func(*testing.T) string { return uuid.NewString() },
+			newPaymentID: func(*testing.T, *model.Order) string { return uuid.NewString() },
+			newCoupon:    newTestCoupon,
+		}
+	})
+}
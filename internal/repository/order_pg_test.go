@@ -0,0 +1,169 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/internal/money"
+	"github.com/Kosench/ecommerce-lab/internal/repository"
+	"github.com/Kosench/ecommerce-lab/migrations"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"github.com/Kosench/ecommerce-lab/platform/migrate"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// TestPostgresOrderRepository runs the contract suite against the database
+// at DATABASE_URL, migrating it first. It is skipped when that is unset.
+func TestPostgresOrderRepository(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	log := logger.NewNop()
+
+	products := repository.NewProductRepository(pool, log)
+	stock := repository.NewStockRepository(pool, log)
+	payments := repository.NewPaymentRepository(pool, log)
+	coupons := repository.NewCouponRepository(pool, log)
+
+	testOrderRepositoryContract(t, func(t *testing.T) orderRepoHarness {
+		return orderRepoHarness{
+			repo: repository.NewOrderRepository(pool, log),
+			newProductID: func(t *testing.T) string {
+				t.Helper()
+
+				product, err := model.NewProduct("contract test product", "", money.New(100, money.USD), "")
+				if err != nil {
+					t.Fatalf("NewProduct() error = %v", err)
+				}
+				if err := products.Create(ctx, product); err != nil {
+					t.Fatalf("create product: %v", err)
+				}
+				if _, err := stock.SetOnHand(ctx, product.ID, 1000); err != nil {
+					t.Fatalf("set stock: %v", err)
+				}
+				return product.ID
+			},
+			newPaymentID: func(t *testing.T, order *model.Order) string {
+				t.Helper()
+
+				payment := model.NewPayment(order.ID, "fake", order.Total)
+				if err := payments.Create(ctx, payment); err != nil {
+					t.Fatalf("create payment: %v", err)
+				}
+				return payment.ID
+			},
+			newCoupon: func(t *testing.T, c model.Coupon) *model.Coupon {
+				t.Helper()
+
+				coupon := newTestCoupon(t, c)
+				if err := coupons.Create(ctx, coupon); err != nil {
+					t.Fatalf("create coupon: %v", err)
+				}
+				return coupon
+			},
+		}
+	})
+}
+
+// TestPostgresOrderRepositoryDoesNotOversell races more orders than there is
+// stock for at one product. Exactly the units on hand must be reserved.
+func TestPostgresOrderRepositoryDoesNotOversell(t *testing.T) {
+	ctx := context.Background()
+	pool := newTestPool(t)
+	log := logger.NewNop()
+
+	products := repository.NewProductRepository(pool, log)
+	stock := repository.NewStockRepository(pool, log)
+	orders := repository.NewOrderRepository(pool, log)
+
+	const (
+		onHand  = 5
+		workers = 20
+	)
+	product, err := model.NewProduct("oversell test product", "", money.New(100, money.USD), "")
+	if err != nil {
+		t.Fatalf("NewProduct() error = %v", err)
+	}
+	if err := products.Create(ctx, product); err != nil {
+		t.Fatalf("create product: %v", err)
+	}
+	if _, err := stock.SetOnHand(ctx, product.ID, onHand); err != nil {
+		t.Fatalf("set stock: %v", err)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		placed   int
+		rejected int
+	)
+	for range workers {
+		wg.Go(func() {
+			order, err := model.NewOrder(uuid.NewString(), []model.OrderItem{{
+				ProductID:   product.ID,
+				ProductName: product.Name,
+				Quantity:    1,
+				Price:       product.Price,
+			}}, nil)
+			if err != nil {
+				t.Errorf("NewOrder() error = %v", err)
+				return
+			}
+
+			err = orders.Create(ctx, order)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				placed++
+			case errors.Is(err, model.ErrInsufficientStock):
+				rejected++
+			default:
+				t.Errorf("Create() error = %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if placed != onHand || rejected != workers-onHand {
+		t.Errorf("placed %d and rejected %d orders, want %d and %d", placed, rejected, onHand, workers-onHand)
+	}
+	level, err := stock.Get(ctx, product.ID)
+	if err != nil {
+		t.Fatalf("get stock: %v", err)
+	}
+	if level.Reserved != onHand {
+		t.Errorf("reserved = %d, want %d", level.Reserved, onHand)
+	}
+}
+
+// newTestPool connects to the database at DATABASE_URL and migrates it,
+// skipping the test when that is unset.
+func newTestPool(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+
+	dbURL := os.Getenv("DATABASE_URL")
+	if dbURL == "" {
+		t.Skip("DATABASE_URL is not set")
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, dbURL)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	migrator, err := migrate.New(pool, migrations.FS, logger.NewNop())
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return pool
+}
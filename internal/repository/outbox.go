@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+type OutboxRepository interface {
+	// Dispatch locks a batch of due events and passes them to publish one
+	// by one. Published events are marked as such; failed ones are scheduled
+	// for another attempt at retryAt(attempts). Only the oldest pending event
+	// of each aggregate is eligible, which keeps per-aggregate order.
+	Dispatch(ctx context.Context, limit int, publish func(context.Context, model.Event) error, retryAt func(attempts int) time.Time) (published int, err error)
+}
+
+type pgOutboxRepository struct {
+	pool   *pgxpool.Pool
+	logger logger.Logger
+}
+
+func NewOutboxRepository(pool *pgxpool.Pool, logger logger.Logger) OutboxRepository {
+	return &pgOutboxRepository{
+		pool:   pool,
+		logger: logger.With(zap.String("component", "repository")),
+	}
+}
+
+// insertOutboxEvent records event as part of tx, so it is published if and
+// only if the change it describes is committed.
+func insertOutboxEvent(ctx context.Context, tx pgx.Tx, event model.Event) error {
+	q := `INSERT INTO outbox (aggregate_type, aggregate_id, event_type, payload, created_at)
+	      VALUES ($1, $2, $3, $4, $5)`
+	_, err := tx.Exec(ctx, q, event.AggregateType, event.AggregateID, event.Type, event.Payload, event.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert outbox event: %w", err)
+	}
+	return nil
+}
+
+func (r *pgOutboxRepository) Dispatch(ctx context.Context, limit int, publish func(context.Context, model.Event) error, retryAt func(attempts int) time.Time) (published int, err error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		log.Error("failed to begin transaction",
+			zap.Error(err),
+		)
+		return 0, fmt.Errorf("begin tx: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		}
+	}()
+
+	q := `SELECT id, aggregate_type, aggregate_id, event_type, payload, created_at, attempts
+	      FROM outbox o
+	      WHERE published_at IS NULL
+	        AND next_attempt_at <= NOW()
+	        AND NOT EXISTS (
+	            SELECT 1 FROM outbox e
+	            WHERE e.aggregate_id = o.aggregate_id
+	              AND e.published_at IS NULL
+	              AND e.id < o.id)
+	      ORDER BY id
+	      LIMIT $1
+	      FOR UPDATE SKIP LOCKED`
+	rows, err := tx.Query(ctx, q, limit)
+	if err != nil {
+		log.Error("failed to query outbox",
+			zap.Error(err),
+		)
+		return 0, fmt.Errorf("query outbox: %w", err)
+	}
+
+	var events []model.Event
+	for rows.Next() {
+		var e model.Event
+		if err = rows.Scan(&e.ID, &e.AggregateType, &e.AggregateID, &e.Type, &e.Payload, &e.CreatedAt, &e.Attempts); err != nil {
+			rows.Close()
+			log.Error("failed to scan outbox event",
+				zap.Error(err),
+			)
+			return 0, fmt.Errorf("scan outbox event: %w", err)
+		}
+		events = append(events, e)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		log.Error("error iterating outbox",
+			zap.Error(err),
+		)
+		return 0, fmt.Errorf("iterate outbox: %w", err)
+	}
+
+	for _, e := range events {
+		if pubErr := publish(ctx, e); pubErr != nil {
+			log.Warn("failed to publish outbox event",
+				zap.Error(pubErr),
+				zap.Int64("event_id", e.ID),
+				zap.String("event_type", e.Type),
+				zap.Int("attempts", e.Attempts+1),
+			)
+			q = `UPDATE outbox SET attempts = attempts + 1, next_attempt_at = $2, last_error = $3 WHERE id = $1`
+			if _, err = tx.Exec(ctx, q, e.ID, retryAt(e.Attempts+1), pubErr.Error()); err != nil {
+				return published, fmt.Errorf("reschedule outbox event: %w", err)
+			}
+			continue
+		}
+
+		q = `UPDATE outbox SET published_at = NOW(), attempts = attempts + 1, last_error = NULL WHERE id = $1`
+		if _, err = tx.Exec(ctx, q, e.ID); err != nil {
+			return published, fmt.Errorf("mark outbox event published: %w", err)
+		}
+		published++
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		log.Error("failed to commit transaction",
+			zap.Error(err),
+		)
+		return 0, fmt.Errorf("commit tx: %w", err)
+	}
+
+	return published, nil
+}
@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/internal/money"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+var ErrPaymentNotFound = errors.New("payment not found")
+
+type PaymentRepository interface {
+	Create(ctx context.Context, payment *model.Payment) error
+	// Update saves the status, provider references and failure of a payment.
+	Update(ctx context.Context, payment *model.Payment) error
+	ListByOrder(ctx context.Context, orderID string) ([]*model.Payment, error)
+	GetByAuthorizationID(ctx context.Context, provider, authorizationID string) (*model.Payment, error)
+}
+
+type pgPaymentRepository struct {
+	pool   *pgxpool.Pool
+	logger logger.Logger
+}
+
+func NewPaymentRepository(pool *pgxpool.Pool, logger logger.Logger) PaymentRepository {
+	return &pgPaymentRepository{
+		pool:   pool,
+		logger: logger.With(zap.String("component", "repository")),
+	}
+}
+
+const paymentColumns = `id, order_id, provider, status, amount, currency, authorization_id, capture_id, failure_code, failure_message, created_at, updated_at`
+
+func scanPayment(row pgx.Row) (*model.Payment, error) {
+	var (
+		p        model.Payment
+		amount   int64
+		currency money.Currency
+	)
+	err := row.Scan(&p.ID, &p.OrderID, &p.Provider, &p.Status, &amount, &currency, &p.AuthorizationID, &p.CaptureID,
+		&p.FailureCode, &p.FailureMessage, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	p.Amount = money.New(amount, currency)
+	return &p, nil
+}
+
+func (r *pgPaymentRepository) Create(ctx context.Context, p *model.Payment) error {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `INSERT INTO payments (` + paymentColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+	_, err := r.pool.Exec(ctx, q, p.ID, p.OrderID, p.Provider, p.Status, p.Amount.Amount(), p.Amount.Currency(), p.AuthorizationID, p.CaptureID,
+		p.FailureCode, p.FailureMessage, p.CreatedAt, p.UpdatedAt)
+	if err != nil {
+		log.Error("failed to insert payment",
+			zap.Error(err),
+			zap.String("payment_id", p.ID),
+			zap.String("order_id", p.OrderID),
+		)
+		return fmt.Errorf("insert payment: %w", err)
+	}
+	return nil
+}
+
+func (r *pgPaymentRepository) Update(ctx context.Context, p *model.Payment) error {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `UPDATE payments
+	      SET status = $2, authorization_id = $3, capture_id = $4, failure_code = $5, failure_message = $6, updated_at = $7
+	      WHERE id = $1`
+	_, err := r.pool.Exec(ctx, q, p.ID, p.Status, p.AuthorizationID, p.CaptureID, p.FailureCode, p.FailureMessage, p.UpdatedAt)
+	if err != nil {
+		log.Error("failed to update payment",
+			zap.Error(err),
+			zap.String("payment_id", p.ID),
+		)
+		return fmt.Errorf("update payment: %w", err)
+	}
+	return nil
+}
+
+func (r *pgPaymentRepository) ListByOrder(ctx context.Context, orderID string) ([]*model.Payment, error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `SELECT ` + paymentColumns + ` FROM payments WHERE order_id = $1 ORDER BY created_at, id`
+	rows, err := r.pool.Query(ctx, q, orderID)
+	if err != nil {
+		log.Error("failed to query payments",
+			zap.Error(err),
+			zap.String("order_id", orderID),
+		)
+		return nil, fmt.Errorf("query payments: %w", err)
+	}
+	defer rows.Close()
+
+	var payments []*model.Payment
+	for rows.Next() {
+		p, err := scanPayment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan payment: %w", err)
+		}
+		payments = append(payments, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate payments: %w", err)
+	}
+	return payments, nil
+}
+
+func (r *pgPaymentRepository) GetByAuthorizationID(ctx context.Context, provider, authorizationID string) (*model.Payment, error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `SELECT ` + paymentColumns + ` FROM payments WHERE provider = $1 AND authorization_id = $2`
+	p, err := scanPayment(r.pool.QueryRow(ctx, q, provider, authorizationID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPaymentNotFound
+	}
+	if err != nil {
+		log.Error("failed to get payment",
+			zap.Error(err),
+			zap.String("provider", provider),
+			zap.String("authorization_id", authorizationID),
+		)
+		return nil, fmt.Errorf("get payment: %w", err)
+	}
+	return p, nil
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+type PaymentEventRepository interface {
+	// Record stores a received event. If the provider already delivered an
+	// event with the same ID, it stores nothing and returns that event.
+	Record(ctx context.Context, event *model.PaymentEvent) (*model.PaymentEvent, error)
+	MarkProcessed(ctx context.Context, id string, outcome model.PaymentEventOutcome, at time.Time) error
+}
+
+type pgPaymentEventRepository struct {
+	pool   *pgxpool.Pool
+	logger logger.Logger
+}
+
+func NewPaymentEventRepository(pool *pgxpool.Pool, logger logger.Logger) PaymentEventRepository {
+	return &pgPaymentEventRepository{
+		pool:   pool,
+		logger: logger.With(zap.String("component", "repository")),
+	}
+}
+
+const paymentEventColumns = `id, provider, event_id, event_type, order_id, payload, outcome, received_at, processed_at`
+
+func (r *pgPaymentEventRepository) Record(ctx context.Context, e *model.PaymentEvent) (*model.PaymentEvent, error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	// The SELECT does not see the row the INSERT adds, so exactly one branch
+	// returns a row.
+	q := `WITH inserted AS (
+	          INSERT INTO payment_events (id, provider, event_id, event_type, order_id, payload, received_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7)
+	          ON CONFLICT (provider, event_id) DO NOTHING
+	          RETURNING ` + paymentEventColumns + `)
+	      SELECT ` + paymentEventColumns + ` FROM inserted
+	      UNION ALL
+	      SELECT ` + paymentEventColumns + ` FROM payment_events WHERE provider = $2 AND event_id = $3`
+	var stored model.PaymentEvent
+	err := r.pool.QueryRow(ctx, q, e.ID, e.Provider, e.EventID, e.EventType, e.OrderID, e.Payload, e.ReceivedAt).Scan(
+		&stored.ID, &stored.Provider, &stored.EventID, &stored.EventType, &stored.OrderID, &stored.Payload,
+		&stored.Outcome, &stored.ReceivedAt, &stored.ProcessedAt)
+	if err != nil {
+		log.Error("failed to record payment event",
+			zap.Error(err),
+			zap.String("provider", e.Provider),
+			zap.String("event_id", e.EventID),
+		)
+		return nil, fmt.Errorf("record payment event: %w", err)
+	}
+	return &stored, nil
+}
+
+func (r *pgPaymentEventRepository) MarkProcessed(ctx context.Context, id string, outcome model.PaymentEventOutcome, at time.Time) error {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `UPDATE payment_events SET outcome = $2, processed_at = $3 WHERE id = $1`
+	if _, err := r.pool.Exec(ctx, q, id, outcome, at); err != nil {
+		log.Error("failed to mark payment event processed",
+			zap.Error(err),
+			zap.String("id", id),
+		)
+		return fmt.Errorf("mark payment event processed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/internal/money"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+type ProductRepository interface {
+	Create(ctx context.Context, product *model.Product) error
+	GetByID(ctx context.Context, id string) (*model.Product, error)
+	GetByIDs(ctx context.Context, ids []string) (map[string]*model.Product, error)
+	List(ctx context.Context, filter ProductFilter) ([]*model.Product, error)
+	Update(ctx context.Context, product *model.Product) error
+	Delete(ctx context.Context, id string) error
+}
+
+type ProductFilter struct {
+	ActiveOnly bool
+	Limit      int
+	Offset     int
+}
+
+type pgProductRepository struct {
+	pool   *pgxpool.Pool
+	logger logger.Logger
+}
+
+func NewProductRepository(pool *pgxpool.Pool, logger logger.Logger) ProductRepository {
+	return &pgProductRepository{
+		pool:   pool,
+		logger: logger.With(zap.String("component", "repository")),
+	}
+}
+
+var ErrProductNotFound = errors.New("product not found")
+
+const productColumns = `id, name, description, price, currency, tax_category, active, created_at, updated_at`
+
+func scanProduct(row pgx.Row) (*model.Product, error) {
+	var (
+		p        model.Product
+		price    int64
+		currency money.Currency
+	)
+	err := row.Scan(&p.ID, &p.Name, &p.Description, &price, &currency, &p.TaxCategory, &p.Active, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	p.Price = money.New(price, currency)
+	return &p, nil
+}
+
+func (r *pgProductRepository) Create(ctx context.Context, product *model.Product) error {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `INSERT INTO products (` + productColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	_, err := r.pool.Exec(ctx, q, product.ID, product.Name, product.Description, product.Price.Amount(), product.Price.Currency(),
+		product.TaxCategory, product.Active, product.CreatedAt, product.UpdatedAt)
+	if err != nil {
+		log.Error("failed to insert product",
+			zap.Error(err),
+			zap.String("product_id", product.ID),
+		)
+		return fmt.Errorf("insert product: %w", err)
+	}
+
+	log.Debug("product inserted",
+		zap.String("product_id", product.ID),
+	)
+	return nil
+}
+
+func (r *pgProductRepository) GetByID(ctx context.Context, id string) (*model.Product, error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `SELECT ` + productColumns + ` FROM products WHERE id = $1`
+	product, err := scanProduct(r.pool.QueryRow(ctx, q, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		log.Warn("product not found",
+			zap.String("product_id", id),
+		)
+		return nil, ErrProductNotFound
+	}
+	if err != nil {
+		log.Error("failed to select product",
+			zap.Error(err),
+			zap.String("product_id", id),
+		)
+		return nil, fmt.Errorf("select product: %w", err)
+	}
+	return product, nil
+}
+
+// GetByIDs returns the products that exist among ids, keyed by ID.
+// Missing products are simply absent from the map.
+func (r *pgProductRepository) GetByIDs(ctx context.Context, ids []string) (map[string]*model.Product, error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `SELECT ` + productColumns + ` FROM products WHERE id = ANY($1)`
+	rows, err := r.pool.Query(ctx, q, ids)
+	if err != nil {
+		log.Error("failed to query products",
+			zap.Error(err),
+			zap.Int("ids_count", len(ids)),
+		)
+		return nil, fmt.Errorf("query products: %w", err)
+	}
+	defer rows.Close()
+
+	products := make(map[string]*model.Product, len(ids))
+	for rows.Next() {
+		product, err := scanProduct(rows)
+		if err != nil {
+			log.Error("failed to scan product",
+				zap.Error(err),
+			)
+			return nil, fmt.Errorf("scan product: %w", err)
+		}
+		products[product.ID] = product
+	}
+	if err := rows.Err(); err != nil {
+		log.Error("error iterating products",
+			zap.Error(err),
+		)
+		return nil, fmt.Errorf("iterate products: %w", err)
+	}
+
+	return products, nil
+}
+
+func (r *pgProductRepository) List(ctx context.Context, filter ProductFilter) ([]*model.Product, error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `SELECT ` + productColumns + ` FROM products
+	      WHERE NOT $1 OR active
+	      ORDER BY name, id
+	      LIMIT $2 OFFSET $3`
+	rows, err := r.pool.Query(ctx, q, filter.ActiveOnly, filter.Limit, filter.Offset)
+	if err != nil {
+		log.Error("failed to query products",
+			zap.Error(err),
+		)
+		return nil, fmt.Errorf("query products: %w", err)
+	}
+	defer rows.Close()
+
+	var products []*model.Product
+	for rows.Next() {
+		product, err := scanProduct(rows)
+		if err != nil {
+			log.Error("failed to scan product",
+				zap.Error(err),
+			)
+			return nil, fmt.Errorf("scan product: %w", err)
+		}
+		products = append(products, product)
+	}
+	if err := rows.Err(); err != nil {
+		log.Error("error iterating products",
+			zap.Error(err),
+		)
+		return nil, fmt.Errorf("iterate products: %w", err)
+	}
+
+	return products, nil
+}
+
+func (r *pgProductRepository) Update(ctx context.Context, product *model.Product) error {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `UPDATE products SET name = $2, description = $3, price = $4, currency = $5, tax_category = $6, active = $7, updated_at = $8
+	      WHERE id = $1`
+	tag, err := r.pool.Exec(ctx, q, product.ID, product.Name, product.Description, product.Price.Amount(), product.Price.Currency(),
+		product.TaxCategory, product.Active, product.UpdatedAt)
+	if err != nil {
+		log.Error("failed to update product",
+			zap.Error(err),
+			zap.String("product_id", product.ID),
+		)
+		return fmt.Errorf("update product: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrProductNotFound
+	}
+	return nil
+}
+
+func (r *pgProductRepository) Delete(ctx context.Context, id string) error {
+	log := logger.WithContext(ctx, r.logger)
+
+	tag, err := r.pool.Exec(ctx, `DELETE FROM products WHERE id = $1`, id)
+	if err != nil {
+		log.Error("failed to delete product",
+			zap.Error(err),
+			zap.String("product_id", id),
+		)
+		return fmt.Errorf("delete product: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrProductNotFound
+	}
+
+	log.Info("product deleted",
+		zap.String("product_id", id),
+	)
+	return nil
+}
@@ -0,0 +1,249 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/internal/money"
+	"github.com/Kosench/ecommerce-lab/internal/validate"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// AddRefund records a refund the provider has already made, under a row
+// lock on its order, so refunds of the same order are checked against each
+// other one by one.
+func (r *pgOrderRepository) AddRefund(ctx context.Context, refund *model.Refund) (*model.Order, error) {
+	return r.mutateRefunds(ctx, refund.OrderID, func(tx pgx.Tx, order *model.Order) error {
+		if err := order.ApplyRefund(*refund); err != nil {
+			return err
+		}
+		refund.Status = model.RefundSucceeded
+		return insertRefund(ctx, tx, refund)
+	})
+}
+
+func (r *pgOrderRepository) ReserveRefund(ctx context.Context, orderID, paymentID string, items []model.RefundItem, reason string) (*model.Refund, error) {
+	var refund *model.Refund
+	_, err := r.mutateRefunds(ctx, orderID, func(tx pgx.Tx, order *model.Order) error {
+		var err error
+		if refund, err = order.NewRefund(items, reason); err != nil {
+			return err
+		}
+		refund.PaymentID = paymentID
+		if err := order.ReserveRefund(*refund); err != nil {
+			return err
+		}
+		return insertRefund(ctx, tx, refund)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refund, nil
+}
+
+func (r *pgOrderRepository) ConfirmRefund(ctx context.Context, orderID, refundID, providerRefundID string) (*model.Order, error) {
+	return r.mutateRefunds(ctx, orderID, func(tx pgx.Tx, order *model.Order) error {
+		if err := order.ConfirmRefund(refundID, providerRefundID); err != nil {
+			return err
+		}
+		q := `UPDATE refunds SET status = $2, provider_refund_id = $3 WHERE id = $1`
+		if _, err := tx.Exec(ctx, q, refundID, model.RefundSucceeded, providerRefundID); err != nil {
+			return fmt.Errorf("confirm refund: %w", err)
+		}
+		return nil
+	})
+}
+
+func (r *pgOrderRepository) VoidRefund(ctx context.Context, orderID, refundID string) error {
+	_, err := r.mutateRefunds(ctx, orderID, func(tx pgx.Tx, order *model.Order) error {
+		if err := order.VoidRefund(refundID); err != nil {
+			return err
+		}
+		q := `UPDATE refunds SET status = $2 WHERE id = $1`
+		if _, err := tx.Exec(ctx, q, refundID, model.RefundFailed); err != nil {
+			return fmt.Errorf("void refund: %w", err)
+		}
+		return nil
+	})
+	return err
+}
+
+// mutateRefunds runs fn on an order locked for the rest of the transaction,
+// then saves the order's status. When the refunds fn leaves on the order
+// differ from what it had, the change is published as order.refunded.
+func (r *pgOrderRepository) mutateRefunds(ctx context.Context, orderID string, fn func(tx pgx.Tx, order *model.Order) error) (_ *model.Order, err error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		log.Error("failed to begin transaction",
+			zap.Error(err),
+		)
+		return nil, fmt.Errorf("begin tx: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			log.Warn("rolling back transaction",
+				zap.Error(err),
+			)
+			tx.Rollback(ctx)
+		}
+	}()
+
+	q := `SELECT ` + orderColumns + ` FROM orders WHERE id = $1 FOR UPDATE`
+	var order model.Order
+	err = scanOrder(tx.QueryRow(ctx, q, orderID), &order)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = ErrOrderNotFound
+		return nil, err
+	}
+	if err != nil {
+		log.Error("failed to lock order",
+			zap.Error(err),
+			zap.String("order_id", orderID),
+		)
+		return nil, fmt.Errorf("lock order: %w", err)
+	}
+
+	if err = r.loadDetails(ctx, tx, []*model.Order{&order}); err != nil {
+		return nil, err
+	}
+
+	from, refunded := order.Status, order.RefundedAmount()
+	if err = fn(tx, &order); err != nil {
+		if isRefundRejection(err) {
+			log.Warn("rejected refund",
+				zap.Error(err),
+				zap.String("order_id", order.ID),
+			)
+		} else {
+			log.Error("failed to update refunds",
+				zap.Error(err),
+				zap.String("order_id", order.ID),
+			)
+		}
+		return nil, err
+	}
+
+	if order.RefundedAmount() != refunded {
+		q = `UPDATE orders SET status = $2, updated_at = $3 WHERE id = $1`
+		if _, err = tx.Exec(ctx, q, order.ID, order.Status, order.UpdatedAt); err != nil {
+			log.Error("failed to update order status",
+				zap.Error(err),
+				zap.String("order_id", order.ID),
+			)
+			return nil, fmt.Errorf("update status: %w", err)
+		}
+		if err = r.recordEvent(ctx, tx, model.EventOrderRefunded, &order); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		log.Error("failed to commit transaction",
+			zap.Error(err),
+			zap.String("order_id", order.ID),
+		)
+		return nil, fmt.Errorf("commit tx: %w", err)
+	}
+
+	log.Info("refunds updated",
+		zap.String("order_id", order.ID),
+		zap.Stringer("refunded", order.RefundedAmount()),
+		zap.String("from", string(from)),
+		zap.String("to", string(order.Status)),
+	)
+
+	return &order, nil
+}
+
+// isRefundRejection reports whether err is the order turning a refund down,
+// rather than a failure to store it.
+func isRefundRejection(err error) bool {
+	var invalid validate.Errors
+	return errors.As(err, &invalid) ||
+		errors.Is(err, model.ErrOrderNotRefundable) ||
+		errors.Is(err, model.ErrNothingToRefund) ||
+		errors.Is(err, model.ErrRefundExceedsTotal) ||
+		errors.Is(err, model.ErrRefundQuantityExceeded) ||
+		errors.Is(err, model.ErrRefundNotPending)
+}
+
+func insertRefund(ctx context.Context, tx pgx.Tx, refund *model.Refund) error {
+	q := `INSERT INTO refunds (id, order_id, payment_id, provider_refund_id, status, amount, reason, created_at)
+	      VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err := tx.Exec(ctx, q, refund.ID, refund.OrderID, refund.PaymentID, refund.ProviderRefundID, refund.Status,
+		refund.Amount.Amount(), refund.Reason, refund.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("insert refund: %w", err)
+	}
+	for i, item := range refund.Items {
+		q = `INSERT INTO refund_items (refund_id, position, product_id, quantity, amount) VALUES ($1, $2, $3, $4, $5)`
+		if _, err := tx.Exec(ctx, q, refund.ID, i, item.ProductID, item.Quantity, item.Amount.Amount()); err != nil {
+			return fmt.Errorf("insert refund item: %w", err)
+		}
+	}
+	return nil
+}
+
+// loadRefunds fetches the refunds of several orders, oldest first, with
+// their items. Failed refunds are left out.
+func (r *pgOrderRepository) loadRefunds(ctx context.Context, db querier, orderIDs []string) (map[string][]model.Refund, error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `SELECT f.id, f.order_id, f.payment_id, f.provider_refund_id, f.status, f.amount, f.reason, f.created_at,
+	             i.product_id, i.quantity, i.amount, o.currency
+	      FROM refunds f JOIN refund_items i ON i.refund_id = f.id JOIN orders o ON o.id = f.order_id
+	      WHERE f.order_id = ANY($1) AND f.status <> $2
+	      ORDER BY f.order_id, f.created_at, f.id, i.position`
+	rows, err := db.Query(ctx, q, orderIDs, model.RefundFailed)
+	if err != nil {
+		log.Error("failed to query refunds",
+			zap.Error(err),
+			zap.Int("orders_count", len(orderIDs)),
+		)
+		return nil, fmt.Errorf("query refunds: %w", err)
+	}
+	defer rows.Close()
+
+	refunds := make(map[string][]model.Refund, len(orderIDs))
+	for rows.Next() {
+		var (
+			refund                   model.Refund
+			item                     model.RefundItem
+			refundAmount, itemAmount int64
+			currency                 money.Currency
+		)
+		err := rows.Scan(&refund.ID, &refund.OrderID, &refund.PaymentID, &refund.ProviderRefundID, &refund.Status, &refundAmount, &refund.Reason, &refund.CreatedAt,
+			&item.ProductID, &item.Quantity, &itemAmount, &currency)
+		if err != nil {
+			log.Error("failed to scan refund",
+				zap.Error(err),
+			)
+			return nil, fmt.Errorf("scan refund: %w", err)
+		}
+		refund.Amount = money.New(refundAmount, currency)
+		item.Amount = money.New(itemAmount, currency)
+
+		list := refunds[refund.OrderID]
+		if n := len(list); n > 0 && list[n-1].ID == refund.ID {
+			list[n-1].Items = append(list[n-1].Items, item)
+			continue
+		}
+		refund.Items = []model.RefundItem{item}
+		refunds[refund.OrderID] = append(list, refund)
+	}
+	if err := rows.Err(); err != nil {
+		log.Error("error iterating refunds",
+			zap.Error(err),
+		)
+		return nil, fmt.Errorf("iterate refunds: %w", err)
+	}
+
+	return refunds, nil
+}
@@ -0,0 +1,178 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+type StockRepository interface {
+	Get(ctx context.Context, productID string) (*model.StockLevel, error)
+	SetOnHand(ctx context.Context, productID string, onHand int) (*model.StockLevel, error)
+}
+
+type pgStockRepository struct {
+	pool   *pgxpool.Pool
+	logger logger.Logger
+}
+
+func NewStockRepository(pool *pgxpool.Pool, logger logger.Logger) StockRepository {
+	return &pgStockRepository{
+		pool:   pool,
+		logger: logger.With(zap.String("component", "repository")),
+	}
+}
+
+const (
+	pgForeignKeyViolation = "23503"
+	pgUniqueViolation     = "23505"
+	pgCheckViolation      = "23514"
+)
+
+// Get returns the stock level of a product. A product that never had its
+// stock set has nothing on hand.
+func (r *pgStockRepository) Get(ctx context.Context, productID string) (*model.StockLevel, error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `SELECT p.id, COALESCE(s.on_hand, 0), COALESCE(s.reserved, 0), COALESCE(s.updated_at, p.created_at)
+	      FROM products p LEFT JOIN stock s ON s.product_id = p.id
+	      WHERE p.id = $1`
+	var level model.StockLevel
+	err := r.pool.QueryRow(ctx, q, productID).Scan(&level.ProductID, &level.OnHand, &level.Reserved, &level.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrProductNotFound
+	}
+	if err != nil {
+		log.Error("failed to select stock",
+			zap.Error(err),
+			zap.String("product_id", productID),
+		)
+		return nil, fmt.Errorf("select stock: %w", err)
+	}
+	return &level, nil
+}
+
+func (r *pgStockRepository) SetOnHand(ctx context.Context, productID string, onHand int) (*model.StockLevel, error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `INSERT INTO stock (product_id, on_hand) VALUES ($1, $2)
+	      ON CONFLICT (product_id) DO UPDATE SET on_hand = EXCLUDED.on_hand, updated_at = NOW()
+	      RETURNING product_id, on_hand, reserved, updated_at`
+	var level model.StockLevel
+	err := r.pool.QueryRow(ctx, q, productID, onHand).Scan(&level.ProductID, &level.OnHand, &level.Reserved, &level.UpdatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) {
+			switch pgErr.Code {
+			case pgForeignKeyViolation:
+				return nil, ErrProductNotFound
+			case pgCheckViolation:
+				return nil, model.ErrStockBelowReserve
+			}
+		}
+		log.Error("failed to set stock",
+			zap.Error(err),
+			zap.String("product_id", productID),
+		)
+		return nil, fmt.Errorf("upsert stock: %w", err)
+	}
+
+	log.Info("stock updated",
+		zap.String("product_id", productID),
+		zap.Int("on_hand", level.OnHand),
+		zap.Int("reserved", level.Reserved),
+	)
+	return &level, nil
+}
+
+type stockQuantity struct {
+	productID string
+	quantity  int
+}
+
+// stockQuantities sums item quantities per product, sorted by product ID so
+// that concurrent transactions always lock stock rows in the same order.
+func stockQuantities(items []model.OrderItem) []stockQuantity {
+	totals := make(map[string]int, len(items))
+	for _, item := range items {
+		totals[item.ProductID] += item.Quantity
+	}
+
+	quantities := make([]stockQuantity, 0, len(totals))
+	for id, qty := range totals {
+		quantities = append(quantities, stockQuantity{productID: id, quantity: qty})
+	}
+	slices.SortFunc(quantities, func(a, b stockQuantity) int {
+		return strings.Compare(a.productID, b.productID)
+	})
+	return quantities
+}
+
+// reserveStock holds the ordered quantities inside tx. The conditional
+// update is evaluated under the row lock, so parallel checkouts of the same
+// product can never reserve more than is on hand.
+func reserveStock(ctx context.Context, tx pgx.Tx, items []model.OrderItem) error {
+	var shortages []model.StockShortage
+
+	for _, sq := range stockQuantities(items) {
+		q := `UPDATE stock SET reserved = reserved + $2, updated_at = NOW()
+		      WHERE product_id = $1 AND on_hand - reserved >= $2`
+		tag, err := tx.Exec(ctx, q, sq.productID, sq.quantity)
+		if err != nil {
+			return fmt.Errorf("reserve stock: %w", err)
+		}
+		if tag.RowsAffected() == 1 {
+			continue
+		}
+
+		var available int
+		q = `SELECT on_hand - reserved FROM stock WHERE product_id = $1`
+		err = tx.QueryRow(ctx, q, sq.productID).Scan(&available)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("select available stock: %w", err)
+		}
+		shortages = append(shortages, model.StockShortage{
+			ProductID: sq.productID,
+			Requested: sq.quantity,
+			Available: available,
+		})
+	}
+
+	if len(shortages) > 0 {
+		return &model.InsufficientStockError{Shortages: shortages}
+	}
+	return nil
+}
+
+// releaseStock gives back the reservation of a cancelled unpaid order.
+func releaseStock(ctx context.Context, tx pgx.Tx, items []model.OrderItem) error {
+	for _, sq := range stockQuantities(items) {
+		q := `UPDATE stock SET reserved = GREATEST(reserved - $2, 0), updated_at = NOW()
+		      WHERE product_id = $1`
+		if _, err := tx.Exec(ctx, q, sq.productID, sq.quantity); err != nil {
+			return fmt.Errorf("release stock: %w", err)
+		}
+	}
+	return nil
+}
+
+// commitStock turns the reservation of a paid order into a decrement.
+func commitStock(ctx context.Context, tx pgx.Tx, items []model.OrderItem) error {
+	for _, sq := range stockQuantities(items) {
+		q := `UPDATE stock SET on_hand = on_hand - $2, reserved = reserved - $2, updated_at = NOW()
+		      WHERE product_id = $1`
+		if _, err := tx.Exec(ctx, q, sq.productID, sq.quantity); err != nil {
+			return fmt.Errorf("commit stock: %w", err)
+		}
+	}
+	return nil
+}
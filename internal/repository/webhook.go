@@ -0,0 +1,357 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+type WebhookRepository interface {
+	CreateSubscription(ctx context.Context, sub *model.WebhookSubscription) error
+	GetSubscription(ctx context.Context, id string) (*model.WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context) ([]*model.WebhookSubscription, error)
+	UpdateSecret(ctx context.Context, sub *model.WebhookSubscription) error
+	DeleteSubscription(ctx context.Context, id string) error
+
+	// Enqueue creates a pending delivery of event for every subscription
+	// that listens to its type. Enqueuing the same event twice is a no-op.
+	Enqueue(ctx context.Context, event model.Event) (int64, error)
+	// ClaimDue leases up to limit due deliveries until leaseUntil, so other
+	// dispatchers skip them while they are being sent.
+	ClaimDue(ctx context.Context, limit int, leaseUntil time.Time) ([]*DueWebhookDelivery, error)
+	// RecordAttempt records an attempt made under the lease ClaimDue
+	// returned as the delivery's NextAttemptAt. If another dispatcher has
+	// claimed the delivery since, it records nothing and returns
+	// ErrWebhookLeaseLost.
+	RecordAttempt(ctx context.Context, deliveryID string, leasedUntil time.Time, attempt model.WebhookAttempt, status model.WebhookDeliveryStatus, nextAttemptAt time.Time) error
+	ListDeliveries(ctx context.Context, subscriptionID string, limit int) ([]*model.WebhookDelivery, error)
+}
+
+// DueWebhookDelivery is a delivery together with where and how to send it.
+type DueWebhookDelivery struct {
+	model.WebhookDelivery
+	URL    string
+	Secret string
+}
+
+type pgWebhookRepository struct {
+	pool   *pgxpool.Pool
+	logger logger.Logger
+}
+
+func NewWebhookRepository(pool *pgxpool.Pool, logger logger.Logger) WebhookRepository {
+	return &pgWebhookRepository{
+		pool:   pool,
+		logger: logger.With(zap.String("component", "repository")),
+	}
+}
+
+var (
+	ErrWebhookSubscriptionNotFound = errors.New("webhook subscription not found")
+	ErrWebhookLeaseLost            = errors.New("webhook delivery lease lost")
+)
+
+const webhookSubscriptionColumns = `id, url, event_types, secret, created_at, updated_at`
+
+func scanWebhookSubscription(row pgx.Row) (*model.WebhookSubscription, error) {
+	var sub model.WebhookSubscription
+	if err := row.Scan(&sub.ID, &sub.URL, &sub.EventTypes, &sub.Secret, &sub.CreatedAt, &sub.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
+
+func (r *pgWebhookRepository) CreateSubscription(ctx context.Context, sub *model.WebhookSubscription) error {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `INSERT INTO webhook_subscriptions (` + webhookSubscriptionColumns + `) VALUES ($1, $2, $3, $4, $5, $6)`
+	if _, err := r.pool.Exec(ctx, q, sub.ID, sub.URL, sub.EventTypes, sub.Secret, sub.CreatedAt, sub.UpdatedAt); err != nil {
+		log.Error("failed to insert webhook subscription",
+			zap.Error(err),
+			zap.String("subscription_id", sub.ID),
+		)
+		return fmt.Errorf("insert webhook subscription: %w", err)
+	}
+	return nil
+}
+
+func (r *pgWebhookRepository) GetSubscription(ctx context.Context, id string) (*model.WebhookSubscription, error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `SELECT ` + webhookSubscriptionColumns + ` FROM webhook_subscriptions WHERE id = $1`
+	sub, err := scanWebhookSubscription(r.pool.QueryRow(ctx, q, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrWebhookSubscriptionNotFound
+	}
+	if err != nil {
+		log.Error("failed to select webhook subscription",
+			zap.Error(err),
+			zap.String("subscription_id", id),
+		)
+		return nil, fmt.Errorf("select webhook subscription: %w", err)
+	}
+	return sub, nil
+}
+
+func (r *pgWebhookRepository) ListSubscriptions(ctx context.Context) ([]*model.WebhookSubscription, error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `SELECT ` + webhookSubscriptionColumns + ` FROM webhook_subscriptions ORDER BY created_at, id`
+	rows, err := r.pool.Query(ctx, q)
+	if err != nil {
+		log.Error("failed to query webhook subscriptions",
+			zap.Error(err),
+		)
+		return nil, fmt.Errorf("query webhook subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	var subs []*model.WebhookSubscription
+	for rows.Next() {
+		sub, err := scanWebhookSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan webhook subscription: %w", err)
+		}
+		subs = append(subs, sub)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate webhook subscriptions: %w", err)
+	}
+	return subs, nil
+}
+
+func (r *pgWebhookRepository) UpdateSecret(ctx context.Context, sub *model.WebhookSubscription) error {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `UPDATE webhook_subscriptions SET secret = $2, updated_at = $3 WHERE id = $1`
+	tag, err := r.pool.Exec(ctx, q, sub.ID, sub.Secret, sub.UpdatedAt)
+	if err != nil {
+		log.Error("failed to update webhook secret",
+			zap.Error(err),
+			zap.String("subscription_id", sub.ID),
+		)
+		return fmt.Errorf("update webhook secret: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrWebhookSubscriptionNotFound
+	}
+	return nil
+}
+
+func (r *pgWebhookRepository) DeleteSubscription(ctx context.Context, id string) error {
+	log := logger.WithContext(ctx, r.logger)
+
+	tag, err := r.pool.Exec(ctx, `DELETE FROM webhook_subscriptions WHERE id = $1`, id)
+	if err != nil {
+		log.Error("failed to delete webhook subscription",
+			zap.Error(err),
+			zap.String("subscription_id", id),
+		)
+		return fmt.Errorf("delete webhook subscription: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrWebhookSubscriptionNotFound
+	}
+	return nil
+}
+
+func (r *pgWebhookRepository) Enqueue(ctx context.Context, event model.Event) (int64, error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `INSERT INTO webhook_deliveries (id, subscription_id, event_id, event_type, payload, status)
+	      SELECT uuid_generate_v4(), s.id, $1, $2, $3, $4
+	      FROM webhook_subscriptions s
+	      WHERE $2 = ANY(s.event_types)
+	      ON CONFLICT (subscription_id, event_id) DO NOTHING`
+	tag, err := r.pool.Exec(ctx, q, event.ID, event.Type, event.Payload, model.DeliveryPending)
+	if err != nil {
+		log.Error("failed to enqueue webhook deliveries",
+			zap.Error(err),
+			zap.Int64("event_id", event.ID),
+		)
+		return 0, fmt.Errorf("enqueue webhook deliveries: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (r *pgWebhookRepository) ClaimDue(ctx context.Context, limit int, leaseUntil time.Time) ([]*DueWebhookDelivery, error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `UPDATE webhook_deliveries d
+	      SET next_attempt_at = $3, updated_at = NOW()
+	      FROM webhook_subscriptions s
+	      WHERE s.id = d.subscription_id
+	        AND d.id IN (
+	            SELECT id FROM webhook_deliveries
+	            WHERE status = $2 AND next_attempt_at <= NOW()
+	            ORDER BY next_attempt_at
+	            LIMIT $1
+	            FOR UPDATE SKIP LOCKED)
+	      RETURNING d.id, d.subscription_id, d.event_id, d.event_type, d.payload, d.status,
+	                d.attempts, d.next_attempt_at, d.created_at, d.updated_at, s.url, s.secret`
+	rows, err := r.pool.Query(ctx, q, limit, model.DeliveryPending, leaseUntil)
+	if err != nil {
+		log.Error("failed to claim webhook deliveries",
+			zap.Error(err),
+		)
+		return nil, fmt.Errorf("claim webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var due []*DueWebhookDelivery
+	for rows.Next() {
+		var d DueWebhookDelivery
+		err := rows.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.Payload, &d.Status,
+			&d.Attempts, &d.NextAttemptAt, &d.CreatedAt, &d.UpdatedAt, &d.URL, &d.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("scan webhook delivery: %w", err)
+		}
+		due = append(due, &d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate webhook deliveries: %w", err)
+	}
+	return due, nil
+}
+
+func (r *pgWebhookRepository) RecordAttempt(ctx context.Context, deliveryID string, leasedUntil time.Time, attempt model.WebhookAttempt, status model.WebhookDeliveryStatus, nextAttemptAt time.Time) error {
+	log := logger.WithContext(ctx, r.logger)
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		}
+	}()
+
+	var statusCode *int
+	if attempt.StatusCode != 0 {
+		statusCode = &attempt.StatusCode
+	}
+	var attemptErr *string
+	if attempt.Error != "" {
+		attemptErr = &attempt.Error
+	}
+
+	// ClaimDue sets next_attempt_at to the lease; if it has moved, another
+	// dispatcher has claimed the delivery since.
+	q := `UPDATE webhook_deliveries SET status = $2, attempts = $3, next_attempt_at = $4, updated_at = NOW()
+	      WHERE id = $1 AND status = $5 AND next_attempt_at = $6`
+	tag, err := tx.Exec(ctx, q, deliveryID, status, attempt.Attempt, nextAttemptAt, model.DeliveryPending, leasedUntil)
+	if err != nil {
+		log.Error("failed to update webhook delivery",
+			zap.Error(err),
+			zap.String("delivery_id", deliveryID),
+		)
+		return fmt.Errorf("update webhook delivery: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		err = fmt.Errorf("%w: %s", ErrWebhookLeaseLost, deliveryID)
+		return err
+	}
+
+	q = `INSERT INTO webhook_delivery_attempts (delivery_id, attempt, status_code, error, duration_ms, attempted_at)
+	     VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err = tx.Exec(ctx, q, deliveryID, attempt.Attempt, statusCode, attemptErr, attempt.Duration.Milliseconds(), attempt.AttemptedAt)
+	if err != nil {
+		log.Error("failed to insert webhook attempt",
+			zap.Error(err),
+			zap.String("delivery_id", deliveryID),
+		)
+		return fmt.Errorf("insert webhook attempt: %w", err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit tx: %w", err)
+	}
+	return nil
+}
+
+func (r *pgWebhookRepository) ListDeliveries(ctx context.Context, subscriptionID string, limit int) ([]*model.WebhookDelivery, error) {
+	log := logger.WithContext(ctx, r.logger)
+
+	q := `SELECT id, subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at, created_at, updated_at
+	      FROM webhook_deliveries
+	      WHERE subscription_id = $1
+	      ORDER BY created_at DESC, id DESC
+	      LIMIT $2`
+	rows, err := r.pool.Query(ctx, q, subscriptionID, limit)
+	if err != nil {
+		log.Error("failed to query webhook deliveries",
+			zap.Error(err),
+			zap.String("subscription_id", subscriptionID),
+		)
+		return nil, fmt.Errorf("query webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var (
+		deliveries []*model.WebhookDelivery
+		byID       = make(map[string]*model.WebhookDelivery)
+		ids        []string
+	)
+	for rows.Next() {
+		var d model.WebhookDelivery
+		err := rows.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.Payload, &d.Status,
+			&d.Attempts, &d.NextAttemptAt, &d.CreatedAt, &d.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, &d)
+		byID[d.ID] = &d
+		ids = append(ids, d.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate webhook deliveries: %w", err)
+	}
+	rows.Close()
+
+	if len(ids) == 0 {
+		return deliveries, nil
+	}
+
+	q = `SELECT delivery_id, attempt, COALESCE(status_code, 0), COALESCE(error, ''), duration_ms, attempted_at
+	     FROM webhook_delivery_attempts
+	     WHERE delivery_id = ANY($1)
+	     ORDER BY delivery_id, attempt`
+	attemptRows, err := r.pool.Query(ctx, q, ids)
+	if err != nil {
+		log.Error("failed to query webhook attempts",
+			zap.Error(err),
+			zap.String("subscription_id", subscriptionID),
+		)
+		return nil, fmt.Errorf("query webhook attempts: %w", err)
+	}
+	defer attemptRows.Close()
+
+	for attemptRows.Next() {
+		var (
+			deliveryID string
+			a          model.WebhookAttempt
+			durationMs int64
+		)
+		if err := attemptRows.Scan(&deliveryID, &a.Attempt, &a.StatusCode, &a.Error, &durationMs, &a.AttemptedAt); err != nil {
+			return nil, fmt.Errorf("scan webhook attempt: %w", err)
+		}
+		a.Duration = time.Duration(durationMs) * time.Millisecond
+		if d, ok := byID[deliveryID]; ok {
+			d.AttemptLog = append(d.AttemptLog, a)
+		}
+	}
+	if err := attemptRows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate webhook attempts: %w", err)
+	}
+
+	return deliveries, nil
+}
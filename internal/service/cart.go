@@ -0,0 +1,376 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Kosench/ecommerce-lab/internal/auth"
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/internal/repository"
+	"github.com/Kosench/ecommerce-lab/internal/validate"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+type CartService interface {
+	CreateCart(ctx context.Context, userID string) (*model.Cart, error)
+	GetCart(ctx context.Context, id string) (*model.Cart, error)
+	AddItem(ctx context.Context, cartID, productID string, quantity int) (*model.Cart, error)
+	SetItemQuantity(ctx context.Context, cartID, productID string, quantity int) (*model.Cart, error)
+	RemoveItem(ctx context.Context, cartID, productID string) (*model.Cart, error)
+	MergeCarts(ctx context.Context, targetID, sourceID string) (*model.Cart, error)
+	Checkout(ctx context.Context, cartID string, params CheckoutParams) (*model.Order, error)
+}
+
+// CheckoutParams are what an order placed from a cart takes besides its
+// lines; see CreateOrderParams.
+type CheckoutParams struct {
+	CouponCodes     []string
+	TaxJurisdiction string
+}
+
+type cartService struct {
+	cartRepo     repository.CartRepository
+	productRepo  repository.ProductRepository
+	orderService OrderService
+	logger       logger.Logger
+}
+
+func NewCartService(cartRepo repository.CartRepository, productRepo repository.ProductRepository, orderService OrderService, logger logger.Logger) CartService {
+	return &cartService{
+		cartRepo:     cartRepo,
+		productRepo:  productRepo,
+		orderService: orderService,
+		logger:       logger.With(zap.String("component", "service"))}
+}
+
+// CreateCart creates a cart for userID, or an anonymous cart if userID is
+// empty.
+func (s *cartService) CreateCart(ctx context.Context, userID string) (*model.Cart, error) {
+	log := logger.WithContext(ctx, s.logger)
+
+	if userID != "" {
+		if err := authorizeUser(ctx, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	cart, err := model.NewCart(userID)
+	if err != nil {
+		log.Warn("invalid cart model",
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	if err := s.cartRepo.Create(ctx, cart); err != nil {
+		log.Error("failed to save cart to repository",
+			zap.Error(err),
+			zap.String("cart_id", cart.ID),
+		)
+		return nil, err
+	}
+
+	log.Info("cart created",
+		zap.String("cart_id", cart.ID),
+		zap.Bool("anonymous", cart.UserID == ""),
+	)
+
+	return cart, nil
+}
+
+func (s *cartService) GetCart(ctx context.Context, id string) (*model.Cart, error) {
+	if id == "" {
+		return nil, ErrInvalidRequest
+	}
+
+	cart, err := s.loadCart(ctx, id, auth.ScopeOrdersRead)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.priceCart(ctx, cart); err != nil {
+		return nil, err
+	}
+	return cart, nil
+}
+
+// loadCart loads a cart the caller may use scope on. Anonymous carts are
+// open to anyone holding their ID; a user's cart only to that user, and
+// other users' carts are reported as not found.
+func (s *cartService) loadCart(ctx context.Context, id, scope string) (*model.Cart, error) {
+	cart, err := s.cartRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if cart.UserID == "" {
+		return cart, nil
+	}
+
+	principal, ok := auth.FromContext(ctx)
+	if !ok {
+		return nil, auth.ErrUnauthenticated
+	}
+	if !principal.HasScope(scope) {
+		return nil, auth.ErrForbidden
+	}
+	if !principal.CanActFor(cart.UserID, scope) {
+		logger.WithContext(ctx, s.logger).Warn("access to another user's cart denied",
+			zap.String("cart_id", id),
+		)
+		return nil, repository.ErrCartNotFound
+	}
+	return cart, nil
+}
+
+// priceCart fills in the current catalog name and price of every line.
+func (s *cartService) priceCart(ctx context.Context, cart *model.Cart) error {
+	log := logger.WithContext(ctx, s.logger)
+
+	if len(cart.Items) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(cart.Items))
+	for i, item := range cart.Items {
+		ids[i] = item.ProductID
+	}
+
+	products, err := s.productRepo.GetByIDs(ctx, ids)
+	if err != nil {
+		log.Error("failed to load products for cart",
+			zap.Error(err),
+			zap.String("cart_id", cart.ID),
+		)
+		return err
+	}
+
+	for i := range cart.Items {
+		item := &cart.Items[i]
+		product, ok := products[item.ProductID]
+		if !ok {
+			continue
+		}
+		item.ProductName = product.Name
+		item.Price = product.Price
+		item.Available = product.Active
+	}
+	return nil
+}
+
+func (s *cartService) AddItem(ctx context.Context, cartID, productID string, quantity int) (*model.Cart, error) {
+	log := logger.WithContext(ctx, s.logger)
+
+	cart, err := s.loadCart(ctx, cartID, auth.ScopeOrdersWrite)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkItem(ctx, cart, productID, quantity); err != nil {
+		log.Warn("invalid cart item",
+			zap.Error(err),
+			zap.String("cart_id", cartID),
+		)
+		return nil, err
+	}
+
+	if err := s.cartRepo.AddItem(ctx, cartID, productID, quantity); err != nil {
+		s.logMutationError(ctx, err, "failed to add cart item", cartID)
+		return nil, err
+	}
+
+	log.Info("cart item added",
+		zap.String("cart_id", cartID),
+		zap.String("product_id", productID),
+		zap.Int("quantity", quantity),
+	)
+
+	return s.GetCart(ctx, cartID)
+}
+
+// checkItem validates a line before it goes into a cart. Only active
+// products priced in the cart's currency can be added.
+func (s *cartService) checkItem(ctx context.Context, cart *model.Cart, productID string, quantity int) error {
+	var v validate.Validator
+	v.Check(isUUID(productID), "product_id", model.ErrInvalidProduct)
+	v.Check(quantity > 0, "quantity", model.ErrInvalidQuantity)
+	if err := v.Err(); err != nil {
+		return err
+	}
+
+	product, err := s.productRepo.GetByID(ctx, productID)
+	if errors.Is(err, repository.ErrProductNotFound) {
+		return &validate.FieldError{Field: "product_id", Err: err}
+	}
+	if err != nil {
+		return err
+	}
+	if !product.Active {
+		return &validate.FieldError{Field: "product_id", Err: model.ErrProductInactive}
+	}
+
+	if err := s.priceCart(ctx, cart); err != nil {
+		return err
+	}
+	if currency := cart.Currency(); currency != "" && currency != product.Price.Currency() {
+		return &validate.FieldError{Field: "product_id", Err: model.ErrMixedCurrencies}
+	}
+	return nil
+}
+
+func (s *cartService) SetItemQuantity(ctx context.Context, cartID, productID string, quantity int) (*model.Cart, error) {
+	log := logger.WithContext(ctx, s.logger)
+
+	var v validate.Validator
+	v.Check(quantity > 0, "quantity", model.ErrInvalidQuantity)
+	if err := v.Err(); err != nil {
+		log.Warn("invalid cart item quantity",
+			zap.Error(err),
+			zap.String("cart_id", cartID),
+		)
+		return nil, err
+	}
+	if _, err := s.loadCart(ctx, cartID, auth.ScopeOrdersWrite); err != nil {
+		return nil, err
+	}
+
+	if err := s.cartRepo.SetItemQuantity(ctx, cartID, productID, quantity); err != nil {
+		s.logMutationError(ctx, err, "failed to update cart item", cartID)
+		return nil, err
+	}
+
+	log.Info("cart item updated",
+		zap.String("cart_id", cartID),
+		zap.String("product_id", productID),
+		zap.Int("quantity", quantity),
+	)
+
+	return s.GetCart(ctx, cartID)
+}
+
+func (s *cartService) RemoveItem(ctx context.Context, cartID, productID string) (*model.Cart, error) {
+	log := logger.WithContext(ctx, s.logger)
+
+	if _, err := s.loadCart(ctx, cartID, auth.ScopeOrdersWrite); err != nil {
+		return nil, err
+	}
+	if err := s.cartRepo.RemoveItem(ctx, cartID, productID); err != nil {
+		s.logMutationError(ctx, err, "failed to remove cart item", cartID)
+		return nil, err
+	}
+
+	log.Info("cart item removed",
+		zap.String("cart_id", cartID),
+		zap.String("product_id", productID),
+	)
+
+	return s.GetCart(ctx, cartID)
+}
+
+// MergeCarts moves an anonymous cart into a user's cart, typically right
+// after the shopper logs in.
+func (s *cartService) MergeCarts(ctx context.Context, targetID, sourceID string) (*model.Cart, error) {
+	log := logger.WithContext(ctx, s.logger)
+
+	var v validate.Validator
+	v.Check(sourceID != targetID, "source_cart_id", model.ErrMergeSameCart)
+	if err := v.Err(); err != nil {
+		log.Warn("invalid cart merge",
+			zap.Error(err),
+			zap.String("cart_id", targetID),
+		)
+		return nil, err
+	}
+
+	target, err := s.loadCart(ctx, targetID, auth.ScopeOrdersWrite)
+	if err != nil {
+		return nil, err
+	}
+	if target.UserID == "" {
+		return nil, model.ErrCartAnonymous
+	}
+
+	if err := s.cartRepo.Merge(ctx, targetID, sourceID); err != nil {
+		s.logMutationError(ctx, err, "failed to merge carts", targetID)
+		return nil, err
+	}
+
+	return s.GetCart(ctx, targetID)
+}
+
+// Checkout places an order for the cart's lines at current catalog prices.
+// The order repository closes the cart in the same transaction, so a cart
+// yields at most one order and cannot change once it has been ordered.
+func (s *cartService) Checkout(ctx context.Context, cartID string, params CheckoutParams) (*model.Order, error) {
+	log := logger.WithContext(ctx, s.logger)
+
+	cart, err := s.loadCart(ctx, cartID, auth.ScopeOrdersWrite)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case cart.Status != model.CartOpen:
+		err = model.ErrCartNotOpen
+	case cart.UserID == "":
+		err = model.ErrCartAnonymous
+	case len(cart.Items) == 0:
+		err = model.ErrEmptyCart
+	}
+	if err != nil {
+		log.Warn("cart cannot be checked out",
+			zap.Error(err),
+			zap.String("cart_id", cartID),
+		)
+		return nil, err
+	}
+
+	order, err := s.orderService.CreateOrder(ctx, CreateOrderParams{
+		UserID:          cart.UserID,
+		Items:           cart.OrderItems(),
+		CartID:          cart.ID,
+		CouponCodes:     params.CouponCodes,
+		TaxJurisdiction: params.TaxJurisdiction,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("cart checked out",
+		zap.String("cart_id", cartID),
+		zap.String("order_id", order.ID),
+	)
+
+	return order, nil
+}
+
+func (s *cartService) logMutationError(ctx context.Context, err error, msg, cartID string) {
+	switch {
+	case errors.Is(err, repository.ErrCartNotFound),
+		errors.Is(err, repository.ErrCartItemNotFound),
+		errors.Is(err, repository.ErrProductNotFound),
+		errors.Is(err, model.ErrCartNotOpen),
+		errors.Is(err, model.ErrCartNotAnonymous):
+		return
+	}
+	logger.WithContext(ctx, s.logger).Error(msg,
+		zap.Error(err),
+		zap.String("cart_id", cartID),
+	)
+}
+
+func isUUID(s string) bool {
+	_, err := uuid.Parse(s)
+	return err == nil
+}
+
+// authorizeUser checks that the caller may change data on behalf of userID.
+func authorizeUser(ctx context.Context, userID string) error {
+	principal, ok := auth.FromContext(ctx)
+	if !ok {
+		return auth.ErrUnauthenticated
+	}
+	if userID != "" && !principal.CanActFor(userID, auth.ScopeOrdersWrite) {
+		return auth.ErrForbidden
+	}
+	return nil
+}
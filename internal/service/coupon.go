@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/internal/repository"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"go.uber.org/zap"
+)
+
+type CouponService interface {
+	CreateCoupon(ctx context.Context, coupon model.Coupon) (*model.Coupon, error)
+	GetCoupon(ctx context.Context, code string) (*model.Coupon, error)
+	ListCoupons(ctx context.Context, params ListCouponsParams) ([]*model.Coupon, error)
+	UpdateCoupon(ctx context.Context, code string, update CouponUpdate) (*model.Coupon, error)
+}
+
+type ListCouponsParams struct {
+	ActiveOnly bool
+	Limit      int
+	Offset     int
+}
+
+// CouponUpdate holds the fields to change; nil fields are left as is. The
+// discount and its rules are fixed once a coupon is issued.
+type CouponUpdate struct {
+	Active *bool
+	EndsAt *time.Time
+}
+
+type couponService struct {
+	couponRepo repository.CouponRepository
+	logger     logger.Logger
+}
+
+func NewCouponService(couponRepo repository.CouponRepository, logger logger.Logger) CouponService {
+	return &couponService{
+		couponRepo: couponRepo,
+		logger:     logger.With(zap.String("component", "service"))}
+}
+
+func (s *couponService) CreateCoupon(ctx context.Context, c model.Coupon) (*model.Coupon, error) {
+	log := logger.WithContext(ctx, s.logger)
+
+	coupon, err := model.NewCoupon(c)
+	if err != nil {
+		log.Warn("invalid coupon",
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	if err := s.couponRepo.Create(ctx, coupon); err != nil {
+		return nil, err
+	}
+
+	log.Info("coupon created",
+		zap.String("coupon_id", coupon.ID),
+		zap.String("code", coupon.Code),
+		zap.String("type", string(coupon.Type)),
+	)
+	return coupon, nil
+}
+
+func (s *couponService) GetCoupon(ctx context.Context, code string) (*model.Coupon, error) {
+	code = model.NormalizeCouponCode(code)
+	if code == "" {
+		return nil, ErrInvalidRequest
+	}
+	return s.couponRepo.GetByCode(ctx, code)
+}
+
+func (s *couponService) ListCoupons(ctx context.Context, params ListCouponsParams) ([]*model.Coupon, error) {
+	if params.Offset < 0 {
+		return nil, ErrInvalidRequest
+	}
+
+	limit := params.Limit
+	switch {
+	case limit <= 0:
+		limit = defaultPageSize
+	case limit > maxPageSize:
+		limit = maxPageSize
+	}
+
+	return s.couponRepo.List(ctx, repository.CouponFilter{
+		ActiveOnly: params.ActiveOnly,
+		Limit:      limit,
+		Offset:     params.Offset,
+	})
+}
+
+func (s *couponService) UpdateCoupon(ctx context.Context, code string, update CouponUpdate) (*model.Coupon, error) {
+	log := logger.WithContext(ctx, s.logger)
+
+	coupon, err := s.GetCoupon(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Active != nil {
+		coupon.Active = *update.Active
+	}
+	if update.EndsAt != nil {
+		coupon.EndsAt = update.EndsAt
+	}
+	if err := coupon.Validate(); err != nil {
+		log.Warn("invalid coupon update",
+			zap.Error(err),
+			zap.String("coupon_id", coupon.ID),
+		)
+		return nil, err
+	}
+	coupon.UpdatedAt = time.Now()
+
+	if err := s.couponRepo.Update(ctx, coupon); err != nil {
+		return nil, err
+	}
+
+	log.Info("coupon updated",
+		zap.String("coupon_id", coupon.ID),
+		zap.Bool("active", coupon.Active),
+	)
+	return coupon, nil
+}
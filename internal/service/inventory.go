@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/internal/repository"
+	"github.com/Kosench/ecommerce-lab/internal/validate"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"go.uber.org/zap"
+)
+
+// InventoryService manages stock levels. Reservations themselves happen in
+// the order repository, inside the transaction that writes the order.
+type InventoryService interface {
+	GetStock(ctx context.Context, productID string) (*model.StockLevel, error)
+	SetStock(ctx context.Context, productID string, onHand int) (*model.StockLevel, error)
+}
+
+type inventoryService struct {
+	stockRepo repository.StockRepository
+	logger    logger.Logger
+}
+
+func NewInventoryService(stockRepo repository.StockRepository, logger logger.Logger) InventoryService {
+	return &inventoryService{
+		stockRepo: stockRepo,
+		logger:    logger.With(zap.String("component", "service"))}
+}
+
+func (s *inventoryService) GetStock(ctx context.Context, productID string) (*model.StockLevel, error) {
+	if productID == "" {
+		return nil, ErrInvalidRequest
+	}
+	return s.stockRepo.Get(ctx, productID)
+}
+
+func (s *inventoryService) SetStock(ctx context.Context, productID string, onHand int) (*model.StockLevel, error) {
+	log := logger.WithContext(ctx, s.logger)
+
+	if productID == "" {
+		return nil, ErrInvalidRequest
+	}
+	if onHand < 0 {
+		log.Warn("negative stock requested",
+			zap.String("product_id", productID),
+			zap.Int("on_hand", onHand),
+		)
+		return nil, validate.Errors{{Field: "on_hand", Err: model.ErrInvalidStock}}
+	}
+
+	return s.stockRepo.SetOnHand(ctx, productID, onHand)
+}
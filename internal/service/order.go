@@ -2,65 +2,453 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"time"
 
+	"github.com/Kosench/ecommerce-lab/internal/auth"
+	"github.com/Kosench/ecommerce-lab/internal/metrics"
 	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/internal/policy"
 	"github.com/Kosench/ecommerce-lab/internal/repository"
+	"github.com/Kosench/ecommerce-lab/internal/tax"
+	"github.com/Kosench/ecommerce-lab/internal/validate"
 	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"github.com/Kosench/ecommerce-lab/platform/tracing"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
 type OrderService interface {
-	CreateOrder(ctx context.Context, userID string, items []model.OrderItem) (*model.Order, error)
+	CreateOrder(ctx context.Context, params CreateOrderParams) (*model.Order, error)
+	GetOrder(ctx context.Context, id string) (*model.Order, error)
+	ListOrders(ctx context.Context, params ListOrdersParams) (*OrderPage, error)
+	CancelOrder(ctx context.Context, id string) (*model.Order, error)
 }
 
+type CreateOrderParams struct {
+	UserID string
+	Items  []model.OrderItem
+	// CartID, if set, is the cart being checked out. It is closed in the
+	// same transaction that inserts the order.
+	CartID string
+	// CouponCodes are applied in the order given.
+	CouponCodes []string
+	// TaxJurisdiction is where the order is taxed; "" is the default.
+	TaxJurisdiction string
+}
+
+type ListOrdersParams struct {
+	UserID      string
+	Status      model.OrderStatus
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	Cursor      string
+	Limit       int
+}
+
+type OrderPage struct {
+	Orders     []*model.Order
+	NextCursor string
+}
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
 type orderService struct {
-	orderRepo repository.OrderRepository
-	logger    logger.Logger
+	orderRepo   repository.OrderRepository
+	productRepo repository.ProductRepository
+	couponRepo  repository.CouponRepository
+	taxes       tax.Calculator
+	authz       *policy.Authorizer
+	logger      logger.Logger
 }
 
-func NewOrderService(orderRepo repository.OrderRepository, logger logger.Logger) OrderService {
+func NewOrderService(orderRepo repository.OrderRepository, productRepo repository.ProductRepository, couponRepo repository.CouponRepository, taxes tax.Calculator, authz *policy.Authorizer, logger logger.Logger) OrderService {
 	return &orderService{
-		orderRepo: orderRepo,
-		logger:    logger.With(zap.String("component", "service"))}
+		orderRepo:   orderRepo,
+		productRepo: productRepo,
+		couponRepo:  couponRepo,
+		taxes:       taxes,
+		authz:       authz,
+		logger:      logger.With(zap.String("component", "service"))}
 }
 
+var tracer = tracing.Tracer("github.com/Kosench/ecommerce-lab/internal/service")
+
 var (
 	ErrInvalidRequest = errors.New("invalid request")
+	ErrInvalidCursor  = errors.New("invalid cursor")
+
+	ErrInvalidTimeRange = errors.New("must be before created_to")
 )
 
-func (s *orderService) CreateOrder(ctx context.Context, userID string, items []model.OrderItem) (*model.Order, error) {
-	if userID == "" {
-		s.logger.Warn("empty user_id")
-		return nil, ErrInvalidRequest
+func (s *orderService) CreateOrder(ctx context.Context, params CreateOrderParams) (*model.Order, error) {
+	ctx, span := tracer.Start(ctx, "OrderService.CreateOrder",
+		trace.WithAttributes(
+			attribute.String("user_id", params.UserID),
+			attribute.Int("items_count", len(params.Items)),
+		),
+	)
+	defer span.End()
+	if params.CartID != "" {
+		span.SetAttributes(attribute.String("cart_id", params.CartID))
+	}
+
+	order, err := s.createOrder(ctx, params)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+
+	span.SetAttributes(
+		attribute.String("order_id", order.ID),
+		attribute.Int64("total", order.Total.Amount()),
+		attribute.String("currency", string(order.Currency)),
+	)
+	return order, nil
+}
+
+func (s *orderService) createOrder(ctx context.Context, params CreateOrderParams) (*model.Order, error) {
+	log := logger.WithContext(ctx, s.logger)
+
+	if err := s.authz.Authorize(ctx, policy.ActionOrderCreate, policy.Resource{OwnerID: params.UserID}); err != nil {
+		return nil, err
+	}
+
+	if err := model.ValidateOrderInput(params.UserID, params.Items); err != nil {
+		log.Warn("invalid order request",
+			zap.Error(err),
+			zap.String("user_id", params.UserID),
+		)
+		return nil, err
+	}
+
+	priced, err := s.priceItems(ctx, params.Items)
+	if err != nil {
+		return nil, err
+	}
+	coupons, err := s.findCoupons(ctx, params.CouponCodes)
+	if err != nil {
+		return nil, err
 	}
 
-	order, err := model.NewOrder(userID, items)
+	order, err := model.NewOrder(params.UserID, priced, coupons)
+	if err == nil {
+		err = order.ApplyTax(s.taxes, params.TaxJurisdiction)
+	}
 	if err != nil {
-		s.logger.Warn("invalid order model",
+		log.Warn("invalid order model",
 			zap.Error(err),
-			zap.String("user_id", userID),
+			zap.String("user_id", params.UserID),
 		)
 		return nil, err
 	}
+	order.CartID = params.CartID
 
-	s.logger.Debug("creating order in repository",
+	log.Debug("creating order in repository",
 		zap.String("order_id", order.ID),
 		zap.String("user_id", order.UserID),
-		zap.Int64("total", order.Total),
+		zap.Stringer("total", order.Total),
+		zap.Stringer("discount", order.Discount),
+		zap.Stringer("tax", order.Tax),
 	)
 
 	if err := s.orderRepo.Create(ctx, order); err != nil {
-		s.logger.Error("failed to save order to repository",
+		log.Error("failed to save order to repository",
 			zap.Error(err),
 			zap.String("order_id", order.ID),
 		)
 		return nil, err
 	}
 
-	s.logger.Info("order created",
+	log.Info("order created",
 		zap.String("order_id", order.ID),
 	)
 
+	metrics.OrdersCreated.Inc()
+	metrics.OrderValue.WithLabelValues(string(order.Currency)).Add(float64(order.Total.Amount()))
+
 	return order, nil
 }
+
+// priceItems fills in the current catalog name and price of every item.
+// Prices sent by clients are never trusted.
+func (s *orderService) priceItems(ctx context.Context, items []model.OrderItem) ([]model.OrderItem, error) {
+	log := logger.WithContext(ctx, s.logger)
+
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ProductID)
+	}
+
+	products, err := s.productRepo.GetByIDs(ctx, ids)
+	if err != nil {
+		log.Error("failed to load products for order",
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	var v validate.Validator
+	priced := make([]model.OrderItem, len(items))
+	for i, item := range items {
+		field := validate.Index("items", i, "product_id")
+
+		product, ok := products[item.ProductID]
+		if !ok {
+			log.Warn("unknown product in order",
+				zap.Int("item_index", i),
+				zap.String("product_id", item.ProductID),
+			)
+			v.Add(field, repository.ErrProductNotFound)
+			continue
+		}
+		if !product.Active {
+			log.Warn("inactive product in order",
+				zap.Int("item_index", i),
+				zap.String("product_id", item.ProductID),
+			)
+			v.Add(field, model.ErrProductInactive)
+			continue
+		}
+
+		priced[i] = model.OrderItem{
+			ProductID:   product.ID,
+			ProductName: product.Name,
+			Quantity:    item.Quantity,
+			Price:       product.Price,
+			TaxCategory: product.TaxCategory,
+		}
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	return priced, nil
+}
+
+// findCoupons looks up coupons by code, keeping the order of codes so
+// problems are reported against the right coupon_codes[i].
+func (s *orderService) findCoupons(ctx context.Context, codes []string) ([]*model.Coupon, error) {
+	if len(codes) == 0 {
+		return nil, nil
+	}
+
+	normalized := make([]string, len(codes))
+	for i, code := range codes {
+		normalized[i] = model.NormalizeCouponCode(code)
+	}
+
+	found, err := s.couponRepo.GetByCodes(ctx, normalized)
+	if err != nil {
+		logger.WithContext(ctx, s.logger).Error("failed to load coupons for order",
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	var v validate.Validator
+	coupons := make([]*model.Coupon, len(codes))
+	for i, code := range normalized {
+		coupon, ok := found[code]
+		v.Check(ok, fmt.Sprintf("coupon_codes[%d]", i), repository.ErrCouponNotFound)
+		coupons[i] = coupon
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	return coupons, nil
+}
+
+func (s *orderService) GetOrder(ctx context.Context, id string) (*model.Order, error) {
+	log := logger.WithContext(ctx, s.logger)
+
+	if id == "" {
+		log.Warn("empty order id")
+		return nil, ErrInvalidRequest
+	}
+
+	order, err := s.loadOrder(ctx, id, policy.ActionOrderRead)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug("order loaded",
+		zap.String("order_id", order.ID),
+		zap.String("status", string(order.Status)),
+	)
+
+	return order, nil
+}
+
+// loadOrder loads an order and checks the caller may perform action on it.
+func (s *orderService) loadOrder(ctx context.Context, id, action string) (*model.Order, error) {
+	log := logger.WithContext(ctx, s.logger)
+
+	order, err := s.orderRepo.GetByID(ctx, id)
+	if err != nil {
+		if !errors.Is(err, repository.ErrOrderNotFound) {
+			log.Error("failed to load order from repository",
+				zap.Error(err),
+				zap.String("order_id", id),
+			)
+		}
+		return nil, err
+	}
+
+	res := policy.Resource{OwnerID: order.UserID, Status: string(order.Status)}
+	if err := s.authz.Authorize(ctx, action, res); err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// ListOrders lists orders across users if the policy allows it. Callers
+// who may only see their own orders get those when they give no user filter.
+func (s *orderService) ListOrders(ctx context.Context, params ListOrdersParams) (*OrderPage, error) {
+	log := logger.WithContext(ctx, s.logger)
+
+	if principal, ok := auth.FromContext(ctx); ok && params.UserID == "" && principal.UserID != "" &&
+		!s.authz.Allows(ctx, policy.ActionOrderList, policy.Resource{Status: string(params.Status)}) {
+		params.UserID = principal.UserID
+	}
+	res := policy.Resource{OwnerID: params.UserID, Status: string(params.Status)}
+	if err := s.authz.Authorize(ctx, policy.ActionOrderList, res); err != nil {
+		return nil, err
+	}
+
+	var v validate.Validator
+	v.Check(params.Status == "" || params.Status.IsValid(), "status", model.ErrUnknownStatus)
+	v.Check(params.CreatedFrom.IsZero() || params.CreatedTo.IsZero() || params.CreatedFrom.Before(params.CreatedTo),
+		"created_from", ErrInvalidTimeRange)
+	if err := v.Err(); err != nil {
+		log.Warn("invalid order filter",
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	limit := params.Limit
+	switch {
+	case limit <= 0:
+		limit = defaultPageSize
+	case limit > maxPageSize:
+		limit = maxPageSize
+	}
+
+	filter := repository.OrderFilter{
+		UserID:      params.UserID,
+		Status:      params.Status,
+		CreatedFrom: params.CreatedFrom,
+		CreatedTo:   params.CreatedTo,
+		Limit:       limit + 1,
+	}
+	if params.Cursor != "" {
+		cursor, err := decodeCursor(params.Cursor)
+		if err != nil {
+			log.Warn("invalid cursor",
+				zap.Error(err),
+			)
+			return nil, ErrInvalidCursor
+		}
+		filter.After = cursor
+	}
+
+	orders, err := s.orderRepo.List(ctx, filter)
+	if err != nil {
+		log.Error("failed to list orders from repository",
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	page := &OrderPage{Orders: orders}
+	if len(orders) > limit {
+		page.Orders = orders[:limit]
+		last := page.Orders[limit-1]
+		page.NextCursor = encodeCursor(repository.OrderCursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+
+	log.Debug("orders listed",
+		zap.Int("orders_count", len(page.Orders)),
+		zap.Bool("has_more", page.NextCursor != ""),
+	)
+
+	return page, nil
+}
+
+func (s *orderService) CancelOrder(ctx context.Context, id string) (*model.Order, error) {
+	return s.transition(ctx, id, policy.ActionOrderCancel, model.StatusCancelled)
+}
+
+func (s *orderService) transition(ctx context.Context, id, action string, status model.OrderStatus) (*model.Order, error) {
+	log := logger.WithContext(ctx, s.logger)
+
+	if id == "" {
+		log.Warn("empty order id")
+		return nil, ErrInvalidRequest
+	}
+
+	if _, err := s.loadOrder(ctx, id, action); err != nil {
+		return nil, err
+	}
+
+	order, err := s.orderRepo.UpdateStatus(ctx, id, status)
+	if err != nil {
+		if !errors.Is(err, repository.ErrOrderNotFound) && !errors.Is(err, model.ErrInvalidTransition) {
+			log.Error("failed to update order status",
+				zap.Error(err),
+				zap.String("order_id", id),
+				zap.String("status", string(status)),
+			)
+		}
+		return nil, err
+	}
+
+	log.Info("order status changed",
+		zap.String("order_id", order.ID),
+		zap.String("status", string(order.Status)),
+	)
+
+	return order, nil
+}
+
+type cursorPayload struct {
+	CreatedAt time.Time `json:"t"`
+	ID        string    `json:"id"`
+}
+
+func encodeCursor(c repository.OrderCursor) string {
+	b, _ := json.Marshal(cursorPayload{CreatedAt: c.CreatedAt, ID: c.ID})
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*repository.OrderCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var p cursorPayload
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, err
+	}
+	if p.CreatedAt.IsZero() {
+		return nil, errors.New("cursor has no timestamp")
+	}
+	if _, err := uuid.Parse(p.ID); err != nil {
+		return nil, err
+	}
+
+	return &repository.OrderCursor{CreatedAt: p.CreatedAt, ID: p.ID}, nil
+}
@@ -0,0 +1,514 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/internal/payments"
+	"github.com/Kosench/ecommerce-lab/internal/policy"
+	"github.com/Kosench/ecommerce-lab/internal/repository"
+	"github.com/Kosench/ecommerce-lab/internal/validate"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"go.uber.org/zap"
+)
+
+type PaymentService interface {
+	// PayOrder charges the order total to paymentMethod. The order becomes
+	// paid only once the provider has captured the money.
+	PayOrder(ctx context.Context, orderID, paymentMethod string) (*model.Order, error)
+	// HandleEvent applies a verified webhook event from provider. Repeated
+	// deliveries are acknowledged without effect, and events that arrive
+	// after a later state are recorded but change nothing.
+	HandleEvent(ctx context.Context, provider string, event payments.Event, payload []byte) error
+	// RefundOrder gives money back on a paid order through the provider that
+	// captured it and records the refund on the order.
+	RefundOrder(ctx context.Context, params RefundOrderParams) (*model.Order, error)
+}
+
+// RefundOrderParams.Items lists the products and quantities to refund; if it
+// is empty, everything not refunded yet is.
+type RefundOrderParams struct {
+	OrderID string
+	Items   []model.RefundItem
+	Reason  string
+}
+
+type paymentService struct {
+	orderRepo   repository.OrderRepository
+	paymentRepo repository.PaymentRepository
+	eventRepo   repository.PaymentEventRepository
+	provider    payments.PaymentProvider
+	authz       *policy.Authorizer
+	logger      logger.Logger
+}
+
+func NewPaymentService(orderRepo repository.OrderRepository, paymentRepo repository.PaymentRepository, eventRepo repository.PaymentEventRepository, provider payments.PaymentProvider, authz *policy.Authorizer, logger logger.Logger) PaymentService {
+	return &paymentService{
+		orderRepo:   orderRepo,
+		paymentRepo: paymentRepo,
+		eventRepo:   eventRepo,
+		provider:    provider,
+		authz:       authz,
+		logger:      logger.With(zap.String("component", "service"))}
+}
+
+func (s *paymentService) PayOrder(ctx context.Context, orderID, paymentMethod string) (*model.Order, error) {
+	log := logger.WithContext(ctx, s.logger)
+
+	var v validate.Validator
+	v.Check(paymentMethod != "", "payment_method", model.ErrEmptyPaymentMethod)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	order, err := s.orderRepo.GetByID(ctx, orderID)
+	if err != nil {
+		if !errors.Is(err, repository.ErrOrderNotFound) {
+			log.Error("failed to load order from repository",
+				zap.Error(err),
+				zap.String("order_id", orderID),
+			)
+		}
+		return nil, err
+	}
+	res := policy.Resource{OwnerID: order.UserID, Status: string(order.Status)}
+	if err := s.authz.Authorize(ctx, policy.ActionOrderPay, res); err != nil {
+		return nil, err
+	}
+	if !order.Status.CanTransitionTo(model.StatusPaid) {
+		return nil, fmt.Errorf("%w: %s -> %s", model.ErrInvalidTransition, order.Status, model.StatusPaid)
+	}
+
+	payment := model.NewPayment(order.ID, s.provider.Name(), order.Total)
+	if err := s.paymentRepo.Create(ctx, payment); err != nil {
+		return nil, err
+	}
+
+	auth, err := s.provider.Authorize(ctx, payments.AuthorizeRequest{
+		OrderID:       order.ID,
+		Amount:        payment.Amount,
+		PaymentMethod: paymentMethod,
+	})
+	if err != nil {
+		return nil, s.fail(ctx, payment, "authorize", err)
+	}
+	payment.Authorized(auth.ID)
+	if err := s.paymentRepo.Update(ctx, payment); err != nil {
+		return nil, err
+	}
+
+	capture, err := s.provider.Capture(ctx, auth.ID, payment.Amount)
+	if err != nil {
+		if voidErr := s.provider.Void(ctx, auth.ID); voidErr != nil {
+			log.Warn("failed to void authorization after failed capture",
+				zap.Error(voidErr),
+				zap.String("payment_id", payment.ID),
+			)
+		}
+		return nil, s.fail(ctx, payment, "capture", err)
+	}
+	payment.Captured(capture.ID)
+	if err := s.paymentRepo.Update(ctx, payment); err != nil {
+		return nil, err
+	}
+
+	paid, err := s.orderRepo.UpdateStatus(ctx, order.ID, model.StatusPaid)
+	if errors.Is(err, model.ErrInvalidTransition) {
+		if current, ok := s.paidByWebhook(ctx, payment); ok {
+			return current, nil
+		}
+		// The order changed while the payment went through, e.g. it was
+		// cancelled. Give the money back.
+		s.refundCapture(ctx, payment)
+		return nil, err
+	}
+	if err != nil {
+		// The money is captured but the order is not marked paid; the
+		// payment record is what reconciliation starts from.
+		log.Error("failed to mark captured order paid",
+			zap.Error(err),
+			zap.String("order_id", order.ID),
+			zap.String("payment_id", payment.ID),
+		)
+		return nil, err
+	}
+
+	log.Info("order paid",
+		zap.String("order_id", order.ID),
+		zap.String("payment_id", payment.ID),
+		zap.Stringer("amount", payment.Amount),
+	)
+
+	return paid, nil
+}
+
+// fail records a failed provider operation on the payment. Declines keep the
+// provider's code; any other error is reported as a provider failure.
+func (s *paymentService) fail(ctx context.Context, payment *model.Payment, op string, err error) error {
+	log := logger.WithContext(ctx, s.logger)
+
+	var decline *payments.DeclineError
+	if errors.As(err, &decline) {
+		payment.Failed(decline.Code, decline.Message)
+		log.Warn("payment declined",
+			zap.String("payment_id", payment.ID),
+			zap.String("operation", op),
+			zap.String("provider_code", decline.Code),
+		)
+	} else {
+		payment.Failed("provider_error", err.Error())
+		log.Error("payment provider failed",
+			zap.Error(err),
+			zap.String("payment_id", payment.ID),
+			zap.String("operation", op),
+		)
+		err = fmt.Errorf("%w: %s: %w", payments.ErrProviderFailed, op, err)
+	}
+
+	if updateErr := s.paymentRepo.Update(ctx, payment); updateErr != nil {
+		return updateErr
+	}
+	return err
+}
+
+func (s *paymentService) refundCapture(ctx context.Context, payment *model.Payment) {
+	log := logger.WithContext(ctx, s.logger)
+
+	if _, err := s.provider.Refund(ctx, payment.CaptureID, payment.Amount); err != nil {
+		log.Error("failed to refund capture for unpayable order",
+			zap.Error(err),
+			zap.String("payment_id", payment.ID),
+		)
+		return
+	}
+	payment.Refunded()
+	if err := s.paymentRepo.Update(ctx, payment); err != nil {
+		return
+	}
+	log.Warn("capture refunded, order could no longer be paid",
+		zap.String("payment_id", payment.ID),
+		zap.String("order_id", payment.OrderID),
+	)
+}
+
+// paidByWebhook reports whether the provider's capture webhook already marked
+// the order paid by payment, rather than another payment.
+func (s *paymentService) paidByWebhook(ctx context.Context, payment *model.Payment) (*model.Order, bool) {
+	order, err := s.orderRepo.GetByID(ctx, payment.OrderID)
+	if err != nil || order.Status != model.StatusPaid {
+		return nil, false
+	}
+	others, err := s.paymentRepo.ListByOrder(ctx, payment.OrderID)
+	if err != nil {
+		return nil, false
+	}
+	for _, p := range others {
+		if p.ID != payment.ID && p.Status == model.PaymentCaptured {
+			return nil, false
+		}
+	}
+	return order, true
+}
+
+func (s *paymentService) HandleEvent(ctx context.Context, provider string, event payments.Event, payload []byte) error {
+	log := logger.WithContext(ctx, s.logger)
+
+	stored, err := s.eventRepo.Record(ctx, model.NewPaymentEvent(provider, event.ID, string(event.Type), event.OrderID, payload))
+	if err != nil {
+		return err
+	}
+	if stored.ProcessedAt != nil {
+		log.Info("duplicate payment event",
+			zap.String("provider", provider),
+			zap.String("event_id", event.ID),
+		)
+		return nil
+	}
+
+	// An event that fails here stays unprocessed, so the provider's
+	// redelivery retries it.
+	outcome, err := s.applyEvent(ctx, provider, event)
+	if err != nil {
+		return err
+	}
+	if err := s.eventRepo.MarkProcessed(ctx, stored.ID, outcome, time.Now()); err != nil {
+		return err
+	}
+
+	log.Info("payment event processed",
+		zap.String("provider", provider),
+		zap.String("event_id", event.ID),
+		zap.String("event_type", string(event.Type)),
+		zap.String("order_id", event.OrderID),
+		zap.String("outcome", string(outcome)),
+	)
+	return nil
+}
+
+// applyEvent moves the payment and the order forward to what event reports.
+// Either may already be past that point when events arrive out of order;
+// such a step is skipped.
+func (s *paymentService) applyEvent(ctx context.Context, provider string, event payments.Event) (model.PaymentEventOutcome, error) {
+	log := logger.WithContext(ctx, s.logger)
+
+	if !isUUID(event.OrderID) {
+		log.Warn("payment event for invalid order id",
+			zap.String("event_id", event.ID),
+			zap.String("order_id", event.OrderID),
+		)
+		return model.PaymentEventIgnored, nil
+	}
+
+	var (
+		paymentStatus model.PaymentStatus
+		orderStatus   model.OrderStatus
+	)
+	switch event.Type {
+	case payments.EventPaymentCaptured:
+		paymentStatus, orderStatus = model.PaymentCaptured, model.StatusPaid
+	case payments.EventPaymentFailed:
+		// The order stays pending so it can be paid again.
+		paymentStatus = model.PaymentFailed
+	}
+
+	// The payment may not be recorded yet if the webhook overtook PayOrder;
+	// the order is updated all the same.
+	payment, err := s.paymentRepo.GetByAuthorizationID(ctx, provider, event.AuthorizationID)
+	if err != nil && !errors.Is(err, repository.ErrPaymentNotFound) {
+		return "", err
+	}
+	if payment != nil && payment.OrderID != event.OrderID {
+		payment = nil
+	}
+
+	if event.Type == payments.EventPaymentRefunded {
+		return s.applyRefundEvent(ctx, event, payment)
+	}
+
+	applied := false
+	if payment != nil && payment.Status.Precedes(paymentStatus) {
+		switch paymentStatus {
+		case model.PaymentCaptured:
+			payment.Captured(event.CaptureID)
+		case model.PaymentFailed:
+			payment.Failed(event.FailureCode, event.FailureMessage)
+		}
+		if err := s.paymentRepo.Update(ctx, payment); err != nil {
+			return "", err
+		}
+		applied = true
+	}
+
+	if orderStatus != "" {
+		_, err := s.orderRepo.UpdateStatus(ctx, event.OrderID, orderStatus)
+		switch {
+		case errors.Is(err, model.ErrInvalidTransition):
+			// Already there, or past it.
+		case errors.Is(err, repository.ErrOrderNotFound):
+			log.Warn("payment event for unknown order",
+				zap.String("event_id", event.ID),
+				zap.String("order_id", event.OrderID),
+			)
+		case err != nil:
+			return "", err
+		default:
+			applied = true
+		}
+	}
+
+	return outcome(applied), nil
+}
+
+// applyRefundEvent handles a refund the provider reports. Refunds made
+// through RefundOrder are recorded already, so their echo changes nothing.
+// A full refund made elsewhere, such as in the provider's dashboard, is
+// recorded for whatever the order had left. A partial one cannot be tied to
+// items and is left to reconciliation.
+func (s *paymentService) applyRefundEvent(ctx context.Context, event payments.Event, payment *model.Payment) (model.PaymentEventOutcome, error) {
+	log := logger.WithContext(ctx, s.logger)
+
+	if payment == nil {
+		captured, err := s.capturedPayment(ctx, event.OrderID)
+		if errors.Is(err, model.ErrNoCapturedPayment) {
+			log.Warn("refund event for order without captured payment",
+				zap.String("event_id", event.ID),
+				zap.String("order_id", event.OrderID),
+			)
+			return model.PaymentEventIgnored, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		payment = captured
+	}
+	if event.Amount > 0 && event.Amount < payment.Amount.Amount() {
+		log.Info("partial refund event left to reconciliation",
+			zap.String("event_id", event.ID),
+			zap.String("order_id", event.OrderID),
+			zap.Int64("amount", event.Amount),
+		)
+		return model.PaymentEventIgnored, nil
+	}
+
+	applied := false
+	if payment.Status.Precedes(model.PaymentRefunded) {
+		payment.Refunded()
+		if err := s.paymentRepo.Update(ctx, payment); err != nil {
+			return "", err
+		}
+		applied = true
+	}
+
+	order, err := s.orderRepo.GetByID(ctx, event.OrderID)
+	if errors.Is(err, repository.ErrOrderNotFound) {
+		log.Warn("payment event for unknown order",
+			zap.String("event_id", event.ID),
+			zap.String("order_id", event.OrderID),
+		)
+		return outcome(applied), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	refund, err := order.NewRefund(nil, "refunded by the payment provider")
+	if errors.Is(err, model.ErrNothingToRefund) || errors.Is(err, model.ErrOrderNotRefundable) {
+		// Refunded through RefundOrder, or never paid.
+		return outcome(applied), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	refund.PaymentID = payment.ID
+	if _, err := s.orderRepo.AddRefund(ctx, refund); err != nil {
+		if errors.Is(err, model.ErrRefundExceedsTotal) || errors.Is(err, model.ErrRefundQuantityExceeded) ||
+			errors.Is(err, model.ErrOrderNotRefundable) {
+			// Another refund was recorded in the meantime.
+			return outcome(applied), nil
+		}
+		return "", err
+	}
+	return model.PaymentEventApplied, nil
+}
+
+func outcome(applied bool) model.PaymentEventOutcome {
+	if applied {
+		return model.PaymentEventApplied
+	}
+	return model.PaymentEventIgnored
+}
+
+func (s *paymentService) RefundOrder(ctx context.Context, params RefundOrderParams) (*model.Order, error) {
+	log := logger.WithContext(ctx, s.logger)
+
+	var v validate.Validator
+	for i, item := range params.Items {
+		v.Check(isUUID(item.ProductID), validate.Index("items", i, "product_id"), model.ErrInvalidProduct)
+		v.Check(item.Quantity > 0, validate.Index("items", i, "quantity"), model.ErrInvalidQuantity)
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	order, err := s.orderRepo.GetByID(ctx, params.OrderID)
+	if err != nil {
+		if !errors.Is(err, repository.ErrOrderNotFound) {
+			log.Error("failed to load order from repository",
+				zap.Error(err),
+				zap.String("order_id", params.OrderID),
+			)
+		}
+		return nil, err
+	}
+	res := policy.Resource{OwnerID: order.UserID, Status: string(order.Status)}
+	if err := s.authz.Authorize(ctx, policy.ActionOrderRefund, res); err != nil {
+		return nil, err
+	}
+	if !order.Status.IsRefundable() {
+		return nil, fmt.Errorf("%w: order is %s", model.ErrOrderNotRefundable, order.Status)
+	}
+
+	payment, err := s.capturedPayment(ctx, order.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The refund is priced and held back under the order's lock before the
+	// provider is asked, so concurrent refunds cannot together give back
+	// more than was paid.
+	refund, err := s.orderRepo.ReserveRefund(ctx, order.ID, payment.ID, params.Items, params.Reason)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.provider.Refund(ctx, payment.CaptureID, refund.Amount)
+	if err != nil {
+		if voidErr := s.orderRepo.VoidRefund(context.WithoutCancel(ctx), order.ID, refund.ID); voidErr != nil {
+			log.Error("failed to void refund the provider did not make",
+				zap.Error(voidErr),
+				zap.String("order_id", order.ID),
+				zap.String("refund_id", refund.ID),
+			)
+		}
+		if !errors.Is(err, payments.ErrPaymentDeclined) {
+			log.Error("payment provider failed to refund",
+				zap.Error(err),
+				zap.String("order_id", order.ID),
+				zap.String("payment_id", payment.ID),
+			)
+			err = fmt.Errorf("%w: refund: %w", payments.ErrProviderFailed, err)
+		}
+		return nil, err
+	}
+
+	refunded, err := s.orderRepo.ConfirmRefund(context.WithoutCancel(ctx), order.ID, refund.ID, tx.ID)
+	if err != nil {
+		// The money is back with the customer but the refund is still
+		// pending, so it keeps holding the amount back; the provider's
+		// refund ID is what reconciliation starts from.
+		log.Error("failed to confirm provider refund",
+			zap.Error(err),
+			zap.String("order_id", order.ID),
+			zap.String("refund_id", refund.ID),
+			zap.String("provider_refund_id", tx.ID),
+			zap.Stringer("amount", refund.Amount),
+		)
+		return nil, err
+	}
+
+	if refunded.Status == model.StatusRefunded {
+		payment.Refunded()
+		if err := s.paymentRepo.Update(ctx, payment); err != nil {
+			log.Warn("failed to mark payment refunded",
+				zap.Error(err),
+				zap.String("payment_id", payment.ID),
+			)
+		}
+	}
+
+	log.Info("order refunded",
+		zap.String("order_id", order.ID),
+		zap.String("refund_id", refund.ID),
+		zap.Stringer("amount", refund.Amount),
+		zap.String("status", string(refunded.Status)),
+	)
+
+	return refunded, nil
+}
+
+// capturedPayment returns the latest captured payment of an order.
+func (s *paymentService) capturedPayment(ctx context.Context, orderID string) (*model.Payment, error) {
+	list, err := s.paymentRepo.ListByOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(list) - 1; i >= 0; i-- {
+		if list[i].Status == model.PaymentCaptured {
+			return list[i], nil
+		}
+	}
+	return nil, model.ErrNoCapturedPayment
+}
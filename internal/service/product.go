@@ -0,0 +1,165 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/internal/money"
+	"github.com/Kosench/ecommerce-lab/internal/repository"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"go.uber.org/zap"
+)
+
+type ProductService interface {
+	CreateProduct(ctx context.Context, name, description string, price money.Money, taxCategory string) (*model.Product, error)
+	GetProduct(ctx context.Context, id string) (*model.Product, error)
+	ListProducts(ctx context.Context, params ListProductsParams) ([]*model.Product, error)
+	UpdateProduct(ctx context.Context, id string, update ProductUpdate) (*model.Product, error)
+	DeleteProduct(ctx context.Context, id string) error
+}
+
+type ListProductsParams struct {
+	ActiveOnly bool
+	Limit      int
+	Offset     int
+}
+
+// ProductUpdate holds the fields to change; nil fields are left as is.
+type ProductUpdate struct {
+	Name        *string
+	Description *string
+	Price       *int64
+	Currency    *money.Currency
+	TaxCategory *string
+	Active      *bool
+}
+
+type productService struct {
+	productRepo repository.ProductRepository
+	logger      logger.Logger
+}
+
+func NewProductService(productRepo repository.ProductRepository, logger logger.Logger) ProductService {
+	return &productService{
+		productRepo: productRepo,
+		logger:      logger.With(zap.String("component", "service"))}
+}
+
+func (s *productService) CreateProduct(ctx context.Context, name, description string, price money.Money, taxCategory string) (*model.Product, error) {
+	log := logger.WithContext(ctx, s.logger)
+
+	product, err := model.NewProduct(name, description, price, taxCategory)
+	if err != nil {
+		log.Warn("invalid product model",
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	if err := s.productRepo.Create(ctx, product); err != nil {
+		log.Error("failed to save product to repository",
+			zap.Error(err),
+			zap.String("product_id", product.ID),
+		)
+		return nil, err
+	}
+
+	log.Info("product created",
+		zap.String("product_id", product.ID),
+		zap.Stringer("price", product.Price),
+	)
+
+	return product, nil
+}
+
+func (s *productService) GetProduct(ctx context.Context, id string) (*model.Product, error) {
+	if id == "" {
+		return nil, ErrInvalidRequest
+	}
+	return s.productRepo.GetByID(ctx, id)
+}
+
+func (s *productService) ListProducts(ctx context.Context, params ListProductsParams) ([]*model.Product, error) {
+	if params.Offset < 0 {
+		return nil, ErrInvalidRequest
+	}
+
+	limit := params.Limit
+	switch {
+	case limit <= 0:
+		limit = defaultPageSize
+	case limit > maxPageSize:
+		limit = maxPageSize
+	}
+
+	return s.productRepo.List(ctx, repository.ProductFilter{
+		ActiveOnly: params.ActiveOnly,
+		Limit:      limit,
+		Offset:     params.Offset,
+	})
+}
+
+func (s *productService) UpdateProduct(ctx context.Context, id string, update ProductUpdate) (*model.Product, error) {
+	log := logger.WithContext(ctx, s.logger)
+
+	product, err := s.productRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Name != nil {
+		product.Name = *update.Name
+	}
+	if update.Description != nil {
+		product.Description = *update.Description
+	}
+	if update.Price != nil || update.Currency != nil {
+		amount, currency := product.Price.Amount(), product.Price.Currency()
+		if update.Price != nil {
+			amount = *update.Price
+		}
+		if update.Currency != nil {
+			currency = *update.Currency
+		}
+		product.Price = money.New(amount, currency)
+	}
+	if update.TaxCategory != nil {
+		product.TaxCategory = *update.TaxCategory
+	}
+	if update.Active != nil {
+		product.Active = *update.Active
+	}
+	if err := product.Validate(); err != nil {
+		log.Warn("invalid product update",
+			zap.Error(err),
+			zap.String("product_id", id),
+		)
+		return nil, err
+	}
+	product.UpdatedAt = time.Now()
+
+	if err := s.productRepo.Update(ctx, product); err != nil {
+		if !errors.Is(err, repository.ErrProductNotFound) {
+			log.Error("failed to update product in repository",
+				zap.Error(err),
+				zap.String("product_id", id),
+			)
+		}
+		return nil, err
+	}
+
+	log.Info("product updated",
+		zap.String("product_id", id),
+	)
+
+	return product, nil
+}
+
+func (s *productService) DeleteProduct(ctx context.Context, id string) error {
+	if id == "" {
+		return ErrInvalidRequest
+	}
+	return s.productRepo.Delete(ctx, id)
+}
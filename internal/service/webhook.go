@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/internal/repository"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"go.uber.org/zap"
+)
+
+type WebhookService interface {
+	CreateSubscription(ctx context.Context, url string, eventTypes []string) (*model.WebhookSubscription, error)
+	GetSubscription(ctx context.Context, id string) (*model.WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context) ([]*model.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, id string) error
+	RotateSecret(ctx context.Context, id string) (*model.WebhookSubscription, error)
+	ListDeliveries(ctx context.Context, subscriptionID string, limit int) ([]*model.WebhookDelivery, error)
+}
+
+type webhookService struct {
+	webhookRepo repository.WebhookRepository
+	logger      logger.Logger
+}
+
+func NewWebhookService(webhookRepo repository.WebhookRepository, logger logger.Logger) WebhookService {
+	return &webhookService{
+		webhookRepo: webhookRepo,
+		logger:      logger.With(zap.String("component", "service"))}
+}
+
+func (s *webhookService) CreateSubscription(ctx context.Context, url string, eventTypes []string) (*model.WebhookSubscription, error) {
+	log := logger.WithContext(ctx, s.logger)
+
+	sub, err := model.NewWebhookSubscription(url, eventTypes)
+	if err != nil {
+		log.Warn("invalid webhook subscription",
+			zap.Error(err),
+		)
+		return nil, err
+	}
+
+	if err := s.webhookRepo.CreateSubscription(ctx, sub); err != nil {
+		return nil, err
+	}
+
+	log.Info("webhook subscription created",
+		zap.String("subscription_id", sub.ID),
+		zap.Strings("event_types", sub.EventTypes),
+	)
+	return sub, nil
+}
+
+func (s *webhookService) GetSubscription(ctx context.Context, id string) (*model.WebhookSubscription, error) {
+	return s.webhookRepo.GetSubscription(ctx, id)
+}
+
+func (s *webhookService) ListSubscriptions(ctx context.Context) ([]*model.WebhookSubscription, error) {
+	return s.webhookRepo.ListSubscriptions(ctx)
+}
+
+func (s *webhookService) DeleteSubscription(ctx context.Context, id string) error {
+	log := logger.WithContext(ctx, s.logger)
+
+	if err := s.webhookRepo.DeleteSubscription(ctx, id); err != nil {
+		return err
+	}
+
+	log.Info("webhook subscription deleted",
+		zap.String("subscription_id", id),
+	)
+	return nil
+}
+
+func (s *webhookService) RotateSecret(ctx context.Context, id string) (*model.WebhookSubscription, error) {
+	log := logger.WithContext(ctx, s.logger)
+
+	sub, err := s.webhookRepo.GetSubscription(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := sub.RotateSecret(); err != nil {
+		return nil, err
+	}
+	if err := s.webhookRepo.UpdateSecret(ctx, sub); err != nil {
+		return nil, err
+	}
+
+	log.Info("webhook secret rotated",
+		zap.String("subscription_id", id),
+	)
+	return sub, nil
+}
+
+func (s *webhookService) ListDeliveries(ctx context.Context, subscriptionID string, limit int) ([]*model.WebhookDelivery, error) {
+	if _, err := s.webhookRepo.GetSubscription(ctx, subscriptionID); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case limit <= 0:
+		limit = defaultPageSize
+	case limit > maxPageSize:
+		limit = maxPageSize
+	}
+	return s.webhookRepo.ListDeliveries(ctx, subscriptionID, limit)
+}
@@ -0,0 +1,183 @@
+package tax
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/Kosench/ecommerce-lab/internal/money"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is a rate table as written in a config file:
+//
+//	rounding: half_even
+//	default_jurisdiction: US-CA
+//	default_category: standard
+//	jurisdictions:
+//	  US-CA:
+//	    standard: 7.25
+//	    groceries: 0
+//	  DE:
+//	    standard: 19
+//	    books: 7
+type Config struct {
+	// Rounding defaults to half_up.
+	Rounding Rounding `json:"rounding" yaml:"rounding"`
+	// DefaultJurisdiction taxes orders that name no jurisdiction. Without
+	// it, orders must name one.
+	DefaultJurisdiction string `json:"default_jurisdiction" yaml:"default_jurisdiction"`
+	// DefaultCategory is the category of products that have none, and
+	// whose rate applies to categories a jurisdiction does not list. Every
+	// jurisdiction must list it.
+	DefaultCategory string `json:"default_category" yaml:"default_category"`
+	// Jurisdictions maps each jurisdiction to its rates by tax category.
+	Jurisdictions map[string]map[string]Rate `json:"jurisdictions" yaml:"jurisdictions"`
+}
+
+// Rate is a tax rate in percent, such as 8.875. It is kept exact, so it is
+// given as a decimal number or string, never a fraction or exponent.
+type Rate struct {
+	percent *big.Rat
+}
+
+var ratePattern = regexp.MustCompile(`^[0-9]{1,3}(\.[0-9]{1,6})?$`)
+
+func ParseRate(s string) (Rate, error) {
+	if !ratePattern.MatchString(s) {
+		return Rate{}, fmt.Errorf("invalid tax rate %q: must be a decimal percentage", s)
+	}
+	percent, _ := new(big.Rat).SetString(s)
+	if percent.Cmp(big.NewRat(100, 1)) > 0 {
+		return Rate{}, fmt.Errorf("invalid tax rate %q: must be at most 100", s)
+	}
+	return Rate{percent: percent}, nil
+}
+
+func (r *Rate) UnmarshalJSON(b []byte) error {
+	rate, err := ParseRate(strings.Trim(string(b), `"`))
+	if err != nil {
+		return err
+	}
+	*r = rate
+	return nil
+}
+
+func (r *Rate) UnmarshalYAML(node *yaml.Node) error {
+	rate, err := ParseRate(node.Value)
+	if err != nil {
+		return err
+	}
+	*r = rate
+	return nil
+}
+
+// Table is a Calculator that looks rates up in a fixed table. Tax is worked
+// out and rounded line by line.
+type Table struct {
+	rounding            Rounding
+	defaultJurisdiction string
+	defaultCategory     string
+	// rates holds fractions, not percentages, by jurisdiction and category.
+	rates map[string]map[string]*big.Rat
+}
+
+// Load reads a rate table from a .json, .yaml or .yml file.
+func Load(path string) (*Table, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read tax rates: %w", err)
+	}
+
+	var cfg Config
+	switch filepath.Ext(path) {
+	case ".json":
+		err = json.Unmarshal(b, &cfg)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &cfg)
+	default:
+		return nil, fmt.Errorf("tax rates file %s: extension must be .json, .yaml or .yml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse tax rates: %w", err)
+	}
+	return NewTable(cfg)
+}
+
+func NewTable(cfg Config) (*Table, error) {
+	t := &Table{
+		rounding:            cfg.Rounding,
+		defaultJurisdiction: NormalizeJurisdiction(cfg.DefaultJurisdiction),
+		defaultCategory:     cfg.DefaultCategory,
+		rates:               make(map[string]map[string]*big.Rat, len(cfg.Jurisdictions)),
+	}
+	if t.rounding == "" {
+		t.rounding = RoundHalfUp
+	}
+
+	switch {
+	case !t.rounding.IsValid():
+		return nil, fmt.Errorf("tax rounding %q: must be one of half_up, half_even, down, up", cfg.Rounding)
+	case t.defaultCategory == "":
+		return nil, errors.New("tax rates: default_category is required")
+	case len(cfg.Jurisdictions) == 0:
+		return nil, errors.New("tax rates: no jurisdictions")
+	}
+
+	for name, categories := range cfg.Jurisdictions {
+		jurisdiction := NormalizeJurisdiction(name)
+		switch {
+		case jurisdiction == "":
+			return nil, errors.New("tax rates: jurisdiction name is required")
+		case t.rates[jurisdiction] != nil:
+			return nil, fmt.Errorf("tax rates: jurisdiction %q is listed twice", jurisdiction)
+		}
+
+		rates := make(map[string]*big.Rat, len(categories))
+		for category, rate := range categories {
+			if rate.percent == nil {
+				return nil, fmt.Errorf("tax rates: %s/%s has no rate", jurisdiction, category)
+			}
+			rates[category] = new(big.Rat).Quo(rate.percent, big.NewRat(100, 1))
+		}
+		if rates[t.defaultCategory] == nil {
+			return nil, fmt.Errorf("tax rates: jurisdiction %q has no rate for default category %q", jurisdiction, t.defaultCategory)
+		}
+		t.rates[jurisdiction] = rates
+	}
+	if t.defaultJurisdiction != "" && t.rates[t.defaultJurisdiction] == nil {
+		return nil, fmt.Errorf("tax rates: default jurisdiction %q is not listed", t.defaultJurisdiction)
+	}
+	return t, nil
+}
+
+func (t *Table) Calculate(jurisdiction string, lines []Line) (Result, error) {
+	jurisdiction = NormalizeJurisdiction(jurisdiction)
+	if jurisdiction == "" {
+		jurisdiction = t.defaultJurisdiction
+	}
+	if jurisdiction == "" {
+		return Result{}, ErrJurisdictionRequired
+	}
+	rates, ok := t.rates[jurisdiction]
+	if !ok {
+		return Result{}, ErrUnknownJurisdiction
+	}
+
+	res := Result{Jurisdiction: jurisdiction, Lines: make([]money.Money, len(lines))}
+	for i, line := range lines {
+		rate, ok := rates[line.Category]
+		if !ok {
+			rate = rates[t.defaultCategory]
+		}
+		// Rates are at most 100%, so the tax fits wherever the amount does.
+		num := new(big.Int).Mul(big.NewInt(line.Amount.Amount()), rate.Num())
+		res.Lines[i] = money.New(t.rounding.quo(num, rate.Denom()).Int64(), line.Amount.Currency())
+	}
+	return res, nil
+}
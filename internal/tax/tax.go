@@ -0,0 +1,101 @@
+// Package tax works out the tax on order lines.
+package tax
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/Kosench/ecommerce-lab/internal/money"
+)
+
+// Calculator prices the tax on the lines of an order.
+type Calculator interface {
+	// Calculate returns the tax on each line in jurisdiction. An empty
+	// jurisdiction is the calculator's default, if it has one.
+	Calculate(jurisdiction string, lines []Line) (Result, error)
+}
+
+type Line struct {
+	// Category is the product's tax category; "" is the default category.
+	Category string
+	// Amount is what the line is taxed on, after discounts.
+	Amount money.Money
+}
+
+type Result struct {
+	// Jurisdiction is the jurisdiction the lines were taxed in, once the
+	// default was applied.
+	Jurisdiction string
+	// Lines is the tax on each line, in the order given.
+	Lines []money.Money
+}
+
+// Calculation errors read as a continuation of the field naming the
+// jurisdiction, e.g. "tax_jurisdiction: is required".
+var (
+	ErrJurisdictionRequired = errors.New("is required")
+	ErrUnknownJurisdiction  = errors.New("is not a supported tax jurisdiction")
+)
+
+// NormalizeJurisdiction makes jurisdiction codes such as "US-CA"
+// case-insensitive.
+func NormalizeJurisdiction(jurisdiction string) string {
+	return strings.ToUpper(strings.TrimSpace(jurisdiction))
+}
+
+// None charges no tax anywhere.
+type None struct{}
+
+func (None) Calculate(jurisdiction string, lines []Line) (Result, error) {
+	res := Result{Jurisdiction: NormalizeJurisdiction(jurisdiction), Lines: make([]money.Money, len(lines))}
+	for i, line := range lines {
+		res.Lines[i] = money.Zero(line.Amount.Currency())
+	}
+	return res, nil
+}
+
+// Rounding says how tax amounts are rounded to the currency's minor unit.
+type Rounding string
+
+const (
+	// RoundHalfUp rounds halves away from zero.
+	RoundHalfUp Rounding = "half_up"
+	// RoundHalfEven rounds halves to the even neighbour.
+	RoundHalfEven Rounding = "half_even"
+	// RoundDown truncates toward zero.
+	RoundDown Rounding = "down"
+	// RoundUp rounds away from zero.
+	RoundUp Rounding = "up"
+)
+
+func (r Rounding) IsValid() bool {
+	switch r {
+	case RoundHalfUp, RoundHalfEven, RoundDown, RoundUp:
+		return true
+	}
+	return false
+}
+
+// quo returns num/den rounded by r. den must be positive.
+func (r Rounding) quo(num, den *big.Int) *big.Int {
+	q, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Sign() == 0 {
+		return q
+	}
+
+	away := false
+	half := new(big.Int).Abs(rem)
+	switch c := half.Lsh(half, 1).Cmp(den); r {
+	case RoundUp:
+		away = true
+	case RoundHalfUp:
+		away = c >= 0
+	case RoundHalfEven:
+		away = c > 0 || (c == 0 && q.Bit(0) == 1)
+	}
+	if away {
+		q.Add(q, big.NewInt(int64(num.Sign())))
+	}
+	return q
+}
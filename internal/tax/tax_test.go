@@ -0,0 +1,186 @@
+package tax_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Kosench/ecommerce-lab/internal/money"
+	"github.com/Kosench/ecommerce-lab/internal/tax"
+)
+
+func TestRounding(t *testing.T) {
+	roundings := []tax.Rounding{tax.RoundHalfUp, tax.RoundHalfEven, tax.RoundDown, tax.RoundUp}
+
+	// At 1%, an amount of 50 is taxed exactly half a minor unit. Wants are
+	// listed in the order of roundings.
+	tests := []struct {
+		name   string
+		amount int64
+		want   [4]int64
+	}{
+		{"zero", 0, [4]int64{0, 0, 0, 0}},
+		{"exact", 100, [4]int64{1, 1, 1, 1}},
+		{"just below half", 49, [4]int64{0, 0, 0, 1}},
+		{"half", 50, [4]int64{1, 0, 0, 1}},
+		{"just above half", 51, [4]int64{1, 1, 0, 1}},
+		{"one and a half", 150, [4]int64{2, 2, 1, 2}},
+		{"two and a half", 250, [4]int64{3, 2, 2, 3}},
+		{"negative just below half", -49, [4]int64{0, 0, 0, -1}},
+		{"negative half", -50, [4]int64{-1, 0, 0, -1}},
+		{"negative just above half", -51, [4]int64{-1, -1, 0, -1}},
+		{"negative one and a half", -150, [4]int64{-2, -2, -1, -2}},
+		{"negative two and a half", -250, [4]int64{-3, -2, -2, -3}},
+	}
+	for i, rounding := range roundings {
+		table := newTable(t, rounding, "1")
+		for _, tt := range tests {
+			t.Run(string(rounding)+"/"+tt.name, func(t *testing.T) {
+				got := calculate(t, table, tax.Line{Amount: money.New(tt.amount, money.USD)})
+				if want := money.New(tt.want[i], money.USD); got != want {
+					t.Errorf("tax on %d = %s, want %s", tt.amount, got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestFullRate(t *testing.T) {
+	for _, rounding := range []tax.Rounding{tax.RoundHalfUp, tax.RoundHalfEven, tax.RoundDown, tax.RoundUp} {
+		table := newTable(t, rounding, "100")
+		for _, amount := range []int64{1, 1234, -1234} {
+			got := calculate(t, table, tax.Line{Amount: money.New(amount, money.JPY)})
+			if want := money.New(amount, money.JPY); got != want {
+				t.Errorf("%s: tax on %d at 100%% = %s, want %s", rounding, amount, got, want)
+			}
+		}
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	for _, s := range []string{"0", "7", "8.875", "19.000001", "100", "100.000000"} {
+		if _, err := tax.ParseRate(s); err != nil {
+			t.Errorf("ParseRate(%q) error = %v", s, err)
+		}
+	}
+
+	for _, s := range []string{
+		"", " 7", "7 ", "-1", "+7", "7.", ".5", "1e2", "1/2", "0x10",
+		"7,5", "7%", "abc", "7.1234567", "1000", "100.000001", "250",
+	} {
+		if _, err := tax.ParseRate(s); err == nil {
+			t.Errorf("ParseRate(%q) error = nil, want rejected", s)
+		}
+	}
+}
+
+func TestTableDefaults(t *testing.T) {
+	table, err := tax.NewTable(tax.Config{
+		DefaultJurisdiction: "us-ca",
+		DefaultCategory:     "standard",
+		Jurisdictions: map[string]map[string]tax.Rate{
+			"US-CA": {"standard": rate(t, "10"), "groceries": rate(t, "0")},
+			"DE":    {"standard": rate(t, "19"), "books": rate(t, "7")},
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewTable() error = %v", err)
+	}
+
+	tests := []struct {
+		name             string
+		jurisdiction     string
+		category         string
+		want             int64
+		wantJurisdiction string
+	}{
+		{"listed category", "DE", "books", 70, "DE"},
+		{"no category takes the default", "DE", "", 190, "DE"},
+		{"unlisted category takes the default", "DE", "groceries", 190, "DE"},
+		{"no jurisdiction takes the default", "", "groceries", 0, "US-CA"},
+		{"default jurisdiction and category", "", "", 100, "US-CA"},
+		{"jurisdiction is case-insensitive", " de ", "books", 70, "DE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := table.Calculate(tt.jurisdiction, []tax.Line{{Category: tt.category, Amount: money.New(1000, money.EUR)}})
+			if err != nil {
+				t.Fatalf("Calculate() error = %v", err)
+			}
+			if res.Jurisdiction != tt.wantJurisdiction {
+				t.Errorf("jurisdiction = %q, want %q", res.Jurisdiction, tt.wantJurisdiction)
+			}
+			if want := money.New(tt.want, money.EUR); len(res.Lines) != 1 || res.Lines[0] != want {
+				t.Errorf("lines = %v, want [%s]", res.Lines, want)
+			}
+		})
+	}
+
+	if _, err := table.Calculate("FR", nil); !errors.Is(err, tax.ErrUnknownJurisdiction) {
+		t.Errorf("Calculate(FR) error = %v, want ErrUnknownJurisdiction", err)
+	}
+
+	noDefault := newTable(t, "", "10")
+	if _, err := noDefault.Calculate("", nil); !errors.Is(err, tax.ErrJurisdictionRequired) {
+		t.Errorf("Calculate() without default jurisdiction error = %v, want ErrJurisdictionRequired", err)
+	}
+}
+
+func TestNewTableRejects(t *testing.T) {
+	standard := map[string]tax.Rate{"standard": rate(t, "10")}
+
+	tests := []struct {
+		name string
+		cfg  tax.Config
+	}{
+		{"unknown rounding", tax.Config{Rounding: "nearest", DefaultCategory: "standard", Jurisdictions: map[string]map[string]tax.Rate{"DE": standard}}},
+		{"no default category", tax.Config{Jurisdictions: map[string]map[string]tax.Rate{"DE": standard}}},
+		{"no jurisdictions", tax.Config{DefaultCategory: "standard"}},
+		{"jurisdiction without the default category", tax.Config{DefaultCategory: "standard", Jurisdictions: map[string]map[string]tax.Rate{"DE": {"books": rate(t, "7")}}}},
+		{"category without a rate", tax.Config{DefaultCategory: "standard", Jurisdictions: map[string]map[string]tax.Rate{"DE": {"standard": {}}}}},
+		{"jurisdiction listed twice", tax.Config{DefaultCategory: "standard", Jurisdictions: map[string]map[string]tax.Rate{"DE": standard, "de": standard}}},
+		{"unlisted default jurisdiction", tax.Config{DefaultJurisdiction: "FR", DefaultCategory: "standard", Jurisdictions: map[string]map[string]tax.Rate{"DE": standard}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tax.NewTable(tt.cfg); err == nil {
+				t.Error("NewTable() error = nil, want rejected")
+			}
+		})
+	}
+}
+
+// newTable returns a table with one jurisdiction, XX, and no default
+// jurisdiction, taxing everything at percent.
+func newTable(t *testing.T, rounding tax.Rounding, percent string) *tax.Table {
+	t.Helper()
+
+	table, err := tax.NewTable(tax.Config{
+		Rounding:        rounding,
+		DefaultCategory: "standard",
+		Jurisdictions:   map[string]map[string]tax.Rate{"XX": {"standard": rate(t, percent)}},
+	})
+	if err != nil {
+		t.Fatalf("NewTable() error = %v", err)
+	}
+	return table
+}
+
+func calculate(t *testing.T, table *tax.Table, line tax.Line) money.Money {
+	t.Helper()
+
+	res, err := table.Calculate("XX", []tax.Line{line})
+	if err != nil {
+		t.Fatalf("Calculate() error = %v", err)
+	}
+	return res.Lines[0]
+}
+
+func rate(t *testing.T, s string) tax.Rate {
+	t.Helper()
+
+	r, err := tax.ParseRate(s)
+	if err != nil {
+		t.Fatalf("ParseRate(%q) error = %v", s, err)
+	}
+	return r
+}
@@ -0,0 +1,74 @@
+// Package validate collects field-level validation errors so a request can
+// report every problem at once instead of failing on the first.
+package validate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldError ties a validation error to the request field that caused it,
+// e.g. "items[3].quantity". Err is a sentinel callers match with errors.Is;
+// its message reads as a continuation of the field name ("must be positive").
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Errors is every field error found in one request. errors.Is and errors.As
+// see each of them.
+type Errors []*FieldError
+
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, fe := range e {
+		parts[i] = fe.Error()
+	}
+	return strings.Join(parts, "; ")
+}
+
+func (e Errors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, fe := range e {
+		errs[i] = fe
+	}
+	return errs
+}
+
+// Validator accumulates field errors. The zero value is ready to use.
+type Validator struct {
+	errs Errors
+}
+
+// Check records err against field unless ok holds.
+func (v *Validator) Check(ok bool, field string, err error) {
+	if !ok {
+		v.Add(field, err)
+	}
+}
+
+func (v *Validator) Add(field string, err error) {
+	v.errs = append(v.errs, &FieldError{Field: field, Err: err})
+}
+
+// Err returns the collected errors, or nil if there are none.
+func (v *Validator) Err() error {
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+// Index names an element field of a list, e.g. Index("items", 3, "quantity")
+// is "items[3].quantity".
+func Index(list string, i int, field string) string {
+	return fmt.Sprintf("%s[%d].%s", list, i, field)
+}
@@ -0,0 +1,223 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/internal/repository"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"go.uber.org/zap"
+)
+
+type DispatcherConfig struct {
+	PollInterval time.Duration
+	BatchSize    int
+	Timeout      time.Duration
+	MinBackoff   time.Duration
+	MaxBackoff   time.Duration
+	// Cutoff is how long after its creation a delivery is retried before it
+	// is given up as failed.
+	Cutoff time.Duration
+}
+
+// Dispatcher sends pending webhook deliveries and retries failed ones with
+// exponential backoff.
+type Dispatcher struct {
+	repo   repository.WebhookRepository
+	client *http.Client
+	cfg    DispatcherConfig
+	logger logger.Logger
+	now    func() time.Time
+}
+
+func NewDispatcher(repo repository.WebhookRepository, client *http.Client, cfg DispatcherConfig, logger logger.Logger) *Dispatcher {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = time.Second
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 20
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+	if cfg.MinBackoff <= 0 {
+		cfg.MinBackoff = 10 * time.Second
+	}
+	if cfg.MaxBackoff < cfg.MinBackoff {
+		cfg.MaxBackoff = time.Hour
+	}
+	if cfg.Cutoff <= 0 {
+		cfg.Cutoff = 24 * time.Hour
+	}
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	return &Dispatcher{
+		repo:   repo,
+		client: client,
+		cfg:    cfg,
+		logger: logger.With(zap.String("component", "webhook")),
+		now:    time.Now,
+	}
+}
+
+// Run sends due deliveries until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	d.logger.Info("webhook dispatcher started",
+		zap.Duration("poll_interval", d.cfg.PollInterval),
+		zap.Duration("cutoff", d.cfg.Cutoff),
+	)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			d.logger.Info("webhook dispatcher stopped")
+			return
+		case <-timer.C:
+		}
+
+		n, err := d.DispatchOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			d.logger.Error("webhook dispatch failed",
+				zap.Error(err),
+			)
+		}
+
+		if err == nil && n == d.cfg.BatchSize {
+			timer.Reset(0)
+		} else {
+			timer.Reset(d.cfg.PollInterval)
+		}
+	}
+}
+
+// DispatchOnce sends one batch of due deliveries and reports its size.
+func (d *Dispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	// The lease outlives a full attempt so a slow receiver is never sent the
+	// same delivery twice in parallel. The batch is sent all at once, so
+	// every delivery in it is done within the lease however slow the others
+	// are.
+	due, err := d.repo.ClaimDue(ctx, d.cfg.BatchSize, d.now().Add(2*d.cfg.Timeout))
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	for _, delivery := range due {
+		wg.Go(func() { d.deliver(ctx, delivery) })
+	}
+	wg.Wait()
+	return len(due), nil
+}
+
+type deliveryBody struct {
+	ID        string          `json:"id"`
+	EventID   int64           `json:"event_id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, delivery *repository.DueWebhookDelivery) {
+	attempt := model.WebhookAttempt{
+		Attempt:     delivery.Attempts + 1,
+		AttemptedAt: d.now(),
+	}
+
+	statusCode, err := d.send(ctx, delivery)
+	attempt.Duration = d.now().Sub(attempt.AttemptedAt)
+	attempt.StatusCode = statusCode
+
+	status := model.DeliverySucceeded
+	next := attempt.AttemptedAt
+	if err != nil {
+		attempt.Error = err.Error()
+		next = attempt.AttemptedAt.Add(d.backoff(attempt.Attempt))
+		status = model.DeliveryPending
+		if next.Sub(delivery.CreatedAt) > d.cfg.Cutoff {
+			status = model.DeliveryFailed
+		}
+
+		d.logger.Warn("webhook delivery attempt failed",
+			zap.Error(err),
+			zap.String("delivery_id", delivery.ID),
+			zap.String("subscription_id", delivery.SubscriptionID),
+			zap.Int("attempt", attempt.Attempt),
+			zap.String("status", string(status)),
+		)
+	}
+
+	err = d.repo.RecordAttempt(context.WithoutCancel(ctx), delivery.ID, delivery.NextAttemptAt, attempt, status, next)
+	if errors.Is(err, repository.ErrWebhookLeaseLost) {
+		// The attempt overran the lease and another dispatcher has the
+		// delivery now; what it records wins.
+		d.logger.Warn("webhook delivery lease lost before the attempt was recorded",
+			zap.String("delivery_id", delivery.ID),
+			zap.Int("attempt", attempt.Attempt),
+		)
+		return
+	}
+	if err != nil {
+		d.logger.Error("failed to record webhook attempt",
+			zap.Error(err),
+			zap.String("delivery_id", delivery.ID),
+		)
+	}
+}
+
+func (d *Dispatcher) send(ctx context.Context, delivery *repository.DueWebhookDelivery) (int, error) {
+	body, err := json.Marshal(deliveryBody{
+		ID:        delivery.ID,
+		EventID:   delivery.EventID,
+		Type:      delivery.EventType,
+		CreatedAt: delivery.CreatedAt,
+		Data:      delivery.Payload,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("marshal delivery: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, d.cfg.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(SignatureHeader, Sign(delivery.Secret, d.now(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("receiver responded with %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	backoff := d.cfg.MinBackoff
+	for i := 1; i < attempt && backoff < d.cfg.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, d.cfg.MaxBackoff)
+}
@@ -0,0 +1,261 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/internal/repository"
+	"github.com/Kosench/ecommerce-lab/internal/webhook"
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+)
+
+// fakeWebhookRepository hands out its deliveries whenever they are pending,
+// regardless of when they are due, and records every attempt made under
+// the latest lease.
+type fakeWebhookRepository struct {
+	repository.WebhookRepository
+
+	mu         sync.Mutex
+	deliveries []*repository.DueWebhookDelivery
+	recorded   []recordedAttempt
+}
+
+type recordedAttempt struct {
+	model.WebhookAttempt
+	Status        model.WebhookDeliveryStatus
+	NextAttemptAt time.Time
+}
+
+func (r *fakeWebhookRepository) ClaimDue(_ context.Context, limit int, leaseUntil time.Time) ([]*repository.DueWebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var due []*repository.DueWebhookDelivery
+	for _, d := range r.deliveries {
+		if d.Status == model.DeliveryPending && len(due) < limit {
+			d.NextAttemptAt = leaseUntil
+			copied := *d
+			due = append(due, &copied)
+		}
+	}
+	return due, nil
+}
+
+func (r *fakeWebhookRepository) RecordAttempt(_ context.Context, deliveryID string, leasedUntil time.Time, attempt model.WebhookAttempt, status model.WebhookDeliveryStatus, next time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, d := range r.deliveries {
+		if d.ID == deliveryID {
+			if d.Status != model.DeliveryPending || !d.NextAttemptAt.Equal(leasedUntil) {
+				return repository.ErrWebhookLeaseLost
+			}
+			d.Attempts = attempt.Attempt
+			d.Status = status
+			d.NextAttemptAt = next
+		}
+	}
+	r.recorded = append(r.recorded, recordedAttempt{WebhookAttempt: attempt, Status: status, NextAttemptAt: next})
+	return nil
+}
+
+func newDueDelivery(url string, createdAt time.Time) *repository.DueWebhookDelivery {
+	return &repository.DueWebhookDelivery{
+		WebhookDelivery: model.WebhookDelivery{
+			ID:             "delivery-1",
+			SubscriptionID: "subscription-1",
+			EventID:        42,
+			EventType:      "order.created",
+			Payload:        json.RawMessage(`{"order_id":"o1"}`),
+			Status:         model.DeliveryPending,
+			CreatedAt:      createdAt,
+		},
+		URL:    url,
+		Secret: "whsec_test",
+	}
+}
+
+func TestDispatcherRetriesWithBackoff(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received int
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if err := webhook.Verify("whsec_test", r.Header.Get(webhook.SignatureHeader), body, webhook.DefaultTolerance, time.Now()); err != nil {
+			t.Errorf("receiver: Verify() error = %v", err)
+		}
+		if got := r.Header.Get(webhook.DeliveryHeader); got != "delivery-1" {
+			t.Errorf("receiver: %s = %q, want delivery-1", webhook.DeliveryHeader, got)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		received++
+		if received < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer receiver.Close()
+
+	repo := &fakeWebhookRepository{deliveries: []*repository.DueWebhookDelivery{newDueDelivery(receiver.URL, time.Now())}}
+	d := webhook.NewDispatcher(repo, receiver.Client(), webhook.DispatcherConfig{
+		MinBackoff: time.Second,
+		MaxBackoff: 3 * time.Second,
+		Cutoff:     time.Hour,
+	}, logger.NewNop())
+
+	for range 4 {
+		if _, err := d.DispatchOnce(context.Background()); err != nil {
+			t.Fatalf("DispatchOnce() error = %v", err)
+		}
+	}
+
+	want := []struct {
+		statusCode int
+		status     model.WebhookDeliveryStatus
+		backoff    time.Duration
+	}{
+		{http.StatusServiceUnavailable, model.DeliveryPending, time.Second},
+		{http.StatusServiceUnavailable, model.DeliveryPending, 2 * time.Second},
+		{http.StatusOK, model.DeliverySucceeded, 0},
+	}
+	if len(repo.recorded) != len(want) {
+		t.Fatalf("recorded %d attempts, want %d", len(repo.recorded), len(want))
+	}
+	for i, w := range want {
+		got := repo.recorded[i]
+		if got.Attempt != i+1 || got.StatusCode != w.statusCode || got.Status != w.status {
+			t.Errorf("attempt %d = #%d, %d, %s; want #%d, %d, %s", i, got.Attempt, got.StatusCode, got.Status, i+1, w.statusCode, w.status)
+		}
+		if backoff := got.NextAttemptAt.Sub(got.AttemptedAt); backoff != w.backoff {
+			t.Errorf("attempt %d: next attempt after %s, want %s", i, backoff, w.backoff)
+		}
+		if (got.Error == "") != (w.status == model.DeliverySucceeded) {
+			t.Errorf("attempt %d: error = %q", i, got.Error)
+		}
+	}
+}
+
+func TestDispatcherSendsBatchInParallel(t *testing.T) {
+	const batch = 3
+
+	// Each receiver holds its response until the whole batch has arrived,
+	// which never happens if deliveries are sent one at a time.
+	var arrived sync.WaitGroup
+	arrived.Add(batch)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		arrived.Done()
+		arrived.Wait()
+	}))
+	defer receiver.Close()
+
+	repo := &fakeWebhookRepository{}
+	for i := range batch {
+		delivery := newDueDelivery(receiver.URL, time.Now())
+		delivery.ID = fmt.Sprintf("delivery-%d", i+1)
+		repo.deliveries = append(repo.deliveries, delivery)
+	}
+	d := webhook.NewDispatcher(repo, receiver.Client(), webhook.DispatcherConfig{
+		BatchSize: batch,
+		Timeout:   time.Second,
+		Cutoff:    time.Hour,
+	}, logger.NewNop())
+
+	n, err := d.DispatchOnce(context.Background())
+	if err != nil {
+		t.Fatalf("DispatchOnce() error = %v", err)
+	}
+	if n != batch || len(repo.recorded) != batch {
+		t.Fatalf("dispatched %d, recorded %d attempts, want %d", n, len(repo.recorded), batch)
+	}
+	for _, got := range repo.recorded {
+		if got.Status != model.DeliverySucceeded {
+			t.Errorf("attempt = %d, %s, %q; want delivered", got.StatusCode, got.Status, got.Error)
+		}
+	}
+}
+
+func TestDispatcherDoesNotOverwriteAfterLosingLease(t *testing.T) {
+	repo := &fakeWebhookRepository{}
+	reclaimedUntil := time.Now().Add(time.Hour)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The attempt overruns its lease and another dispatcher claims the
+		// delivery before it is recorded.
+		repo.mu.Lock()
+		defer repo.mu.Unlock()
+		repo.deliveries[0].NextAttemptAt = reclaimedUntil
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer receiver.Close()
+
+	repo.deliveries = []*repository.DueWebhookDelivery{newDueDelivery(receiver.URL, time.Now())}
+	d := webhook.NewDispatcher(repo, receiver.Client(), webhook.DispatcherConfig{Cutoff: time.Hour}, logger.NewNop())
+
+	if _, err := d.DispatchOnce(context.Background()); err != nil {
+		t.Fatalf("DispatchOnce() error = %v", err)
+	}
+
+	if len(repo.recorded) != 0 {
+		t.Errorf("recorded %d attempts, want none", len(repo.recorded))
+	}
+	if got := repo.deliveries[0]; got.Attempts != 0 || got.Status != model.DeliveryPending || !got.NextAttemptAt.Equal(reclaimedUntil) {
+		t.Errorf("delivery = %d attempts, %s, next at %s; want the new claim untouched", got.Attempts, got.Status, got.NextAttemptAt)
+	}
+}
+
+func TestDispatcherCapsBackoffAndGivesUp(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	tests := []struct {
+		name        string
+		attempts    int
+		createdAgo  time.Duration
+		wantBackoff time.Duration
+		wantStatus  model.WebhookDeliveryStatus
+	}{
+		{"backoff is capped", 10, 0, 4 * time.Second, model.DeliveryPending},
+		{"retry past the cutoff fails", 10, time.Hour, 4 * time.Second, model.DeliveryFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			delivery := newDueDelivery(receiver.URL, time.Now().Add(-tt.createdAgo))
+			delivery.Attempts = tt.attempts
+			repo := &fakeWebhookRepository{deliveries: []*repository.DueWebhookDelivery{delivery}}
+			d := webhook.NewDispatcher(repo, receiver.Client(), webhook.DispatcherConfig{
+				MinBackoff: time.Second,
+				MaxBackoff: 4 * time.Second,
+				Cutoff:     time.Hour,
+			}, logger.NewNop())
+
+			if _, err := d.DispatchOnce(context.Background()); err != nil {
+				t.Fatalf("DispatchOnce() error = %v", err)
+			}
+
+			if len(repo.recorded) != 1 {
+				t.Fatalf("recorded %d attempts, want 1", len(repo.recorded))
+			}
+			got := repo.recorded[0]
+			if got.Attempt != tt.attempts+1 || got.StatusCode != http.StatusInternalServerError {
+				t.Errorf("attempt = #%d with %d, want #%d with 500", got.Attempt, got.StatusCode, tt.attempts+1)
+			}
+			if backoff := got.NextAttemptAt.Sub(got.AttemptedAt); backoff != tt.wantBackoff {
+				t.Errorf("next attempt after %s, want %s", backoff, tt.wantBackoff)
+			}
+			if got.Status != tt.wantStatus {
+				t.Errorf("status = %s, want %s", got.Status, tt.wantStatus)
+			}
+		})
+	}
+}
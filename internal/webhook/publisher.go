@@ -0,0 +1,23 @@
+package webhook
+
+import (
+	"context"
+
+	"github.com/Kosench/ecommerce-lab/internal/model"
+	"github.com/Kosench/ecommerce-lab/internal/repository"
+)
+
+// Publisher is an outbox publisher that turns events into pending
+// deliveries; the Dispatcher sends them.
+type Publisher struct {
+	repo repository.WebhookRepository
+}
+
+func NewPublisher(repo repository.WebhookRepository) *Publisher {
+	return &Publisher{repo: repo}
+}
+
+func (p *Publisher) Publish(ctx context.Context, event model.Event) error {
+	_, err := p.repo.Enqueue(ctx, event)
+	return err
+}
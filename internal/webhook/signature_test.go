@@ -0,0 +1,127 @@
+package webhook_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/internal/webhook"
+)
+
+func TestSignVerify(t *testing.T) {
+	const (
+		secret    = "whsec_current"
+		oldSecret = "whsec_previous"
+	)
+	body := []byte(`{"id":"d1","type":"order.created"}`)
+	sentAt := time.Unix(1_700_000_000, 0)
+	header := webhook.Sign(secret, sentAt, body)
+
+	tests := []struct {
+		name    string
+		secret  string
+		header  string
+		body    []byte
+		now     time.Time
+		wantErr error
+	}{
+		{
+			name:   "valid",
+			secret: secret,
+			header: header,
+			body:   body,
+			now:    sentAt,
+		},
+		{
+			name:   "valid at the edge of the tolerance",
+			secret: secret,
+			header: header,
+			body:   body,
+			now:    sentAt.Add(webhook.DefaultTolerance),
+		},
+		{
+			name:    "tampered body",
+			secret:  secret,
+			header:  header,
+			body:    []byte(`{"id":"d1","type":"order.cancelled"}`),
+			now:     sentAt,
+			wantErr: webhook.ErrInvalidSignature,
+		},
+		{
+			name:    "tampered timestamp",
+			secret:  secret,
+			header:  strings.Replace(header, "t=1700000000", "t=1700000001", 1),
+			body:    body,
+			now:     sentAt,
+			wantErr: webhook.ErrInvalidSignature,
+		},
+		{
+			name:    "stale timestamp",
+			secret:  secret,
+			header:  header,
+			body:    body,
+			now:     sentAt.Add(webhook.DefaultTolerance + time.Second),
+			wantErr: webhook.ErrStaleTimestamp,
+		},
+		{
+			name:    "timestamp in the future",
+			secret:  secret,
+			header:  header,
+			body:    body,
+			now:     sentAt.Add(-webhook.DefaultTolerance - time.Second),
+			wantErr: webhook.ErrStaleTimestamp,
+		},
+		{
+			name:    "signed before the secret was rotated",
+			secret:  secret,
+			header:  webhook.Sign(oldSecret, sentAt, body),
+			body:    body,
+			now:     sentAt,
+			wantErr: webhook.ErrInvalidSignature,
+		},
+		{
+			name:   "header carrying MACs for both secrets verifies under either",
+			secret: oldSecret,
+			header: fmt.Sprintf("%s,v1=%s", header, macOf(t, webhook.Sign(oldSecret, sentAt, body))),
+			body:   body,
+			now:    sentAt,
+		},
+		{
+			name:    "no MAC",
+			secret:  secret,
+			header:  "t=1700000000",
+			body:    body,
+			now:     sentAt,
+			wantErr: webhook.ErrInvalidSignature,
+		},
+		{
+			name:    "malformed timestamp",
+			secret:  secret,
+			header:  "t=yesterday,v1=" + macOf(t, header),
+			body:    body,
+			now:     sentAt,
+			wantErr: webhook.ErrInvalidSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := webhook.Verify(tt.secret, tt.header, tt.body, webhook.DefaultTolerance, tt.now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func macOf(t *testing.T, header string) string {
+	t.Helper()
+
+	_, mac, ok := strings.Cut(header, ",v1=")
+	if !ok {
+		t.Fatalf("header %q has no v1 MAC", header)
+	}
+	return mac
+}
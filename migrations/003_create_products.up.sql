@@ -0,0 +1,13 @@
+CREATE TABLE products (
+    id UUID PRIMARY KEY,
+    name TEXT NOT NULL CHECK (name <> ''),
+    description TEXT NOT NULL DEFAULT '',
+    price BIGINT NOT NULL CHECK (price > 0),
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_products_active ON products(active);
+
+ALTER TABLE order_items ADD COLUMN product_name TEXT NOT NULL DEFAULT '';
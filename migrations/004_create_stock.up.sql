@@ -0,0 +1,7 @@
+CREATE TABLE stock (
+    product_id UUID PRIMARY KEY REFERENCES products(id) ON DELETE CASCADE,
+    on_hand INT NOT NULL DEFAULT 0 CHECK (on_hand >= 0),
+    reserved INT NOT NULL DEFAULT 0 CHECK (reserved >= 0),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    CHECK (reserved <= on_hand)
+);
@@ -0,0 +1,15 @@
+CREATE TABLE outbox (
+    id BIGSERIAL PRIMARY KEY,
+    aggregate_type TEXT NOT NULL,
+    aggregate_id UUID NOT NULL,
+    event_type TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    published_at TIMESTAMPTZ,
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_error TEXT
+);
+
+CREATE INDEX idx_outbox_pending ON outbox(id) WHERE published_at IS NULL;
+CREATE INDEX idx_outbox_aggregate_pending ON outbox(aggregate_id, id) WHERE published_at IS NULL;
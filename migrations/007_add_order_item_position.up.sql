@@ -0,0 +1,3 @@
+-- Item IDs are random UUIDs, so ordering by id does not preserve the order
+-- items were placed in.
+ALTER TABLE order_items ADD COLUMN position INT NOT NULL DEFAULT 0;
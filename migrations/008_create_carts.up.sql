@@ -0,0 +1,22 @@
+CREATE TABLE carts (
+    id UUID PRIMARY KEY,
+    user_id UUID,
+    status TEXT NOT NULL CHECK (status IN ('open', 'checked_out', 'merged')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_carts_user_id ON carts(user_id) WHERE user_id IS NOT NULL;
+
+CREATE TABLE cart_items (
+    cart_id UUID NOT NULL REFERENCES carts(id) ON DELETE CASCADE,
+    product_id UUID NOT NULL REFERENCES products(id) ON DELETE CASCADE,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    added_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (cart_id, product_id)
+);
+
+ALTER TABLE orders ADD COLUMN cart_id UUID REFERENCES carts(id);
+
+-- A cart is checked out at most once.
+CREATE UNIQUE INDEX idx_orders_cart_id ON orders(cart_id) WHERE cart_id IS NOT NULL;
@@ -0,0 +1,15 @@
+CREATE TABLE payments (
+    id UUID PRIMARY KEY,
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    provider TEXT NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('pending', 'authorized', 'captured', 'voided', 'failed', 'refunded')),
+    amount BIGINT NOT NULL CHECK (amount > 0),
+    authorization_id TEXT NOT NULL DEFAULT '',
+    capture_id TEXT NOT NULL DEFAULT '',
+    failure_code TEXT NOT NULL DEFAULT '',
+    failure_message TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_payments_order_id ON payments(order_id, created_at);
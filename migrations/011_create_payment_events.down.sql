@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_payments_authorization_id;
+DROP TABLE IF EXISTS payment_events;
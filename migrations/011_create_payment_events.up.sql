@@ -0,0 +1,18 @@
+CREATE TABLE payment_events (
+    id UUID PRIMARY KEY,
+    provider TEXT NOT NULL,
+    event_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    -- Not a foreign key: the event is stored before it is checked.
+    order_id TEXT NOT NULL,
+    payload JSONB NOT NULL,
+    outcome TEXT NOT NULL DEFAULT '' CHECK (outcome IN ('', 'applied', 'ignored')),
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    processed_at TIMESTAMPTZ,
+    CONSTRAINT payment_events_provider_event_id_key UNIQUE (provider, event_id)
+);
+
+CREATE INDEX idx_payment_events_order_id ON payment_events(order_id, received_at);
+
+-- Webhooks find their payment by the provider's authorization ID.
+CREATE INDEX idx_payments_authorization_id ON payments(provider, authorization_id) WHERE authorization_id <> '';
@@ -0,0 +1,24 @@
+ALTER TABLE orders DROP CONSTRAINT orders_status_check;
+ALTER TABLE orders ADD CONSTRAINT orders_status_check
+    CHECK (status IN ('pending', 'paid', 'cancelled', 'partially_refunded', 'refunded'));
+
+CREATE TABLE refunds (
+    id UUID PRIMARY KEY,
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    payment_id UUID NOT NULL REFERENCES payments(id),
+    provider_refund_id TEXT NOT NULL DEFAULT '',
+    amount BIGINT NOT NULL CHECK (amount > 0),
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE refund_items (
+    refund_id UUID NOT NULL REFERENCES refunds(id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    product_id UUID NOT NULL,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    amount BIGINT NOT NULL CHECK (amount >= 0),
+    PRIMARY KEY (refund_id, product_id)
+);
+
+CREATE INDEX idx_refunds_order_id ON refunds(order_id, created_at);
@@ -0,0 +1,11 @@
+-- Amounts are in minor units of the row's ISO 4217 currency. Existing rows
+-- were priced in US dollars; new rows must name their currency.
+ALTER TABLE products ADD COLUMN currency TEXT NOT NULL DEFAULT 'USD' CHECK (currency ~ '^[A-Z]{3}$');
+ALTER TABLE products ALTER COLUMN currency DROP DEFAULT;
+
+-- Order items, refunds and payments of an order share its currency.
+ALTER TABLE orders ADD COLUMN currency TEXT NOT NULL DEFAULT 'USD' CHECK (currency ~ '^[A-Z]{3}$');
+ALTER TABLE orders ALTER COLUMN currency DROP DEFAULT;
+
+ALTER TABLE payments ADD COLUMN currency TEXT NOT NULL DEFAULT 'USD' CHECK (currency ~ '^[A-Z]{3}$');
+ALTER TABLE payments ALTER COLUMN currency DROP DEFAULT;
@@ -0,0 +1,6 @@
+ALTER TABLE order_items DROP COLUMN IF EXISTS discounts;
+ALTER TABLE orders DROP COLUMN IF EXISTS discount;
+ALTER TABLE orders DROP COLUMN IF EXISTS subtotal;
+
+DROP TABLE IF EXISTS coupon_redemptions;
+DROP TABLE IF EXISTS coupons;
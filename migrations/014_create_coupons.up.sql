@@ -0,0 +1,46 @@
+-- currency is '' for coupons that apply in any currency; amount_off and
+-- min_subtotal are in it otherwise.
+CREATE TABLE coupons (
+    id UUID PRIMARY KEY,
+    code TEXT NOT NULL UNIQUE,
+    type TEXT NOT NULL CHECK (type IN ('percent', 'fixed', 'buy_x_get_y', 'free_shipping')),
+    percent_off INT NOT NULL DEFAULT 0 CHECK (percent_off BETWEEN 0 AND 100),
+    amount_off BIGINT NOT NULL DEFAULT 0 CHECK (amount_off >= 0),
+    buy_quantity INT NOT NULL DEFAULT 0 CHECK (buy_quantity >= 0),
+    get_quantity INT NOT NULL DEFAULT 0 CHECK (get_quantity >= 0),
+    currency TEXT NOT NULL DEFAULT '' CHECK (currency ~ '^([A-Z]{3})?$'),
+    min_subtotal BIGINT NOT NULL DEFAULT 0 CHECK (min_subtotal >= 0),
+    product_ids UUID[] NOT NULL DEFAULT '{}',
+    max_redemptions INT NOT NULL DEFAULT 0 CHECK (max_redemptions >= 0),
+    max_redemptions_per_user INT NOT NULL DEFAULT 0 CHECK (max_redemptions_per_user >= 0),
+    starts_at TIMESTAMPTZ,
+    ends_at TIMESTAMPTZ,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- A redemption is written in the transaction that inserts its order, with
+-- the coupon row locked, so usage limits hold under concurrent orders.
+CREATE TABLE coupon_redemptions (
+    coupon_id UUID NOT NULL REFERENCES coupons(id),
+    order_id UUID NOT NULL REFERENCES orders(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL,
+    position INT NOT NULL,
+    amount BIGINT NOT NULL CHECK (amount >= 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (coupon_id, order_id)
+);
+
+CREATE INDEX idx_coupon_redemptions_order_id ON coupon_redemptions(order_id);
+CREATE INDEX idx_coupon_redemptions_user_id ON coupon_redemptions(coupon_id, user_id);
+
+-- Existing orders had no discounts.
+ALTER TABLE orders ADD COLUMN subtotal BIGINT;
+UPDATE orders SET subtotal = total;
+ALTER TABLE orders ALTER COLUMN subtotal SET NOT NULL;
+ALTER TABLE orders ADD COLUMN discount BIGINT NOT NULL DEFAULT 0 CHECK (discount >= 0);
+
+-- discounts breaks the line's discount down by coupon:
+-- [{"code": "SPRING10", "amount": 150}, ...]
+ALTER TABLE order_items ADD COLUMN discounts JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1,5 @@
+ALTER TABLE order_items DROP COLUMN IF EXISTS tax_amount;
+ALTER TABLE order_items DROP COLUMN IF EXISTS tax_category;
+ALTER TABLE orders DROP COLUMN IF EXISTS tax_jurisdiction;
+ALTER TABLE orders DROP COLUMN IF EXISTS tax_amount;
+ALTER TABLE products DROP COLUMN IF EXISTS tax_category;
@@ -0,0 +1,10 @@
+-- tax_category picks a product's rate in the tax table; '' is the table's
+-- default category.
+ALTER TABLE products ADD COLUMN tax_category TEXT NOT NULL DEFAULT '';
+
+-- Existing orders were not taxed. total now includes tax_amount.
+ALTER TABLE orders ADD COLUMN tax_amount BIGINT NOT NULL DEFAULT 0 CHECK (tax_amount >= 0);
+ALTER TABLE orders ADD COLUMN tax_jurisdiction TEXT NOT NULL DEFAULT '';
+
+ALTER TABLE order_items ADD COLUMN tax_category TEXT NOT NULL DEFAULT '';
+ALTER TABLE order_items ADD COLUMN tax_amount BIGINT NOT NULL DEFAULT 0 CHECK (tax_amount >= 0);
@@ -0,0 +1,7 @@
+DELETE FROM idempotency_keys;
+
+ALTER TABLE idempotency_keys DROP COLUMN IF EXISTS response_content_type;
+
+ALTER TABLE idempotency_keys DROP CONSTRAINT idempotency_keys_pkey;
+ALTER TABLE idempotency_keys DROP COLUMN scope;
+ALTER TABLE idempotency_keys ADD PRIMARY KEY (key);
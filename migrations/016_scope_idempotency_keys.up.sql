@@ -0,0 +1,9 @@
+-- Keys are scoped to the caller that sent them. Existing keys cannot be
+-- attributed to a caller; they only guard retries for a day, so drop them.
+DELETE FROM idempotency_keys;
+
+ALTER TABLE idempotency_keys DROP CONSTRAINT idempotency_keys_pkey;
+ALTER TABLE idempotency_keys ADD COLUMN scope TEXT NOT NULL;
+ALTER TABLE idempotency_keys ADD PRIMARY KEY (scope, key);
+
+ALTER TABLE idempotency_keys ADD COLUMN response_content_type TEXT;
@@ -0,0 +1,6 @@
+-- Refunds are recorded as pending before the provider is asked to make
+-- them, so concurrent refunds of an order are checked against each other.
+-- Refunds the provider does not make are kept as failed.
+ALTER TABLE refunds ADD COLUMN status TEXT NOT NULL DEFAULT 'succeeded'
+    CHECK (status IN ('pending', 'succeeded', 'failed'));
+ALTER TABLE refunds ALTER COLUMN status DROP DEFAULT;
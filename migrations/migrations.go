@@ -0,0 +1,8 @@
+// Package migrations embeds the SQL schema migrations so the binary can
+// apply them itself. Files are named NNN_name.up.sql and NNN_name.down.sql.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,53 @@
+package logger
+
+import (
+	"context"
+	"slices"
+
+	"go.uber.org/zap"
+)
+
+type ctxKey struct{}
+
+type ctxValue struct {
+	logger Logger
+	fields []zap.Field
+}
+
+var nop = NewNop()
+
+// NewNop returns a logger that discards everything.
+func NewNop() Logger {
+	return &ZapLogger{Logger: zap.NewNop()}
+}
+
+// NewContext returns a copy of ctx carrying a request-scoped logger: base
+// with the fields already stored in ctx plus fields.
+func NewContext(ctx context.Context, base Logger, fields ...zap.Field) context.Context {
+	all := fields
+	if v, ok := ctx.Value(ctxKey{}).(ctxValue); ok {
+		all = append(slices.Clip(v.fields), fields...)
+	}
+	return context.WithValue(ctx, ctxKey{}, ctxValue{
+		logger: base.With(all...),
+		fields: all,
+	})
+}
+
+// FromContext returns the request-scoped logger stored in ctx, or a no-op
+// logger if there is none.
+func FromContext(ctx context.Context) Logger {
+	if v, ok := ctx.Value(ctxKey{}).(ctxValue); ok {
+		return v.logger
+	}
+	return nop
+}
+
+// WithContext returns l extended with the request-scoped fields stored in
+// ctx. Components use it to keep their own fields on request log lines.
+func WithContext(ctx context.Context, l Logger) Logger {
+	if v, ok := ctx.Value(ctxKey{}).(ctxValue); ok && len(v.fields) > 0 {
+		return l.With(v.fields...)
+	}
+	return l
+}
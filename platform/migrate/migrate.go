@@ -0,0 +1,410 @@
+// Package migrate applies versioned SQL migrations and records them in the
+// schema_migrations table. Runs are serialised across processes with a
+// Postgres advisory lock.
+package migrate
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/Kosench/ecommerce-lab/platform/logger"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+// lockID keys the advisory lock held while migrating.
+const lockID int64 = 7_245_318_004
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+var (
+	ErrNoDownMigration = errors.New("migration has no down script")
+	// ErrUnversionedSchema is returned by Up when the database already has
+	// tables but no recorded migrations, as databases created before
+	// versioned migrations do. Baseline records what they already have.
+	ErrUnversionedSchema = errors.New("database has tables but no recorded migrations")
+	ErrUnknownVersion    = errors.New("unknown migration version")
+	ErrAlreadyVersioned  = errors.New("database already has recorded migrations")
+)
+
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration together with when it was applied, if it was.
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	pool       *pgxpool.Pool
+	migrations []Migration
+	logger     logger.Logger
+}
+
+// New loads every NNN_name.up.sql / NNN_name.down.sql pair from fsys.
+func New(pool *pgxpool.Pool, fsys fs.FS, logger logger.Logger) (*Migrator, error) {
+	migrations, err := load(fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		pool:       pool,
+		migrations: migrations,
+		logger:     logger.With(zap.String("component", "migrate")),
+	}, nil
+}
+
+func load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		m := fileName.FindStringSubmatch(e.Name())
+		if e.IsDir() || m == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse migration version %q: %w", e.Name(), err)
+		}
+
+		body, err := fs.ReadFile(fsys, path.Join(".", e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read migration %s: %w", e.Name(), err)
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration version %d has two names: %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up script", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return migrations, nil
+}
+
+// Latest is the version the embedded migrations bring the schema to.
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Current is the highest applied version, or 0 on a fresh database.
+func (m *Migrator) Current(ctx context.Context) (int64, error) {
+	var exists bool
+	if err := m.pool.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return 0, fmt.Errorf("check schema_migrations: %w", err)
+	}
+	if !exists {
+		return 0, nil
+	}
+
+	var version int64
+	err := m.pool.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("get schema version: %w", err)
+	}
+	return version, nil
+}
+
+// Up applies every pending migration in order and returns how many ran.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := m.withLock(ctx, func(conn *pgx.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if len(done) == 0 {
+			unversioned, err := hasTables(ctx, conn)
+			if err != nil {
+				return err
+			}
+			if unversioned {
+				return fmt.Errorf("%w: run \"migrate baseline <version>\" with the version its schema is at", ErrUnversionedSchema)
+			}
+		}
+
+		for _, mig := range m.migrations {
+			if _, ok := done[mig.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, conn, mig, mig.Up, true); err != nil {
+				return err
+			}
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down rolls back the last steps applied migrations, newest first.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	reverted := 0
+	err := m.withLock(ctx, func(conn *pgx.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range slices.Backward(m.migrations) {
+			if reverted == steps {
+				break
+			}
+			if _, ok := done[mig.Version]; !ok {
+				continue
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("%w: %d_%s", ErrNoDownMigration, mig.Version, mig.Name)
+			}
+			if err := m.apply(ctx, conn, mig, mig.Down, false); err != nil {
+				return err
+			}
+			reverted++
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Baseline records every migration up to and including version as applied
+// without running it. It is for databases whose schema was created outside
+// the migrator, and refuses to touch one that already has recorded
+// migrations.
+func (m *Migrator) Baseline(ctx context.Context, version int64) (int, error) {
+	i := slices.IndexFunc(m.migrations, func(mig Migration) bool { return mig.Version == version })
+	if i < 0 {
+		return 0, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+
+	err := m.withLock(ctx, func(conn *pgx.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if len(done) > 0 {
+			return ErrAlreadyVersioned
+		}
+
+		tx, err := conn.Begin(ctx)
+		if err != nil {
+			return fmt.Errorf("begin baseline: %w", err)
+		}
+		defer tx.Rollback(ctx)
+
+		for _, mig := range m.migrations[:i+1] {
+			if _, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, mig.Version, mig.Name); err != nil {
+				return fmt.Errorf("record migration %d: %w", mig.Version, err)
+			}
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return fmt.Errorf("commit baseline: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	logger.WithContext(ctx, m.logger).Info("schema baselined",
+		zap.Int64("version", version),
+	)
+	return i + 1, nil
+}
+
+// Status lists every known migration and whether it has been applied. It
+// only reads, so it never creates schema_migrations.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	var exists bool
+	if err := conn.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("check schema_migrations: %w", err)
+	}
+	done := map[int64]time.Time{}
+	if exists {
+		done, err = appliedVersions(ctx, conn.Conn())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := make([]Status, len(m.migrations))
+	for i, mig := range m.migrations {
+		statuses[i] = Status{Migration: mig}
+		if at, ok := done[mig.Version]; ok {
+			statuses[i].AppliedAt = &at
+		}
+	}
+	return statuses, nil
+}
+
+// apply runs one script and records (or forgets) its version in the same
+// transaction, so a failed migration leaves no trace.
+func (m *Migrator) apply(ctx context.Context, conn *pgx.Conn, mig Migration, script string, up bool) (err error) {
+	direction := "up"
+	if !up {
+		direction = "down"
+	}
+	log := logger.WithContext(ctx, m.logger).With(
+		zap.Int64("version", mig.Version),
+		zap.String("name", mig.Name),
+		zap.String("direction", direction),
+	)
+
+	start := time.Now()
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin migration %d: %w", mig.Version, err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback(ctx)
+		}
+	}()
+
+	if _, err = tx.Exec(ctx, script); err != nil {
+		log.Error("migration failed",
+			zap.Error(err),
+		)
+		return fmt.Errorf("run migration %d_%s %s: %w", mig.Version, mig.Name, direction, err)
+	}
+
+	if up {
+		_, err = tx.Exec(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, mig.Version, mig.Name)
+	} else {
+		_, err = tx.Exec(ctx, `DELETE FROM schema_migrations WHERE version = $1`, mig.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("record migration %d: %w", mig.Version, err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commit migration %d: %w", mig.Version, err)
+	}
+
+	log.Info("migration applied",
+		zap.Duration("duration", time.Since(start)),
+	)
+	return nil
+}
+
+// withLock runs fn on a dedicated connection holding the migration advisory
+// lock, so concurrent instances migrate one at a time.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgx.Conn) error) error {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer func() {
+		// The lock must be released even if ctx has been cancelled.
+		if _, err := conn.Exec(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, lockID); err != nil {
+			m.logger.Error("failed to release migration lock",
+				zap.Error(err),
+			)
+		}
+	}()
+
+	if err := ensureTable(ctx, conn.Conn()); err != nil {
+		return err
+	}
+	return fn(conn.Conn())
+}
+
+func ensureTable(ctx context.Context, conn *pgx.Conn) error {
+	_, err := conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`)
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+// hasTables reports whether the current schema holds any table besides
+// schema_migrations.
+func hasTables(ctx context.Context, conn *pgx.Conn) (bool, error) {
+	var found bool
+	err := conn.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM pg_tables
+			WHERE schemaname = current_schema() AND tablename <> 'schema_migrations'
+		)`).Scan(&found)
+	if err != nil {
+		return false, fmt.Errorf("check existing tables: %w", err)
+	}
+	return found, nil
+}
+
+func appliedVersions(ctx context.Context, conn *pgx.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.Query(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, fmt.Errorf("list applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	done := make(map[int64]time.Time)
+	for rows.Next() {
+		var (
+			version   int64
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, fmt.Errorf("scan applied migration: %w", err)
+		}
+		done[version] = appliedAt
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list applied migrations: %w", err)
+	}
+	return done, nil
+}
@@ -0,0 +1,43 @@
+package requestid
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Header is the HTTP header a request ID is read from and echoed in.
+const Header = "X-Request-ID"
+
+const maxLength = 128
+
+type ctxKey struct{}
+
+// New generates a fresh request ID.
+func New() string {
+	return uuid.NewString()
+}
+
+// Valid reports whether a client-supplied ID is safe to log and echo back:
+// non-empty, bounded and made of printable ASCII without spaces.
+func Valid(id string) bool {
+	if id == "" || len(id) > maxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, id)
+}
+
+// FromContext returns the request ID stored in ctx, or "" if there is none.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKey{}).(string)
+	return id
+}
@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const pgxTracerName = "github.com/Kosench/ecommerce-lab/platform/tracing/pgx"
+
+// QueryTracer is a pgx.QueryTracer that opens a client span per query.
+// Install it on pgxpool.Config.ConnConfig.Tracer.
+type QueryTracer struct{}
+
+func NewQueryTracer() *QueryTracer {
+	return &QueryTracer{}
+}
+
+func (t *QueryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	attrs := []attribute.KeyValue{
+		semconv.DBSystemPostgreSQL,
+		semconv.DBQueryText(data.SQL),
+	}
+	if conn != nil {
+		cfg := conn.Config()
+		attrs = append(attrs,
+			semconv.DBNamespace(cfg.Database),
+			semconv.ServerAddress(cfg.Host),
+			semconv.ServerPort(int(cfg.Port)),
+		)
+	}
+
+	ctx, _ = otel.Tracer(pgxTracerName).Start(ctx, spanName(data.SQL),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+	return ctx
+}
+
+func (t *QueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	if data.Err != nil {
+		span.RecordError(data.Err)
+		span.SetStatus(codes.Error, data.Err.Error())
+	} else {
+		span.SetAttributes(attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+	}
+	span.End()
+}
+
+// spanName uses the SQL verb ("SELECT", "INSERT", ...) so span names stay
+// low-cardinality; the full statement is an attribute.
+func spanName(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return "db.query"
+	}
+	return "db." + strings.ToUpper(fields[0])
+}